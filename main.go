@@ -5,11 +5,18 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/helfy18/movie-site-api/modules/auth"
+	"github.com/helfy18/movie-site-api/modules/cache"
+	"github.com/helfy18/movie-site-api/modules/games"
 	"github.com/helfy18/movie-site-api/modules/movies"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"github.com/helfy18/movie-site-api/modules/ranking"
+	"github.com/helfy18/movie-site-api/modules/tournaments"
+	"github.com/helfy18/movie-site-api/modules/users"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -48,6 +55,30 @@ func main() {
 
 	fmt.Println("Pinged your deployment. You successfully connected to MongoDB!")
 
+	// Indexes for accounts and per-user data
+	db := client.Database("jdmovies")
+	if err := auth.EnsureIndexes(context.TODO(), db); err != nil {
+		log.Printf("Failed to create auth indexes: %v", err)
+	}
+	if err := users.EnsureIndexes(context.TODO(), db); err != nil {
+		log.Printf("Failed to create user indexes: %v", err)
+	}
+	if err := movies.EnsureIndexes(context.TODO(), db); err != nil {
+		log.Printf("Failed to create movie indexes: %v", err)
+	}
+	if err := ranking.EnsureIndexes(context.TODO(), db); err != nil {
+		log.Printf("Failed to create ranking indexes: %v", err)
+	}
+	if err := games.EnsureIndexes(context.TODO(), db); err != nil {
+		log.Printf("Failed to create game indexes: %v", err)
+	}
+	if err := tournaments.EnsureIndexes(context.TODO(), db); err != nil {
+		log.Printf("Failed to create tournament indexes: %v", err)
+	}
+
+	// Tag every request with an id used in error responses and logs
+	router.Use(problem.RequestID())
+
 	// Middleware to inject MongoDB client into the context
 	router.Use(func(c *gin.Context) {
 		c.Set("mongoClient", client)
@@ -56,18 +87,95 @@ func main() {
 
 	config := cors.DefaultConfig()
 	config.AllowOrigins = []string{os.Getenv("SITEURL"), os.Getenv(("LOCALURL"))}
+	config.AllowHeaders = append(config.AllowHeaders, "Authorization", "If-None-Match", problem.RequestIDHeader, movies.RandomSessionHeader)
+	config.ExposeHeaders = []string{problem.RequestIDHeader, "ETag", "X-Cache", movies.RandomSessionHeader}
 	router.Use(cors.New(config))
 
+	// Cache catalog reads until the movies or universes collection changes
+	catalogCache := cache.New(time.Minute, 10*time.Minute, 1000)
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	go catalogCache.Watch(watchCtx, client.Database("jdmovies"), "movies", "universes")
+	cached := catalogCache.Handler()
+
 	// Define routes
-	router.GET("/movies/list", movies.ListMovies)
-	router.GET("/movies/get", movies.GetMovie)
-	router.GET("/movies/list/id", movies.GetMovieById)
-	router.GET("/types/list", movies.ListTypes)
-	router.GET("/movies/count", movies.GetMovieCount)
-	router.GET("/movies/mostRecent", movies.GetMostRecent)
+	router.GET("/movies/list", cached, movies.ListMovies)
+	router.GET("/movies/get", cached, movies.GetMovie)
+	router.GET("/movies/list/id", cached, movies.GetMovieById)
+	router.GET("/types/list", cached, movies.ListTypes)
+	router.GET("/movies/count", cached, movies.GetMovieCount)
+	router.GET("/movies/mostRecent", cached, movies.GetMostRecent)
 	router.GET("/movies/random", movies.GetRandomMovie)
+	router.GET("/movies/daily", movies.GetDailyMovie)
+	router.GET("/movies/:tmdbid/recommendations", cached, movies.GetRecommendations)
+	router.GET("/movies/:tmdbid/similar", movies.GetSimilarMovies)
+	router.GET("/stats", cached, movies.GetStats)
+	router.GET("/stats/critics", cached, movies.GetCriticStats)
+	router.GET("/stats/money", cached, movies.GetMoneyStats)
+	router.GET("/leaderboards/:entity", cached, movies.GetLeaderboard)
+	router.GET("/reviewers", cached, movies.GetReviewers)
+	router.GET("/reviewers/compare", cached, movies.CompareReviewers)
+	router.GET("/reviewers/combined", cached, movies.GetCombinedScores)
+	router.GET("/reviewers/:reviewer/movies", cached, movies.GetReviewerMovies)
+	router.GET("/tiers", cached, movies.GetTiers)
+	router.GET("/marathon", cached, movies.PlanMarathon)
+	router.GET("/universes/:name/watch-order", cached, movies.GetWatchOrder)
+	router.PUT("/universes/:name/watch-order", auth.RequireAdmin, catalogCache.InvalidateOnWrite(), movies.PutWatchOrder)
+	router.PUT("/movies/:tmdbid/tier", auth.RequireAdmin, catalogCache.InvalidateOnWrite(), movies.PutTier)
+	router.PUT("/movies/:tmdbid/reviews/:reviewer", auth.RequireAdmin, catalogCache.InvalidateOnWrite(), movies.PutReview)
+
+	router.GET("/ranking/pair", auth.RequireUser, ranking.GetPair)
+	router.POST("/ranking/compare", auth.RequireUser, ranking.PostComparison)
+	router.GET("/ranking/suggested", ranking.GetSuggestedRanking)
+	router.POST("/ranking/accept", auth.RequireAdmin, catalogCache.InvalidateOnWrite(), ranking.AcceptRanking)
 
+	router.POST("/auth/register", auth.Register)
 	router.POST("/auth/login", auth.Login)
+	router.POST("/auth/logout", auth.RequireUser, auth.Logout)
+
+	me := router.Group("/me", auth.RequireUser)
+	me.GET("", auth.GetMe)
+	me.PATCH("", auth.UpdateMe)
+	me.GET("/ratings", users.ListRatings)
+	me.PUT("/ratings/:tmdbid", users.RateMovie)
+	me.DELETE("/ratings/:tmdbid", users.DeleteRating)
+	me.GET("/recommendations", users.GetRecommendations)
+	me.GET("/watchlist", users.GetWatchlist)
+	me.PUT("/watchlist/order", users.ReorderWatchlist)
+	me.PUT("/watchlist/:tmdbid", users.AddToWatchlist)
+	me.DELETE("/watchlist/:tmdbid", users.RemoveFromWatchlist)
+	me.GET("/diary", users.GetDiary)
+	me.POST("/diary", users.AddDiaryEntry)
+	me.PUT("/diary/:id", users.UpdateDiaryEntry)
+	me.DELETE("/diary/:id", users.DeleteDiaryEntry)
+	me.GET("/taste-match", users.GetMyTasteMatch)
+	me.GET("/lists", users.GetMyLists)
+	me.POST("/lists", users.CreateList)
+	me.PATCH("/lists/:slug", users.UpdateList)
+	me.DELETE("/lists/:slug", users.DeleteList)
+	me.PUT("/lists/:slug/order", users.ReorderList)
+	me.PUT("/lists/:slug/entries/:tmdbid", users.PutListEntry)
+	me.DELETE("/lists/:slug/entries/:tmdbid", users.DeleteListEntry)
+
+	router.GET("/users/:id/taste-match", auth.RequireUser, users.GetUserTasteMatch)
+	router.GET("/lists/:slug", auth.OptionalUser, users.GetList)
+	router.POST("/lists/:slug/clone", auth.RequireUser, users.CloneList)
+
+	router.POST("/games", auth.OptionalUser, games.StartGame)
+	router.GET("/games/leaderboard", games.GetLeaderboard)
+	router.GET("/games/:id", auth.OptionalUser, games.GetGame)
+	router.POST("/games/:id/answer", auth.OptionalUser, games.AnswerGame)
+
+	router.GET("/tournaments", tournaments.ListTournaments)
+	router.POST("/tournaments", auth.RequireUser, tournaments.CreateTournament)
+	router.GET("/tournaments/:id", auth.OptionalUser, tournaments.GetTournament)
+	router.GET("/tournaments/:id/results", tournaments.GetResults)
+	router.POST("/tournaments/:id/votes", auth.RequireUser, tournaments.Vote)
+	router.POST("/tournaments/:id/advance", auth.RequireUser, tournaments.AdvanceTournament)
+
+	router.NoRoute(func(c *gin.Context) {
+		problem.NotFound(c, "Route doesn't exist")
+	})
 
 	// Run the Gin server
 	router.Run() // Default port is 8080
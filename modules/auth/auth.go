@@ -1,11 +1,294 @@
 package auth
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// How long a login stays valid
+const sessionLifetime = 30 * 24 * time.Hour
+
+// Context key holding the logged-in user
+const userKey = "user"
+
+// Bounds on usernames and passwords
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72 // bcrypt ignores anything longer
+	maxUsernameLength = 32
+)
+
+/*
+Creates the indexes auth relies on: unique usernames and expiry of old
+sessions.
+*/
+func EnsureIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "username", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection("sessions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Checks a register or login body, returning every invalid field
+func readCredentials(c *gin.Context) (credentials, bool) {
+	var body credentials
+	if err := c.ShouldBindJSON(&body); err != nil {
+		problem.BadRequest(c, "body", "Body must be JSON with username and password")
+		return body, false
+	}
+	body.Username = strings.TrimSpace(body.Username)
+
+	var errs []problem.FieldError
+	if body.Username == "" || len(body.Username) > maxUsernameLength {
+		errs = append(errs, problem.FieldError{Field: "username", Detail: "username must be 1 to 32 characters"})
+	}
+	if len(body.Password) < minPasswordLength || len(body.Password) > maxPasswordLength {
+		errs = append(errs, problem.FieldError{Field: "password", Detail: "password must be 8 to 72 characters"})
+	}
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return body, false
+	}
+	return body, true
+}
+
+// Starts a session for the user and responds with its token
+func startSession(c *gin.Context, db *mongo.Database, user User) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		problem.Error(c, err, "Failed to create session")
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	s := session{TokenHash: hashToken(token), UserID: user.ID, Expires: time.Now().Add(sessionLifetime)}
+	if _, err := db.Collection("sessions").InsertOne(context.TODO(), s); err != nil {
+		problem.Error(c, err, "Failed to create session")
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"token": token, "expires": s.Expires, "user": user})
+}
+
+/*
+Accepts username and password (JSON).
+Creates an account and logs it in.
+*/
+func Register(c *gin.Context) {
+	body, ok := readCredentials(c)
+	if !ok {
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+	if err != nil {
+		problem.Error(c, err, "Failed to create account")
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+
+	user := User{ID: primitive.NewObjectID(), Username: body.Username, PasswordHash: hash, CreatedAt: time.Now()}
+	_, err = db.Collection("users").InsertOne(context.TODO(), user)
+	if mongo.IsDuplicateKeyError(err) {
+		problem.Abort(c, http.StatusConflict, "Username is taken", problem.FieldError{Field: "username", Detail: "username is taken"})
+		return
+	}
+	if err != nil {
+		problem.Error(c, err, "Failed to create account")
+		return
+	}
+
+	startSession(c, db, user)
+}
+
+/*
+Accepts username and password (JSON).
+Returns a bearer token for the Authorization header.
+*/
 func Login(c *gin.Context) {
-	c.IndentedJSON(http.StatusNotFound, gin.H{"error": "Route doesn't exist"})
+	body, ok := readCredentials(c)
+	if !ok {
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+
+	var user User
+	err := db.Collection("users").FindOne(context.TODO(), bson.M{"username": body.Username}).Decode(&user)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		problem.Error(c, err, "Failed to log in")
+		return
+	}
+	if err != nil || bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(body.Password)) != nil {
+		problem.Abort(c, http.StatusUnauthorized, "Wrong username or password")
+		return
+	}
+
+	startSession(c, db, user)
+}
+
+// Ends the session of the token in the request
+func Logout(c *gin.Context) {
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	sessions := client.Database("jdmovies").Collection("sessions")
+
+	token := bearerToken(c)
+	if _, err := sessions.DeleteOne(context.TODO(), bson.M{"_id": hashToken(token)}); err != nil {
+		problem.Error(c, err, "Failed to log out")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Returns the logged-in user
+func GetMe(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, MustUser(c))
+}
+
+/*
+Accepts publicRatings (JSON).
+Updates the logged-in user's settings and returns the account.
+*/
+func UpdateMe(c *gin.Context) {
+	var body struct {
+		PublicRatings *bool `json:"publicRatings"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.PublicRatings == nil {
+		problem.BadRequest(c, "body", "Body must be JSON with publicRatings")
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	user := MustUser(c)
+
+	_, err := client.Database("jdmovies").Collection("users").UpdateOne(c.Request.Context(),
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"publicRatings": *body.PublicRatings}},
+	)
+	if err != nil {
+		problem.Error(c, err, "Failed to save settings")
+		return
+	}
+	updated := *user
+	updated.PublicRatings = *body.PublicRatings
+	c.IndentedJSON(http.StatusOK, updated)
+}
+
+func bearerToken(c *gin.Context) string {
+	token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !found {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// Looks up the user owning the request's token, if any
+func lookup(c *gin.Context) (*User, error) {
+	token := bearerToken(c)
+	if token == "" {
+		return nil, nil
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+
+	var s session
+	err := db.Collection("sessions").FindOne(context.TODO(), bson.M{"_id": hashToken(token), "expires": bson.M{"$gt": time.Now()}}).Decode(&s)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var user User
+	err = db.Collection("users").FindOne(context.TODO(), bson.M{"_id": s.UserID}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Middleware that rejects requests without a valid token
+func RequireUser(c *gin.Context) {
+	user, err := lookup(c)
+	if err != nil {
+		problem.Error(c, err, "Failed to check login")
+		return
+	}
+	if user == nil {
+		c.Header("WWW-Authenticate", "Bearer")
+		problem.Abort(c, http.StatusUnauthorized, "Log in to use this route")
+		return
+	}
+	c.Set(userKey, user)
+}
+
+// Middleware that rejects requests from anyone but admins
+func RequireAdmin(c *gin.Context) {
+	RequireUser(c)
+	if c.IsAborted() {
+		return
+	}
+	if !MustUser(c).Admin {
+		problem.Abort(c, http.StatusForbidden, "Only admins can use this route")
+	}
+}
+
+// Middleware that records the user when a valid token is sent, without requiring one
+func OptionalUser(c *gin.Context) {
+	user, err := lookup(c)
+	if err != nil {
+		problem.Error(c, err, "Failed to check login")
+		return
+	}
+	if user != nil {
+		c.Set(userKey, user)
+	}
+}
+
+// The logged-in user, or nil
+func CurrentUser(c *gin.Context) *User {
+	user, _ := c.Get(userKey)
+	u, _ := user.(*User)
+	return u
+}
+
+// The logged-in user on routes behind RequireUser
+func MustUser(c *gin.Context) *User {
+	return c.MustGet(userKey).(*User)
 }
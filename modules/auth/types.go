@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// An account as stored in the users collection
+type User struct {
+	ID           primitive.ObjectID `bson:"_id" json:"id"`
+	Username     string             `bson:"username" json:"username"`
+	PasswordHash []byte             `bson:"passwordHash" json:"-"`
+	Admin        bool               `bson:"admin" json:"admin"`
+	// Whether others may compare their taste with this user's ratings
+	PublicRatings bool      `bson:"publicRatings" json:"publicRatings"`
+	CreatedAt     time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+/*
+	 A login session. Only a hash of the token is stored so a database
+		leak doesn't hand out working tokens.
+*/
+type session struct {
+	TokenHash string             `bson:"_id"`
+	UserID    primitive.ObjectID `bson:"userId"`
+	Expires   time.Time          `bson:"expires"`
+}
+
+// Body of register and login requests
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
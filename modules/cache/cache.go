@@ -0,0 +1,266 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// A cached 200 response for one normalized request
+type entry struct {
+	body        []byte
+	contentType string
+	version     uint64
+	stored      time.Time
+}
+
+/*
+	 Response cache for catalog reads. Every entry belongs to a catalog
+		version; any write bumps the version, which invalidates all
+		entries and changes every ETag at once.
+*/
+type Store struct {
+	mu         sync.RWMutex
+	boot       string
+	version    uint64
+	entries    map[string]entry
+	maxAge     time.Duration
+	ttl        time.Duration
+	maxEntries int
+}
+
+/*
+Creates a cache. maxAge is sent to clients in Cache-Control, ttl bounds
+how long an entry is served without a detected write, and maxEntries
+caps memory use.
+*/
+func New(maxAge time.Duration, ttl time.Duration, maxEntries int) *Store {
+	// The boot id keeps ETags from one process from matching another's
+	buf := make([]byte, 4)
+	rand.Read(buf)
+
+	return &Store{
+		boot:       hex.EncodeToString(buf),
+		entries:    make(map[string]entry),
+		maxAge:     maxAge,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+	}
+}
+
+func (s *Store) Version() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.version
+}
+
+// Bumps the catalog version and drops every cached response
+func (s *Store) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version++
+	s.entries = make(map[string]entry)
+}
+
+/*
+Builds the cache key from the path and the query parameters, sorted by
+name and value so equivalent requests share an entry.
+*/
+func normalize(path string, query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(path)
+	for i, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for j, v := range values {
+			if i == 0 && j == 0 {
+				b.WriteByte('?')
+			} else {
+				b.WriteByte('&')
+			}
+			b.WriteString(url.QueryEscape(k))
+			b.WriteByte('=')
+			b.WriteString(url.QueryEscape(v))
+		}
+	}
+	return b.String()
+}
+
+// Context key marking a response that must not be cached
+const skipKey = "cache.skip"
+
+/*
+Keeps the current response out of the cache, e.g. when it is incomplete.
+Must be called before the handler writes its response.
+*/
+func Skip(c *gin.Context) {
+	c.Set(skipKey, true)
+}
+
+// Strong ETag for a key at a catalog version
+func (s *Store) etag(key string, version uint64) string {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return fmt.Sprintf(`"%s-%d-%x"`, s.boot, version, h.Sum64())
+}
+
+/*
+Reports whether an If-None-Match header matches the ETag. Uses the weak
+comparison RFC 7232 prescribes for If-None-Match.
+*/
+func matches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Captures the body written by a handler and adds the caching headers once
+the handler settles on a 200.
+*/
+type recorder struct {
+	gin.ResponseWriter
+	context      *gin.Context
+	body         bytes.Buffer
+	etag         string
+	cacheControl string
+}
+
+func (w *recorder) WriteHeader(code int) {
+	if code == http.StatusOK && !w.context.GetBool(skipKey) {
+		w.Header().Set("ETag", w.etag)
+		w.Header().Set("Cache-Control", w.cacheControl)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recorder) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+/*
+Middleware for cacheable GET routes. Answers If-None-Match with 304,
+serves stored responses for the current catalog version and stores
+successful responses otherwise.
+*/
+func (s *Store) Handler() gin.HandlerFunc {
+	cacheControl := fmt.Sprintf("public, max-age=%d, must-revalidate", int(s.maxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		key := normalize(c.Request.URL.Path, c.Request.URL.Query())
+
+		s.mu.RLock()
+		version := s.version
+		cached, found := s.entries[key]
+		s.mu.RUnlock()
+
+		if found && time.Since(cached.stored) > s.ttl {
+			found = false
+		}
+
+		etag := s.etag(key, version)
+		if found && matches(c.GetHeader("If-None-Match"), etag) {
+			c.Header("ETag", etag)
+			c.Header("Cache-Control", cacheControl)
+			c.AbortWithStatus(http.StatusNotModified)
+			return
+		}
+
+		if found {
+			c.Header("ETag", etag)
+			c.Header("Cache-Control", cacheControl)
+			c.Header("X-Cache", "HIT")
+			c.Data(http.StatusOK, cached.contentType, cached.body)
+			c.Abort()
+			return
+		}
+
+		w := &recorder{ResponseWriter: c.Writer, context: c, etag: etag, cacheControl: cacheControl}
+		c.Writer = w
+		c.Header("X-Cache", "MISS")
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.Status() != http.StatusOK || c.GetBool(skipKey) {
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// A write during the request means the body may predate it
+		if s.version != version {
+			return
+		}
+		if len(s.entries) >= s.maxEntries {
+			s.entries = make(map[string]entry)
+		}
+		s.entries[key] = entry{
+			body:        w.body.Bytes(),
+			contentType: w.Header().Get("Content-Type"),
+			version:     version,
+			stored:      time.Now(),
+		}
+	}
+}
+
+// Middleware for routes that modify the catalog
+func (s *Store) InvalidateOnWrite() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.Writer.Status() < http.StatusBadRequest {
+			s.Invalidate()
+		}
+	}
+}
+
+/*
+Invalidates the cache whenever one of the collections changes, including
+writes made outside the API. Blocks until ctx is done; when change
+streams are unavailable the ttl is the only bound on staleness.
+*/
+func (s *Store) Watch(ctx context.Context, db *mongo.Database, collections ...string) {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{"ns.coll": bson.M{"$in": collections}}}}}
+	stream, err := db.Watch(ctx, pipeline)
+	if err != nil {
+		log.Printf("cache: change stream unavailable, relying on ttl: %v", err)
+		return
+	}
+	defer stream.Close(context.TODO())
+
+	for stream.Next(ctx) {
+		s.Invalidate()
+	}
+	if err := stream.Err(); err != nil && ctx.Err() == nil {
+		log.Printf("cache: change stream stopped: %v", err)
+	}
+}
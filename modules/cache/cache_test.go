@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A router serving /movies through the cache, counting handler runs
+func cachedRouter(s *Store, status *int, calls *int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/movies", s.Handler(), func(c *gin.Context) {
+		*calls++
+		if c.Query("partial") == "true" {
+			Skip(c)
+		}
+		if c.Query("write") == "true" {
+			s.Invalidate()
+		}
+		c.JSON(*status, gin.H{"calls": *calls})
+	})
+	router.PUT("/movies", s.InvalidateOnWrite(), func(c *gin.Context) {
+		c.Status(*status)
+	})
+	return router
+}
+
+func serve(router *gin.Engine, method string, target string, ifNoneMatch string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, target, nil)
+	if ifNoneMatch != "" {
+		r.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestHandlerCachesAndRevalidates(t *testing.T) {
+	status, calls := http.StatusOK, 0
+	router := cachedRouter(New(time.Minute, time.Hour, 10), &status, &calls)
+
+	first := serve(router, http.MethodGet, "/movies?genre=Horror&year=1984", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || first.Header().Get("X-Cache") != "MISS" || etag == "" {
+		t.Fatalf("first request: got %d, X-Cache %q, ETag %q", first.Code, first.Header().Get("X-Cache"), etag)
+	}
+	if got := first.Header().Get("Cache-Control"); got != "public, max-age=60, must-revalidate" {
+		t.Errorf("got Cache-Control %q", got)
+	}
+
+	// Parameters in another order share the entry
+	second := serve(router, http.MethodGet, "/movies?year=1984&genre=Horror", "")
+	if second.Header().Get("X-Cache") != "HIT" || second.Body.String() != first.Body.String() || calls != 1 {
+		t.Errorf("second request: X-Cache %q, body %s after %d calls", second.Header().Get("X-Cache"), second.Body, calls)
+	}
+	if second.Header().Get("ETag") != etag {
+		t.Errorf("ETag changed from %s to %s", etag, second.Header().Get("ETag"))
+	}
+
+	for _, header := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		w := serve(router, http.MethodGet, "/movies?genre=Horror&year=1984", header)
+		if w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("ETag") != etag {
+			t.Errorf("If-None-Match %s: got %d with %d bytes", header, w.Code, w.Body.Len())
+		}
+	}
+	if w := serve(router, http.MethodGet, "/movies?genre=Horror&year=1984", `"other"`); w.Code != http.StatusOK {
+		t.Errorf("a stale ETag got %d, want 200", w.Code)
+	}
+	if w := serve(router, http.MethodGet, "/movies?genre=Comedy", etag); w.Code != http.StatusOK {
+		t.Errorf("another query's ETag got %d, want 200", w.Code)
+	}
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want 2", calls)
+	}
+}
+
+func TestHandlerInvalidation(t *testing.T) {
+	status, calls := http.StatusOK, 0
+	s := New(time.Minute, time.Hour, 10)
+	router := cachedRouter(s, &status, &calls)
+
+	etag := serve(router, http.MethodGet, "/movies", "").Header().Get("ETag")
+
+	// A failed write leaves the cache alone
+	status = http.StatusBadRequest
+	serve(router, http.MethodPut, "/movies", "")
+	status = http.StatusOK
+	if w := serve(router, http.MethodGet, "/movies", etag); w.Code != http.StatusNotModified {
+		t.Fatalf("after a failed write: got %d, want 304", w.Code)
+	}
+
+	serve(router, http.MethodPut, "/movies", "")
+	if s.Version() != 1 {
+		t.Errorf("got version %d after a write, want 1", s.Version())
+	}
+	w := serve(router, http.MethodGet, "/movies", etag)
+	if w.Code != http.StatusOK || w.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("after a write: got %d, X-Cache %q, want a fresh 200", w.Code, w.Header().Get("X-Cache"))
+	}
+	if w.Header().Get("ETag") == etag {
+		t.Errorf("ETag %s didn't change with the version", etag)
+	}
+
+	s.Invalidate()
+	if w := serve(router, http.MethodGet, "/movies", ""); w.Header().Get("X-Cache") != "MISS" || calls != 3 {
+		t.Errorf("after Invalidate: X-Cache %q after %d calls", w.Header().Get("X-Cache"), calls)
+	}
+}
+
+func TestHandlerSkipsResponses(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		status int
+	}{
+		{"skipped", "/movies?partial=true", http.StatusOK},
+		{"errors", "/movies", http.StatusInternalServerError},
+		{"written during a write", "/movies?write=true", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, calls := tt.status, 0
+			router := cachedRouter(New(time.Minute, time.Hour, 10), &status, &calls)
+			first := serve(router, http.MethodGet, tt.target, "")
+			serve(router, http.MethodGet, tt.target, "")
+			if calls != 2 {
+				t.Errorf("handler ran %d times, want 2", calls)
+			}
+			if tt.name != "written during a write" && first.Header().Get("ETag") != "" {
+				t.Errorf("uncacheable response has ETag %s", first.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestHandlerLimits(t *testing.T) {
+	status, calls := http.StatusOK, 0
+	router := cachedRouter(New(time.Minute, time.Nanosecond, 10), &status, &calls)
+	serve(router, http.MethodGet, "/movies", "")
+	time.Sleep(time.Millisecond)
+	if w := serve(router, http.MethodGet, "/movies", ""); w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("expired entry: got X-Cache %q", w.Header().Get("X-Cache"))
+	}
+
+	// A full cache starts over
+	s := New(time.Minute, time.Hour, 2)
+	router = cachedRouter(s, &status, &calls)
+	for _, target := range []string{"/movies?a=1", "/movies?a=2", "/movies?a=3"} {
+		serve(router, http.MethodGet, target, "")
+	}
+	if len(s.entries) != 1 {
+		t.Errorf("got %d entries, want 1", len(s.entries))
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "/movies"},
+		{"b=2&a=1", "/movies?a=1&b=2"},
+		{"genre=Horror&genre=Comedy", "/movies?genre=Comedy&genre=Horror"},
+		{"q=a+b&q=%26", "/movies?q=%26&q=a+b"},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		if got := normalize("/movies", query); got != tt.want {
+			t.Errorf("normalize(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	etag := `"abc-1-ff"`
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`"abc-1-ff"`, true},
+		{`W/"abc-1-ff"`, true},
+		{`"x", "abc-1-ff"`, true},
+		{"*", true},
+		{`"abc-2-ff"`, false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := matches(tt.header, etag); got != tt.want {
+			t.Errorf("matches(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,588 @@
+package games
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"hash/fnv"
+	mathrand "math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/auth"
+	"github.com/helfy18/movie-site-api/modules/movies"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Game modes
+const (
+	higherLower = "higher-lower"
+	guessScore  = "guess-score"
+)
+
+const (
+	// Questions in a daily game, and in every guess-score game
+	fixedRounds      = 10
+	defaultTolerance = 5
+	// Draws tried to find a movie whose score differs from the one it is compared with
+	tieRetries = 20
+)
+
+/*
+Creates the indexes games rely on: one daily game per user and mode, and
+leaderboard lookups.
+*/
+func EnsureIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("games").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}, {Key: "mode", Value: 1}, {Key: "daily", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+				"userId": bson.M{"$exists": true},
+				"daily":  bson.M{"$exists": true},
+			}),
+		},
+		{Keys: bson.D{{Key: "mode", Value: 1}, {Key: "over", Value: 1}, {Key: "score", Value: -1}}},
+	})
+	return err
+}
+
+// The fields of a movie questions show and answers are checked against
+var questionProjection = bson.M{"Movie": 1, "Year": 1, "TMDBId": 1, "JH_Score": 1, "Genre": 1, "Genre_2": 1, "Runtime": 1, "Rated": 1, "Poster": 1}
+
+/*
+Every movie that can be asked about, by tmdbid, with the ids in order.
+Only a new daily game needs them all, to draw the day's sequence.
+*/
+func loadCatalog(ctx context.Context, db *mongo.Database) (map[int32]movies.Movie, []int32, error) {
+	found, err := movies.FindMovies(ctx, db.Collection("movies"), bson.M{}, options.Find().SetProjection(questionProjection).SetSort(bson.M{"TMDBId": 1}))
+	if err != nil {
+		return nil, nil, err
+	}
+	byId := make(map[int32]movies.Movie, len(found))
+	ids := make([]int32, len(found))
+	for i, m := range found {
+		byId[m.TMDBId] = m
+		ids[i] = m.TMDBId
+	}
+	return byId, ids, nil
+}
+
+// The movies with the tmdbids, by tmdbid
+func loadMovies(ctx context.Context, db *mongo.Database, ids []int32) (map[int32]movies.Movie, error) {
+	query := bson.M{"TMDBId": bson.M{"$in": append([]int32{}, ids...)}}
+	found, err := movies.FindMovies(ctx, db.Collection("movies"), query, options.Find().SetProjection(questionProjection))
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[int32]movies.Movie, len(found))
+	for _, m := range found {
+		byId[m.TMDBId] = m
+	}
+	return byId, nil
+}
+
+/*
+Draws a random movie from the collection that isn't in seen, preferring
+one whose score differs from compared's. Returns false once every movie
+has been seen.
+*/
+func drawMovie(ctx context.Context, db *mongo.Database, seen []int32, compared *movies.Movie) (movies.Movie, bool, error) {
+	match := bson.M{"TMDBId": bson.M{"$nin": append([]int32{}, seen...)}}
+	if compared != nil {
+		match["JH_Score"] = bson.M{"$ne": compared.JH_Score}
+	}
+	for {
+		cursor, err := db.Collection("movies").Aggregate(ctx, mongo.Pipeline{
+			{{Key: "$match", Value: match}},
+			{{Key: "$sample", Value: bson.M{"size": 1}}},
+			{{Key: "$project", Value: questionProjection}},
+		})
+		if err != nil {
+			return movies.Movie{}, false, err
+		}
+		var found []movies.Movie
+		if err := cursor.All(ctx, &found); err != nil {
+			return movies.Movie{}, false, err
+		}
+		if len(found) > 0 {
+			return found[0], true, nil
+		}
+		if _, tieFree := match["JH_Score"]; !tieFree {
+			return movies.Movie{}, false, nil
+		}
+		// Only ties are left
+		delete(match, "JH_Score")
+	}
+}
+
+/*
+Draws a movie of a daily sequence from the catalog. When compared is set,
+a movie with a different score is preferred so higher-or-lower questions
+have an answer. Returns false once every movie has been seen.
+*/
+func draw(rng *mathrand.Rand, catalog map[int32]movies.Movie, ids []int32, seen map[int32]bool, compared *movies.Movie) (int32, bool) {
+	if len(seen) >= len(ids) {
+		return 0, false
+	}
+	var fallback int32
+	for attempt := 0; ; attempt++ {
+		id := ids[rng.IntN(len(ids))]
+		if seen[id] {
+			continue
+		}
+		if compared == nil || catalog[id].JH_Score != compared.JH_Score {
+			return id, true
+		}
+		fallback = id
+		if attempt >= tieRetries {
+			return fallback, true
+		}
+	}
+}
+
+// Random source for a day's puzzle, the same for everyone
+func dailyRand(date string, mode string) *mathrand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(date + "|" + mode))
+	seed := h.Sum64()
+	return mathrand.New(mathrand.NewPCG(seed, seed>>1^0x9e3779b97f4a7c15))
+}
+
+// Movies of a daily game in the order they are asked about
+func dailySequence(date string, mode string, catalog map[int32]movies.Movie, ids []int32) []int32 {
+	rng := dailyRand(date, mode)
+	length := fixedRounds
+	if mode == higherLower {
+		length++
+	}
+
+	sequence := []int32{}
+	seen := make(map[int32]bool)
+	for len(sequence) < length {
+		var compared *movies.Movie
+		if mode == higherLower && len(sequence) > 0 {
+			m := catalog[sequence[len(sequence)-1]]
+			compared = &m
+		}
+		id, ok := draw(rng, catalog, ids, seen, compared)
+		if !ok {
+			break
+		}
+		seen[id] = true
+		sequence = append(sequence, id)
+	}
+	return sequence
+}
+
+/*
+The next movie of the game, from its daily sequence or drawn at random,
+added to known. Known must hold the movies of the current question.
+Returns false when there are none left.
+*/
+func nextMovie(ctx context.Context, db *mongo.Database, g *game, known map[int32]movies.Movie) (int32, bool, error) {
+	if g.Sequence != nil {
+		if len(g.Seen) >= len(g.Sequence) {
+			return 0, false, nil
+		}
+		id := g.Sequence[len(g.Seen)]
+		if _, loaded := known[id]; !loaded {
+			found, err := loadMovies(ctx, db, []int32{id})
+			if err != nil {
+				return 0, false, err
+			}
+			known[id] = found[id]
+		}
+		return id, true, nil
+	}
+
+	var compared *movies.Movie
+	if g.Mode == higherLower && len(g.Current) > 0 {
+		m := known[g.Current[len(g.Current)-1]]
+		compared = &m
+	}
+	m, ok, err := drawMovie(ctx, db, g.Seen, compared)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	known[m.TMDBId] = m
+	return m.TMDBId, true, nil
+}
+
+/*
+Moves the game to its next question, ending it when movies run out. The
+new question's movie is added to known.
+*/
+func advance(ctx context.Context, db *mongo.Database, g *game, known map[int32]movies.Movie) error {
+	if g.Rounds > 0 && g.Round >= g.Rounds {
+		g.Over = true
+		return nil
+	}
+	id, ok, err := nextMovie(ctx, db, g, known)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		g.Over = true
+		return nil
+	}
+	g.Seen = append(g.Seen, id)
+	if g.Mode == higherLower {
+		// The movie just revealed stays on as the one to beat
+		g.Current = []int32{g.Current[len(g.Current)-1], id}
+	} else {
+		g.Current = []int32{id}
+	}
+	return nil
+}
+
+// The game's state with its current question, which never includes scores
+func respondWithGame(c *gin.Context, status int, g game, known map[int32]movies.Movie, extra gin.H) {
+	response := gin.H{"game": g}
+	if !g.Over {
+		question := []questionCard{}
+		for _, id := range g.Current {
+			question = append(question, questionCardOf(known[id]))
+		}
+		response["question"] = question
+	}
+	for k, v := range extra {
+		response[k] = v
+	}
+	c.IndentedJSON(status, response)
+}
+
+/*
+Finds the game in the path. Games started by a logged-in user can only
+be seen and played by that user.
+*/
+func findGame(c *gin.Context, db *mongo.Database) (game, bool) {
+	var g game
+	err := db.Collection("games").FindOne(c.Request.Context(), bson.M{"_id": c.Param("id")}).Decode(&g)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		problem.Error(c, err, "Failed to fetch game")
+		return g, false
+	}
+	user := auth.CurrentUser(c)
+	if err != nil || (g.UserID != nil && (user == nil || user.ID != *g.UserID)) {
+		problem.NotFound(c, "No game has this id")
+		return g, false
+	}
+	return g, true
+}
+
+/*
+Accepts mode (higher-lower or guess-score), daily (true for the day's
+fixed puzzle) and tolerance (points a guessed score may be off by,
+default 5) as JSON.
+Starts a game and returns its first question. Logged-in users' games go
+on the leaderboards, and each user gets one daily game per mode; asking
+again returns it.
+*/
+func StartGame(c *gin.Context) {
+	var body struct {
+		Mode      string `json:"mode"`
+		Daily     bool   `json:"daily"`
+		Tolerance *int32 `json:"tolerance"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		problem.BadRequest(c, "body", "Body must be JSON with a mode")
+		return
+	}
+	var errs []problem.FieldError
+	if body.Mode != higherLower && body.Mode != guessScore {
+		errs = append(errs, problem.FieldError{Field: "mode", Detail: "mode must be higher-lower or guess-score"})
+	}
+	tolerance := int32(defaultTolerance)
+	if body.Tolerance != nil {
+		tolerance = *body.Tolerance
+		if tolerance < 0 || tolerance > 50 {
+			errs = append(errs, problem.FieldError{Field: "tolerance", Detail: "tolerance must be an integer from 0 to 50"})
+		}
+	}
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	ctx := c.Request.Context()
+	games := db.Collection("games")
+
+	count, err := db.Collection("movies").CountDocuments(ctx, bson.M{}, options.Count().SetLimit(2))
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+	if count < 2 {
+		problem.NotFound(c, "Not enough movies to play")
+		return
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		problem.Error(c, err, "Failed to start game")
+		return
+	}
+	now := time.Now()
+	g := game{
+		ID:        base64.RawURLEncoding.EncodeToString(buf),
+		Mode:      body.Mode,
+		Seen:      []int32{},
+		Current:   []int32{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if body.Mode == guessScore {
+		g.Tolerance = tolerance
+		g.Rounds = fixedRounds
+	}
+	if user := auth.CurrentUser(c); user != nil {
+		g.UserID = &user.ID
+		g.Username = user.Username
+	}
+	known := make(map[int32]movies.Movie)
+	if body.Daily {
+		catalog, ids, err := loadCatalog(ctx, db)
+		if err != nil {
+			problem.Error(c, err, "Failed to fetch movies")
+			return
+		}
+		g.Daily = now.UTC().Format(time.DateOnly)
+		g.Rounds = fixedRounds
+		g.Sequence = dailySequence(g.Daily, g.Mode, catalog, ids)
+		known = catalog
+	}
+
+	// Higher-or-lower starts with a movie to compare against
+	if g.Mode == higherLower {
+		first, _, err := nextMovie(ctx, db, &g, known)
+		if err != nil {
+			problem.Error(c, err, "Failed to fetch movies")
+			return
+		}
+		g.Seen = append(g.Seen, first)
+		g.Current = []int32{first}
+	}
+	if err := advance(ctx, db, &g, known); err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+
+	_, err = games.InsertOne(ctx, g)
+	if mongo.IsDuplicateKeyError(err) {
+		// The user already started today's puzzle, whose movies are all known
+		err = games.FindOne(ctx, bson.M{"userId": g.UserID, "mode": g.Mode, "daily": g.Daily}).Decode(&g)
+		if err != nil {
+			problem.Error(c, err, "Failed to fetch game")
+			return
+		}
+		respondWithGame(c, http.StatusOK, g, known, nil)
+		return
+	}
+	if err != nil {
+		problem.Error(c, err, "Failed to start game")
+		return
+	}
+	respondWithGame(c, http.StatusCreated, g, known, nil)
+}
+
+// Returns the game in the path with its current question
+func GetGame(c *gin.Context) {
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+
+	g, ok := findGame(c, db)
+	if !ok {
+		return
+	}
+	current, err := loadMovies(c.Request.Context(), db, g.Current)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+	respondWithGame(c, http.StatusOK, g, current, nil)
+}
+
+/*
+Checks an answer to the game's current question, whose movies must be in
+known, and scores it. A higher-or-lower pick is right when its JH_Score
+is at least the other's, so ties count either way, and a wrong one ends
+the game. A guessed score earns 100 minus how far off it was and is
+right within the tolerance. The game is left unchanged when the answer
+doesn't fit the question.
+*/
+func scoreAnswer(g *game, known map[int32]movies.Movie, pick *int32, score *int32) (bool, []problem.FieldError) {
+	var correct bool
+	switch g.Mode {
+	case higherLower:
+		a, b := known[g.Current[0]], known[g.Current[1]]
+		if pick == nil || (*pick != a.TMDBId && *pick != b.TMDBId) {
+			return false, []problem.FieldError{{Field: "pick", Detail: "pick must be the tmdbid of one of the two movies"}}
+		}
+		picked, other := a, b
+		if *pick == b.TMDBId {
+			picked, other = b, a
+		}
+		correct = picked.JH_Score >= other.JH_Score
+		if correct {
+			g.Score++
+		}
+	case guessScore:
+		if score == nil || *score < 0 || *score > 100 {
+			return false, []problem.FieldError{{Field: "score", Detail: "score must be an integer from 0 to 100"}}
+		}
+		off := *score - known[g.Current[0]].JH_Score
+		if off < 0 {
+			off = -off
+		}
+		correct = off <= g.Tolerance
+		g.Score += int(100 - off)
+	}
+
+	g.Round++
+	if correct {
+		g.Streak++
+		g.BestStreak = max(g.BestStreak, g.Streak)
+	} else {
+		g.Streak = 0
+	}
+	if !correct && g.Mode == higherLower {
+		g.Over = true
+	}
+	return correct, nil
+}
+
+/*
+Accepts id (path) and pick (the tmdbid with the higher JH_Score) or score
+(the guessed JH_Score) as JSON.
+Checks the answer, reveals the scores of the question and returns the
+next one. A wrong pick ends higher-or-lower; guess-score scores 100 minus
+how far off the guess was and counts guesses within the tolerance
+towards the streak.
+*/
+func AnswerGame(c *gin.Context) {
+	var body struct {
+		Pick  *int32 `json:"pick"`
+		Score *int32 `json:"score"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		problem.BadRequest(c, "body", "Body must be JSON with a pick or score")
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	ctx := c.Request.Context()
+
+	g, ok := findGame(c, db)
+	if !ok {
+		return
+	}
+	if g.Over {
+		problem.Abort(c, http.StatusConflict, "This game is over")
+		return
+	}
+	known, err := loadMovies(ctx, db, g.Current)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+
+	revealed := gin.H{}
+	for _, id := range g.Current {
+		revealed[strconv.Itoa(int(id))] = known[id].JH_Score
+	}
+	answered := g.Round
+	correct, errs := scoreAnswer(&g, known, body.Pick, body.Score)
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+	if !g.Over {
+		if err := advance(ctx, db, &g, known); err != nil {
+			problem.Error(c, err, "Failed to fetch movies")
+			return
+		}
+	}
+	g.UpdatedAt = time.Now()
+
+	// Only the first answer to a question counts
+	result, err := db.Collection("games").ReplaceOne(ctx, bson.M{"_id": g.ID, "round": answered}, g)
+	if err != nil {
+		problem.Error(c, err, "Failed to save game")
+		return
+	}
+	if result.MatchedCount == 0 {
+		problem.Abort(c, http.StatusConflict, "This question was already answered")
+		return
+	}
+	respondWithGame(c, http.StatusOK, g, known, gin.H{"correct": correct, "scores": revealed})
+}
+
+/*
+Accepts mode, daily (a date, "today", or left out for every game) and
+limit (default 20).
+Returns the best finished games of logged-in users.
+*/
+func GetLeaderboard(c *gin.Context) {
+	var errs []problem.FieldError
+	mode := c.Query("mode")
+	if mode != higherLower && mode != guessScore {
+		errs = append(errs, problem.FieldError{Field: "mode", Detail: "mode must be higher-lower or guess-score"})
+	}
+	daily := c.Query("daily")
+	if daily == "today" {
+		daily = time.Now().UTC().Format(time.DateOnly)
+	} else if _, err := time.Parse(time.DateOnly, daily); daily != "" && err != nil {
+		errs = append(errs, problem.FieldError{Field: "daily", Detail: "daily must be today or a date such as 2024-12-25"})
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		errs = append(errs, problem.FieldError{Field: "limit", Detail: "limit must be an integer from 1 to 100"})
+	}
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	collection := client.Database("jdmovies").Collection("games")
+	ctx := c.Request.Context()
+
+	query := bson.M{"mode": mode, "over": true, "userId": bson.M{"$exists": true}}
+	if daily != "" {
+		query["daily"] = daily
+	}
+	sorting := bson.D{{Key: "score", Value: -1}, {Key: "bestStreak", Value: -1}, {Key: "updatedAt", Value: 1}}
+	cursor, err := collection.Find(ctx, query, options.Find().SetSort(sorting).SetLimit(int64(limit)))
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch leaderboard")
+		return
+	}
+	var finished []game
+	if err := cursor.All(ctx, &finished); err != nil {
+		problem.Error(c, err, "Failed to fetch leaderboard")
+		return
+	}
+
+	entries := []leaderboardEntry{}
+	for i, g := range finished {
+		entries = append(entries, leaderboardEntry{
+			Rank:       i + 1,
+			Username:   g.Username,
+			Score:      g.Score,
+			BestStreak: g.BestStreak,
+			Round:      g.Round,
+			Daily:      g.Daily,
+			FinishedAt: g.UpdatedAt,
+		})
+	}
+	c.IndentedJSON(http.StatusOK, entries)
+}
@@ -0,0 +1,248 @@
+package games
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/helfy18/movie-site-api/modules/movies"
+)
+
+// A catalog of count movies from tmdbid 1, scored by score(i)
+func catalogOf(count int, score func(i int) int32) (map[int32]movies.Movie, []int32) {
+	catalog := make(map[int32]movies.Movie, count)
+	ids := make([]int32, count)
+	for i := 0; i < count; i++ {
+		id := int32(i + 1)
+		catalog[id] = movies.Movie{TMDBId: id, JH_Score: score(i)}
+		ids[i] = id
+	}
+	return catalog, ids
+}
+
+func TestDailySequence(t *testing.T) {
+	// Only five different scores, so ties are common
+	catalog, ids := catalogOf(40, func(i int) int32 { return int32(50 + 10*(i%5)) })
+
+	for _, mode := range []string{higherLower, guessScore} {
+		t.Run(mode, func(t *testing.T) {
+			sequence := dailySequence("2024-06-01", mode, catalog, ids)
+			if again := dailySequence("2024-06-01", mode, catalog, ids); !reflect.DeepEqual(sequence, again) {
+				t.Errorf("same day gave %v, then %v", sequence, again)
+			}
+			if other := dailySequence("2024-06-02", mode, catalog, ids); reflect.DeepEqual(sequence, other) {
+				t.Errorf("two days gave the same sequence %v", sequence)
+			}
+
+			want := fixedRounds
+			if mode == higherLower {
+				want++
+			}
+			if len(sequence) != want {
+				t.Errorf("got %d movies, want %d", len(sequence), want)
+			}
+			seen := make(map[int32]bool)
+			for i, id := range sequence {
+				if seen[id] {
+					t.Errorf("movie %d repeats in %v", id, sequence)
+				}
+				seen[id] = true
+				if mode == higherLower && i > 0 && catalog[id].JH_Score == catalog[sequence[i-1]].JH_Score {
+					t.Errorf("movies %d and %d tie at %d", sequence[i-1], id, catalog[id].JH_Score)
+				}
+			}
+		})
+	}
+
+	if a, b := dailySequence("2024-06-01", higherLower, catalog, ids), dailySequence("2024-06-01", guessScore, catalog, ids); reflect.DeepEqual(a[:fixedRounds], b) {
+		t.Errorf("both modes gave the sequence %v", b)
+	}
+}
+
+func TestDailySequenceRunsOut(t *testing.T) {
+	catalog, ids := catalogOf(4, func(i int) int32 { return int32(60 + i) })
+	if sequence := dailySequence("2024-06-01", higherLower, catalog, ids); len(sequence) != 4 {
+		t.Errorf("got %v from four movies, want all four", sequence)
+	}
+
+	// With nothing but ties, a tie is better than stopping early
+	tied, ids := catalogOf(20, func(i int) int32 { return 70 })
+	if sequence := dailySequence("2024-06-01", higherLower, tied, ids); len(sequence) != fixedRounds+1 {
+		t.Errorf("got %d movies from an all-tie catalog, want %d", len(sequence), fixedRounds+1)
+	}
+}
+
+func TestDraw(t *testing.T) {
+	catalog, ids := catalogOf(3, func(i int) int32 { return int32(70 + i) })
+	rng := dailyRand("2024-06-01", guessScore)
+
+	seen := map[int32]bool{1: true, 3: true}
+	if id, ok := draw(rng, catalog, ids, seen, nil); !ok || id != 2 {
+		t.Errorf("got %d, %v, want the only unseen movie 2", id, ok)
+	}
+	seen[2] = true
+	if id, ok := draw(rng, catalog, ids, seen, nil); ok {
+		t.Errorf("got %d with every movie seen", id)
+	}
+
+	// Movie 2 ties with compared, so 3 is drawn
+	compared := movies.Movie{TMDBId: 9, JH_Score: 71}
+	for i := 0; i < 20; i++ {
+		if id, _ := draw(rng, catalog, ids, map[int32]bool{1: true}, &compared); id != 3 {
+			t.Fatalf("got %d, want 3 over the tie", id)
+		}
+	}
+}
+
+func int32Ptr(n int32) *int32 { return &n }
+
+// The parts of a game an answer changes
+type tally struct {
+	Round, Score, Streak, BestStreak int
+	Over                             bool
+}
+
+func TestScoreAnswer(t *testing.T) {
+	known := map[int32]movies.Movie{
+		1: {TMDBId: 1, JH_Score: 80},
+		2: {TMDBId: 2, JH_Score: 65},
+		3: {TMDBId: 3, JH_Score: 80},
+	}
+	pair := func(a, b int32) game {
+		return game{Mode: higherLower, Current: []int32{a, b}, Round: 3, Score: 3, Streak: 3, BestStreak: 4}
+	}
+	guess := func(id int32) game {
+		return game{Mode: guessScore, Tolerance: 5, Current: []int32{id}, Round: 3, Score: 250, Streak: 3, BestStreak: 4}
+	}
+
+	tests := []struct {
+		name    string
+		g       game
+		pick    *int32
+		score   *int32
+		correct bool
+		want    tally
+		field   string
+	}{
+		{
+			name:    "higher",
+			g:       pair(1, 2),
+			pick:    int32Ptr(1),
+			correct: true,
+			want:    tally{Round: 4, Score: 4, Streak: 4, BestStreak: 4},
+		},
+		{
+			name:    "lower ends the game",
+			g:       pair(1, 2),
+			pick:    int32Ptr(2),
+			correct: false,
+			want:    tally{Round: 4, Score: 3, Streak: 0, BestStreak: 4, Over: true},
+		},
+		{
+			name:    "second movie higher",
+			g:       pair(2, 1),
+			pick:    int32Ptr(1),
+			correct: true,
+			want:    tally{Round: 4, Score: 4, Streak: 4, BestStreak: 4},
+		},
+		{
+			name:    "ties count either way",
+			g:       pair(1, 3),
+			pick:    int32Ptr(3),
+			correct: true,
+			want:    tally{Round: 4, Score: 4, Streak: 4, BestStreak: 4},
+		},
+		{
+			name:  "pick of another movie",
+			g:     pair(1, 2),
+			pick:  int32Ptr(3),
+			field: "pick",
+		},
+		{
+			name:  "no pick",
+			g:     pair(1, 2),
+			score: int32Ptr(80),
+			field: "pick",
+		},
+		{
+			name:    "exact guess",
+			g:       guess(1),
+			score:   int32Ptr(80),
+			correct: true,
+			want:    tally{Round: 4, Score: 350, Streak: 4, BestStreak: 4},
+		},
+		{
+			name:    "at the tolerance",
+			g:       guess(1),
+			score:   int32Ptr(75),
+			correct: true,
+			want:    tally{Round: 4, Score: 345, Streak: 4, BestStreak: 4},
+		},
+		{
+			name:    "above at the tolerance",
+			g:       guess(1),
+			score:   int32Ptr(85),
+			correct: true,
+			want:    tally{Round: 4, Score: 345, Streak: 4, BestStreak: 4},
+		},
+		{
+			name:    "just past the tolerance",
+			g:       guess(1),
+			score:   int32Ptr(74),
+			correct: false,
+			want:    tally{Round: 4, Score: 344, Streak: 0, BestStreak: 4},
+		},
+		{
+			name:    "far off keeps playing",
+			g:       guess(2),
+			score:   int32Ptr(0),
+			correct: false,
+			want:    tally{Round: 4, Score: 285, Streak: 0, BestStreak: 4},
+		},
+		{
+			name:  "guess out of range",
+			g:     guess(1),
+			score: int32Ptr(101),
+			field: "score",
+		},
+		{
+			name:  "no guess",
+			g:     guess(1),
+			pick:  int32Ptr(1),
+			field: "score",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := tt.g
+			correct, errs := scoreAnswer(&g, known, tt.pick, tt.score)
+			if tt.field != "" {
+				if len(errs) != 1 || errs[0].Field != tt.field {
+					t.Fatalf("got errors %v, want one on %s", errs, tt.field)
+				}
+				if !reflect.DeepEqual(g, tt.g) {
+					t.Errorf("a rejected answer changed the game to %+v", g)
+				}
+				return
+			}
+			if errs != nil {
+				t.Fatalf("unexpected errors %v", errs)
+			}
+			if correct != tt.correct {
+				t.Errorf("got correct %v, want %v", correct, tt.correct)
+			}
+			got := tally{Round: g.Round, Score: g.Score, Streak: g.Streak, BestStreak: g.BestStreak, Over: g.Over}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// A long enough streak becomes the best one
+func TestScoreAnswerBestStreak(t *testing.T) {
+	g := game{Mode: guessScore, Tolerance: 0, Current: []int32{1}, Streak: 4, BestStreak: 4}
+	known := map[int32]movies.Movie{1: {TMDBId: 1, JH_Score: 50}}
+	if _, errs := scoreAnswer(&g, known, nil, int32Ptr(50)); errs != nil || g.BestStreak != 5 {
+		t.Errorf("got best streak %d and errors %v, want 5", g.BestStreak, errs)
+	}
+}
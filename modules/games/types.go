@@ -0,0 +1,70 @@
+package games
+
+import (
+	"time"
+
+	"github.com/helfy18/movie-site-api/modules/movies"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+	 A game in progress or finished. The movies of the current question and
+		the daily sequence are never sent to clients, only their cards.
+*/
+type game struct {
+	ID       string              `bson:"_id" json:"id"`
+	Mode     string              `bson:"mode" json:"mode"`
+	Daily    string              `bson:"daily,omitempty" json:"daily,omitempty"`
+	UserID   *primitive.ObjectID `bson:"userId,omitempty" json:"-"`
+	Username string              `bson:"username,omitempty" json:"username,omitempty"`
+	// How far off a guessed score can be and still count, for guess-score
+	Tolerance int32 `bson:"tolerance,omitempty" json:"tolerance,omitempty"`
+	// Questions answered so far, and how many the game has (0 for no limit)
+	Round      int       `bson:"round" json:"round"`
+	Rounds     int       `bson:"rounds" json:"rounds"`
+	Score      int       `bson:"score" json:"score"`
+	Streak     int       `bson:"streak" json:"streak"`
+	BestStreak int       `bson:"bestStreak" json:"bestStreak"`
+	Over       bool      `bson:"over" json:"over"`
+	Current    []int32   `bson:"current" json:"-"`
+	Sequence   []int32   `bson:"sequence,omitempty" json:"-"`
+	Seen       []int32   `bson:"seen" json:"-"`
+	CreatedAt  time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt  time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// A movie as shown in a question: a MovieCard without the score to guess
+type questionCard struct {
+	Movie   string `json:"movie"`
+	Year    int32  `json:"year"`
+	TMDBId  int32  `json:"tmdbid"`
+	Genre   string `json:"genre"`
+	Genre_2 string `json:"genre_2"`
+	Runtime int32  `json:"runtime"`
+	Rated   string `json:"rated"`
+	Poster  string `json:"poster"`
+}
+
+func questionCardOf(m movies.Movie) questionCard {
+	return questionCard{
+		Movie:   m.Movie,
+		Year:    m.Year,
+		TMDBId:  m.TMDBId,
+		Genre:   m.Genre,
+		Genre_2: m.Genre_2,
+		Runtime: m.Runtime,
+		Rated:   m.Rated,
+		Poster:  m.Poster,
+	}
+}
+
+// A finished game on a leaderboard
+type leaderboardEntry struct {
+	Rank       int       `json:"rank"`
+	Username   string    `json:"username"`
+	Score      int       `json:"score"`
+	BestStreak int       `json:"bestStreak"`
+	Round      int       `json:"rounds"`
+	Daily      string    `json:"daily,omitempty"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
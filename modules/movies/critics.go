@@ -0,0 +1,255 @@
+package movies
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"github.com/helfy18/movie-site-api/modules/stats"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Largest top accepted by /stats/critics
+const maxHotTakes = 100
+
+/*
+	 An external rating source. field reads the movie's own field for it
+		and ratingSource is its name in the Ratings list. Bare numbers are
+		read as out of scale.
+*/
+type criticSource struct {
+	name         string
+	ratingSource string
+	scale        float64
+	field        func(m Movie) string
+}
+
+var criticSources = []criticSource{
+	{"imdb", "Internet Movie Database", 10, func(m Movie) string { return m.IMDB }},
+	{"rottentomatoes", "Rotten Tomatoes", 100, func(m Movie) string { return m.RottenTomatoes }},
+	{"metacritic", "Metacritic", 100, func(m Movie) string { return m.Metacritic }},
+}
+
+/*
+Converts a rating such as "7.8/10", "93%" or "75/100" to a score out of
+100, matching JH_Score. Bare numbers are read as out of scale.
+*/
+func parseCriticScore(value string, scale float64) (float64, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.EqualFold(value, "N/A") {
+		return 0, false
+	}
+
+	if number, ok := strings.CutSuffix(value, "%"); ok {
+		scale = 100
+		value = number
+	} else if number, outOf, ok := strings.Cut(value, "/"); ok {
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(outOf), 64)
+		if err != nil || parsed <= 0 {
+			return 0, false
+		}
+		scale = parsed
+		value = number
+	}
+
+	score, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || score < 0 || score > scale {
+		return 0, false
+	}
+	return score * 100 / scale, true
+}
+
+// The movie's score from a source, from its own field or else from Ratings
+func (s criticSource) score(m Movie) (float64, bool) {
+	if score, ok := parseCriticScore(s.field(m), s.scale); ok {
+		return score, true
+	}
+	for _, r := range m.Ratings {
+		if strings.EqualFold(r.Source, s.ratingSource) {
+			return parseCriticScore(r.Value, s.scale)
+		}
+	}
+	return 0, false
+}
+
+// How JH_Score relates to one source, or to the consensus of all of them
+type criticAgreement struct {
+	Source string `json:"source"`
+	Count  int    `json:"count"`
+	// Null when there are too few movies or no variation
+	Correlation       *float64 `json:"correlation"`
+	AverageDifference float64  `json:"averageDifference"`
+}
+
+// A movie JH rated far from the critics
+type hotTake struct {
+	Movie      string             `json:"movie"`
+	Year       int32              `json:"year"`
+	TMDBId     int32              `json:"tmdbid"`
+	JH_Score   int32              `json:"jh_score"`
+	Consensus  float64            `json:"consensus"`
+	Difference float64            `json:"difference"`
+	Critics    map[string]float64 `json:"critics"`
+}
+
+// Average gap between JH_Score and the critics within one genre
+type genreBias struct {
+	FieldValue string             `json:"fieldValue"`
+	Count      int                `json:"count"`
+	Bias       float64            `json:"bias"`
+	BySource   map[string]float64 `json:"bySource"`
+}
+
+func agreement(source string, jh []float64, critics []float64) criticAgreement {
+	differences := make([]float64, len(jh))
+	for i := range jh {
+		differences[i] = jh[i] - critics[i]
+	}
+
+	result := criticAgreement{
+		Source:            source,
+		Count:             len(jh),
+		AverageDifference: stats.Round(stats.Mean(differences)),
+	}
+	if r, ok := stats.Pearson(jh, critics); ok {
+		r = stats.Round(r)
+		result.Correlation = &r
+	}
+	return result
+}
+
+/*
+Accepts the ListMovies filters and top (hot takes per side, default 10).
+Returns how JH_Score correlates with IMDb, Rotten Tomatoes, Metacritic
+and their consensus (the average of those available, out of 100), the
+movies rated furthest above and below the consensus, and the average
+gap per genre. Differences are JH_Score minus the critics.
+*/
+func GetCriticStats(c *gin.Context) {
+	f, errs := ParseFilter(c)
+
+	top, err := strconv.Atoi(c.DefaultQuery("top", "10"))
+	if err != nil || top < 0 || top > maxHotTakes {
+		errs = append(errs, problem.FieldError{Field: "top", Detail: "top must be an integer from 0 to 100"})
+	}
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	collection := client.Database("jdmovies").Collection("movies")
+
+	projection := bson.M{"Movie": 1, "Year": 1, "TMDBId": 1, "JH_Score": 1, "Genre": 1, "Genre_2": 1, "Ratings": 1, "IMDB": 1, "RottenTomatoes": 1, "Metacritic": 1}
+	movies, err := FindMovies(c.Request.Context(), collection, f.Query(), options.Find().SetProjection(projection))
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+
+	jhBySource := make(map[string][]float64)
+	criticBySource := make(map[string][]float64)
+	var jhScores, consensusScores []float64
+	var takes []hotTake
+
+	type genreGap struct {
+		differences []float64
+		bySource    map[string][]float64
+	}
+	genres := make(map[string]*genreGap)
+
+	for _, m := range movies {
+		jh := float64(m.JH_Score)
+		critics := make(map[string]float64)
+		for _, s := range criticSources {
+			if score, ok := s.score(m); ok {
+				critics[s.name] = stats.Round(score)
+				jhBySource[s.name] = append(jhBySource[s.name], jh)
+				criticBySource[s.name] = append(criticBySource[s.name], score)
+			}
+		}
+		if len(critics) == 0 {
+			continue
+		}
+
+		sum := 0.0
+		for _, score := range critics {
+			sum += score
+		}
+		consensus := sum / float64(len(critics))
+		jhScores = append(jhScores, jh)
+		consensusScores = append(consensusScores, consensus)
+
+		takes = append(takes, hotTake{
+			Movie:      m.Movie,
+			Year:       m.Year,
+			TMDBId:     m.TMDBId,
+			JH_Score:   m.JH_Score,
+			Consensus:  stats.Round(consensus),
+			Difference: stats.Round(jh - consensus),
+			Critics:    critics,
+		})
+
+		for _, genre := range nonEmpty(m.Genre, m.Genre_2) {
+			gap, found := genres[genre]
+			if !found {
+				gap = &genreGap{bySource: make(map[string][]float64)}
+				genres[genre] = gap
+			}
+			gap.differences = append(gap.differences, jh-consensus)
+			for source, score := range critics {
+				gap.bySource[source] = append(gap.bySource[source], jh-score)
+			}
+		}
+	}
+
+	sources := []criticAgreement{}
+	for _, s := range criticSources {
+		sources = append(sources, agreement(s.name, jhBySource[s.name], criticBySource[s.name]))
+	}
+
+	sort.SliceStable(takes, func(i, j int) bool {
+		return takes[i].Difference > takes[j].Difference
+	})
+	over := []hotTake{}
+	under := []hotTake{}
+	for i := 0; i < top && i < len(takes) && takes[i].Difference > 0; i++ {
+		over = append(over, takes[i])
+	}
+	for i := len(takes) - 1; len(under) < top && i >= 0 && takes[i].Difference < 0; i-- {
+		under = append(under, takes[i])
+	}
+
+	bias := []genreBias{}
+	for genre, gap := range genres {
+		bySource := make(map[string]float64)
+		for source, differences := range gap.bySource {
+			bySource[source] = stats.Round(stats.Mean(differences))
+		}
+		bias = append(bias, genreBias{
+			FieldValue: genre,
+			Count:      len(gap.differences),
+			Bias:       stats.Round(stats.Mean(gap.differences)),
+			BySource:   bySource,
+		})
+	}
+	sort.Slice(bias, func(i, j int) bool {
+		if bias[i].Bias != bias[j].Bias {
+			return bias[i].Bias > bias[j].Bias
+		}
+		return bias[i].FieldValue < bias[j].FieldValue
+	})
+
+	c.IndentedJSON(http.StatusOK, bson.M{
+		"sources":    sources,
+		"consensus":  agreement("consensus", jhScores, consensusScores),
+		"overrated":  over,
+		"underrated": under,
+		"genreBias":  bias,
+	})
+}
@@ -0,0 +1,66 @@
+package movies
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseCriticScore(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		scale float64
+		want  float64
+		ok    bool
+	}{
+		{"out of ten", "7.8/10", 10, 78, true},
+		{"percent", "93%", 10, 93, true},
+		{"out of a hundred", "75/100", 100, 75, true},
+		{"own scale wins", "4/5", 100, 80, true},
+		{"bare number on the source's scale", "8.5", 10, 85, true},
+		{"bare number out of a hundred", "61", 100, 61, true},
+		{"spaces", " 6.5 / 10 ", 10, 65, true},
+		{"zero", "0/10", 10, 0, true},
+		{"N/A", "N/A", 10, 0, false},
+		{"n/a", "n/a", 10, 0, false},
+		{"empty", "", 10, 0, false},
+		{"above the scale", "11/10", 10, 0, false},
+		{"above a hundred percent", "120%", 100, 0, false},
+		{"negative", "-1", 10, 0, false},
+		{"zero scale", "5/0", 10, 0, false},
+		{"not a number", "great", 10, 0, false},
+		{"bad scale", "7/ten", 10, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseCriticScore(tt.value, tt.scale)
+			if ok != tt.ok || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("parseCriticScore(%q, %v) = %v, %v, want %v, %v", tt.value, tt.scale, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCriticSourceScore(t *testing.T) {
+	imdb := criticSources[0]
+	tests := []struct {
+		name  string
+		movie Movie
+		want  float64
+		ok    bool
+	}{
+		{"own field", Movie{IMDB: "8.1"}, 81, true},
+		{"ratings list", Movie{Ratings: []rating{{Source: "Internet Movie Database", Value: "7.2/10"}}}, 72, true},
+		{"unusable field falls back to ratings", Movie{IMDB: "N/A", Ratings: []rating{{Source: "internet movie database", Value: "6.0/10"}}}, 60, true},
+		{"other sources are ignored", Movie{Ratings: []rating{{Source: "Metacritic", Value: "70/100"}}}, 0, false},
+		{"nothing", Movie{}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := imdb.score(tt.movie)
+			if ok != tt.ok || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package movies
+
+import (
+	"errors"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Holidays whose movies are picked all month, by month
+var seasonalHolidays = map[time.Month]string{
+	time.October:  "Halloween",
+	time.December: "Christmas",
+}
+
+const (
+	// Days a pick can't repeat within unless the request sets window
+	defaultDailyWindow = 30
+	// Days back a past pick can be asked for, so requests can't fill the
+	// collection with picks for arbitrary dates
+	maxDailyHistory = 30
+)
+
+/*
+	 A movie of the day, stored so every visitor gets the same one and the
+		no-repeat window can look back at earlier days. Key identifies the
+		filters the pick was made with.
+*/
+type dailyPick struct {
+	ID        string    `bson:"_id"`
+	Key       string    `bson:"key"`
+	Date      string    `bson:"date"`
+	TMDBId    int32     `bson:"tmdbid"`
+	CreatedAt time.Time `bson:"createdAt"`
+}
+
+// Picks the candidate at a position derived from the key and date alone
+func seededPick(candidates []Movie, key string, date string) Movie {
+	h := fnv.New64a()
+	h.Write([]byte(key + "@" + date))
+	return candidates[h.Sum64()%uint64(len(candidates))]
+}
+
+/*
+The holiday whose movies are picked on the day: Halloween in October and
+Christmas in December, unless seasonal picks are off or the filters
+already choose holidays. Empty when none applies.
+*/
+func dailyHoliday(day time.Time, seasonal bool, params url.Values) string {
+	_, holidayFiltered := params["holiday"]
+	_, holidayExcluded := params["holiday!"]
+	if !seasonal || holidayFiltered || holidayExcluded {
+		return ""
+	}
+	return seasonalHolidays[day.Month()]
+}
+
+/*
+The candidates that aren't among the recent picks, or all of them when
+every candidate was picked recently. Repeating beats having no movie
+when the window outlasts the candidates.
+*/
+func unshown(candidates []Movie, recent []dailyPick) []Movie {
+	shown := make(map[int32]bool, len(recent))
+	for _, p := range recent {
+		shown[p.TMDBId] = true
+	}
+	remaining := []Movie{}
+	for _, m := range candidates {
+		if !shown[m.TMDBId] {
+			remaining = append(remaining, m)
+		}
+	}
+	if len(remaining) == 0 {
+		return candidates
+	}
+	return remaining
+}
+
+/*
+Accepts date (yyyy-mm-dd, default today, at most 30 days ago), tz (IANA time zone used for
+today, default UTC), window (days a movie can't repeat within, default
+30), seasonal (false to skip holiday movies) and the ListMovies filters.
+Returns the movie of the day. Everyone asking with the same filters gets
+the same movie. In October and December, Halloween and Christmas movies
+are picked unless holiday is filtered explicitly or there are none.
+*/
+func GetDailyMovie(c *gin.Context) {
+	f, errs := ParseFilter(c)
+	location, err := time.LoadLocation(c.DefaultQuery("tz", "UTC"))
+	if err != nil {
+		errs = append(errs, problem.FieldError{Field: "tz", Detail: "tz must be an IANA time zone such as America/Toronto"})
+		location = time.UTC
+	}
+	today := time.Now().In(location)
+	day := today
+	if date := c.Query("date"); date != "" {
+		day, err = time.ParseInLocation(time.DateOnly, date, location)
+		if err != nil {
+			errs = append(errs, problem.FieldError{Field: "date", Detail: "date must look like yyyy-mm-dd"})
+		} else if day.Format(time.DateOnly) > today.Format(time.DateOnly) {
+			errs = append(errs, problem.FieldError{Field: "date", Detail: "date can't be in the future"})
+		} else if day.Format(time.DateOnly) < today.AddDate(0, 0, -maxDailyHistory).Format(time.DateOnly) {
+			errs = append(errs, problem.FieldError{Field: "date", Detail: "date can be at most 30 days ago"})
+		}
+	}
+	window, err := strconv.Atoi(c.DefaultQuery("window", strconv.Itoa(defaultDailyWindow)))
+	if err != nil || window < 0 || window > 365 {
+		errs = append(errs, problem.FieldError{Field: "window", Detail: "window must be an integer from 0 to 365"})
+	}
+	seasonal := c.DefaultQuery("seasonal", "true")
+	if seasonal != "true" && seasonal != "false" {
+		errs = append(errs, problem.FieldError{Field: "seasonal", Detail: "seasonal must be true or false"})
+	}
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+	date := day.Format(time.DateOnly)
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	ctx := c.Request.Context()
+	projection := options.Find().SetProjection(bson.M{"TMDBId": 1}).SetSort(bson.M{"TMDBId": 1})
+
+	// The pick depends on the filters but not on when or where it is asked
+	// for. Unknown parameters are left out so they can't make new picks
+	params := url.Values{}
+	for name, values := range c.Request.URL.Query() {
+		if isFilterParam(name) {
+			params[name] = append([]string{}, values...)
+			sort.Strings(params[name])
+		}
+	}
+	if window != defaultDailyWindow {
+		params.Set("window", strconv.Itoa(window))
+	}
+	if seasonal == "false" {
+		params.Set("seasonal", seasonal)
+	}
+
+	var candidates []Movie
+	holiday := dailyHoliday(day, seasonal == "true", params)
+	if holiday != "" {
+		seasonFilter := f
+		seasonFilter.add("holiday", bson.M{"Holiday": holiday})
+		candidates, err = FindMovies(ctx, db.Collection("movies"), seasonFilter.Query(), projection)
+		if err != nil {
+			problem.Error(c, err, "Failed to fetch movies")
+			return
+		}
+		params.Set("season", holiday)
+	}
+	if len(candidates) == 0 {
+		holiday = ""
+		params.Del("season")
+		candidates, err = FindMovies(ctx, db.Collection("movies"), f.Query(), projection)
+		if err != nil {
+			problem.Error(c, err, "Failed to fetch movies")
+			return
+		}
+	}
+	if len(candidates) == 0 {
+		problem.NotFound(c, "No movies found matching the criteria")
+		return
+	}
+	key := params.Encode()
+
+	daily := db.Collection("daily")
+	var pick dailyPick
+	err = daily.FindOne(ctx, bson.M{"_id": key + "@" + date}).Decode(&pick)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		pick, err = makeDailyPick(c, daily, candidates, key, day, window)
+	}
+	if err != nil {
+		problem.Error(c, err, "Failed to pick the movie of the day")
+		return
+	}
+
+	var movie Movie
+	err = db.Collection("movies").FindOne(ctx, bson.M{"TMDBId": pick.TMDBId}).Decode(&movie)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movie")
+		return
+	}
+
+	response := gin.H{"date": date, "timezone": location.String(), "movie": movie}
+	if holiday != "" {
+		response["holiday"] = holiday
+	}
+	c.IndentedJSON(http.StatusOK, response)
+}
+
+/*
+Picks and stores the day's movie, leaving out the picks of the window
+days before it when enough candidates remain. If another request stored
+a pick first, that one is returned.
+*/
+func makeDailyPick(c *gin.Context, daily *mongo.Collection, candidates []Movie, key string, day time.Time, window int) (dailyPick, error) {
+	ctx := c.Request.Context()
+	date := day.Format(time.DateOnly)
+	from := day.AddDate(0, 0, -window).Format(time.DateOnly)
+
+	cursor, err := daily.Find(ctx, bson.M{"key": key, "date": bson.M{"$gte": from, "$lt": date}})
+	if err != nil {
+		return dailyPick{}, err
+	}
+	var recent []dailyPick
+	if err := cursor.All(ctx, &recent); err != nil {
+		return dailyPick{}, err
+	}
+
+	pick := dailyPick{
+		ID:        key + "@" + date,
+		Key:       key,
+		Date:      date,
+		TMDBId:    seededPick(unshown(candidates, recent), key, date).TMDBId,
+		CreatedAt: time.Now(),
+	}
+	if _, err := daily.InsertOne(ctx, pick); mongo.IsDuplicateKeyError(err) {
+		err = daily.FindOne(ctx, bson.M{"_id": pick.ID}).Decode(&pick)
+		return pick, err
+	} else if err != nil {
+		return dailyPick{}, err
+	}
+	return pick, nil
+}
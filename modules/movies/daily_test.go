@@ -0,0 +1,114 @@
+package movies
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSeededPick(t *testing.T) {
+	candidates := []Movie{{TMDBId: 1}, {TMDBId: 2}, {TMDBId: 3}, {TMDBId: 4}, {TMDBId: 5}}
+
+	// The same key and date always give the same movie
+	first := seededPick(candidates, "genre=Horror", "2024-06-01")
+	for i := 0; i < 10; i++ {
+		if got := seededPick(candidates, "genre=Horror", "2024-06-01"); got.TMDBId != first.TMDBId {
+			t.Fatalf("got %d, then %d", first.TMDBId, got.TMDBId)
+		}
+	}
+
+	// Different days and keys spread over the candidates
+	picked := make(map[int32]bool)
+	for day := 1; day <= 30; day++ {
+		date := time.Date(2024, 6, day, 0, 0, 0, 0, time.UTC).Format(time.DateOnly)
+		picked[seededPick(candidates, "", date).TMDBId] = true
+		picked[seededPick(candidates, "genre=Horror", date).TMDBId] = true
+	}
+	if len(picked) != len(candidates) {
+		t.Errorf("60 picks only landed on %d of %d movies", len(picked), len(candidates))
+	}
+
+	if got := seededPick(candidates[:1], "", "2024-06-01"); got.TMDBId != 1 {
+		t.Errorf("got %d from one candidate", got.TMDBId)
+	}
+}
+
+func TestDailyHoliday(t *testing.T) {
+	october := time.Date(2024, 10, 15, 0, 0, 0, 0, time.UTC)
+	december := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+	june := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		day      time.Time
+		seasonal bool
+		params   url.Values
+		want     string
+	}{
+		{"october", october, true, url.Values{}, "Halloween"},
+		{"december", december, true, url.Values{}, "Christmas"},
+		{"other months", june, true, url.Values{}, ""},
+		{"turned off", october, false, url.Values{}, ""},
+		{"other filters", october, true, url.Values{"genre": {"Comedy"}}, "Halloween"},
+		{"holiday filtered", december, true, url.Values{"holiday": {"Halloween"}}, ""},
+		{"holiday excluded", december, true, url.Values{"holiday!": {"Christmas"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dailyHoliday(tt.day, tt.seasonal, tt.params); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnshown(t *testing.T) {
+	candidates := []Movie{{TMDBId: 1}, {TMDBId: 2}, {TMDBId: 3}}
+	tests := []struct {
+		name   string
+		recent []dailyPick
+		want   []int32
+	}{
+		{"nothing recent", nil, []int32{1, 2, 3}},
+		{"recent picks are left out", []dailyPick{{TMDBId: 1}, {TMDBId: 3}}, []int32{2}},
+		{"picks that aren't candidates", []dailyPick{{TMDBId: 9}}, []int32{1, 2, 3}},
+		{"every candidate shown repeats", []dailyPick{{TMDBId: 1}, {TMDBId: 2}, {TMDBId: 3}}, []int32{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unshown(candidates, tt.recent)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i, m := range got {
+				if m.TMDBId != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// Dates in the future or too long ago are rejected before the database is used
+func TestGetDailyMovieRejectsDates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	today := time.Now().UTC()
+	for _, date := range []string{
+		"June 1st",
+		today.AddDate(0, 0, 2).Format(time.DateOnly),
+		today.AddDate(0, 0, -maxDailyHistory-1).Format(time.DateOnly),
+		"1999-01-01",
+	} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/movies/daily?date="+url.QueryEscape(date), nil)
+		GetDailyMovie(c)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("date %s: got status %d, want 400", date, w.Code)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package movies
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Longest expression and deepest nesting accepted in the filter parameter
+const (
+	maxExpressionLength = 2000
+	maxExpressionDepth  = 32
+)
+
+// An error in a filter expression, at a 1-based character position
+type syntaxError struct {
+	position int
+	message  string
+}
+
+func (e *syntaxError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.message, e.position)
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOperator
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind     tokenKind
+	text     string
+	position int
+}
+
+// How a token is named in error messages
+func (t token) describe() string {
+	if t.kind == tokenEnd {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+// Whether the token is the keyword, which may be written in any case
+func (t token) is(keyword string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+// Characters that end an unquoted word
+func isDelimiter(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(`()":=!<>`, r)
+}
+
+func tokenize(expression string) ([]token, *syntaxError) {
+	runes := []rune(expression)
+	var tokens []token
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i + 1
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokenOpen, "(", start})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokenClose, ")", start})
+			i++
+		case r == '"':
+			var b strings.Builder
+			i++
+			for i < len(runes) && runes[i] != '"' {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				b.WriteRune(runes[i])
+				i++
+			}
+			if i == len(runes) {
+				return nil, &syntaxError{start, "unterminated string"}
+			}
+			tokens = append(tokens, token{tokenString, b.String(), start})
+			i++
+		case r == ':' || r == '=':
+			tokens = append(tokens, token{tokenOperator, string(r), start})
+			i++
+		case r == '!' || r == '<' || r == '>':
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				tokens = append(tokens, token{tokenOperator, string(runes[i : i+2]), start})
+				i += 2
+				continue
+			}
+			if r == '!' {
+				return nil, &syntaxError{start, `expected "=" after "!"`}
+			}
+			tokens = append(tokens, token{tokenOperator, string(r), start})
+			i++
+		default:
+			j := i
+			for j < len(runes) && !isDelimiter(runes[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokenWord, string(runes[i:j]), start})
+			i = j
+		}
+	}
+
+	return append(tokens, token{tokenEnd, "", len(runes) + 1}), nil
+}
+
+/*
+Recursive descent parser for filter expressions:
+
+	expression := term { OR term }
+	term       := factor { AND factor }
+	factor     := NOT factor | "(" expression ")" | field operator value
+	operator   := ":" | "=" | "!=" | ">" | ">=" | "<" | "<="
+*/
+type parser struct {
+	tokens []token
+	next   int
+	depth  int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) take() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEnd {
+		p.next++
+	}
+	return t
+}
+
+func unexpected(t token, expected string) *syntaxError {
+	return &syntaxError{t.position, fmt.Sprintf("expected %s but found %s", expected, t.describe())}
+}
+
+func (p *parser) expression() (bson.M, *syntaxError) {
+	first, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	options := []bson.M{first}
+	for p.peek().is("OR") {
+		p.take()
+		next, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, next)
+	}
+
+	if len(options) == 1 {
+		return first, nil
+	}
+	return bson.M{"$or": options}, nil
+}
+
+func (p *parser) term() (bson.M, *syntaxError) {
+	first, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	conditions := []bson.M{first}
+	for p.peek().is("AND") {
+		p.take()
+		next, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, next)
+	}
+
+	if len(conditions) == 1 {
+		return first, nil
+	}
+	return bson.M{"$and": conditions}, nil
+}
+
+func (p *parser) factor() (bson.M, *syntaxError) {
+	t := p.peek()
+	if p.depth >= maxExpressionDepth {
+		return nil, &syntaxError{t.position, "expression is nested too deeply"}
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+
+	switch {
+	case t.is("NOT"):
+		p.take()
+		condition, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{"$nor": []bson.M{condition}}, nil
+
+	case t.kind == tokenOpen:
+		p.take()
+		condition, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.take(); closing.kind != tokenClose {
+			return nil, unexpected(closing, `")" or a boolean operator`)
+		}
+		return condition, nil
+
+	case t.kind == tokenWord && !t.is("AND") && !t.is("OR"):
+		return p.comparison()
+	}
+	return nil, unexpected(t, "a field name, NOT or \"(\"")
+}
+
+func (p *parser) comparison() (bson.M, *syntaxError) {
+	field := p.take()
+	operator := p.take()
+	if operator.kind != tokenOperator {
+		return nil, unexpected(operator, "an operator such as \":\" or \">=\"")
+	}
+	value := p.take()
+	if value.kind != tokenWord && value.kind != tokenString {
+		return nil, unexpected(value, "a value")
+	}
+	return compare(field, operator, value)
+}
+
+// Comparison operators and their MongoDB equivalents
+var comparisons = map[string]string{
+	">":  "$gt",
+	">=": "$gte",
+	"<":  "$lt",
+	"<=": "$lte",
+}
+
+// Numeric fields usable in expressions, by expression name
+var numericFields = map[string]string{
+	"year":     "Year",
+	"runtime":  "Runtime",
+	"rating":   "JH_Score",
+	"score":    "JH_Score",
+	"jh_score": "JH_Score",
+	"ranking":  "Ranking",
+}
+
+// Builds the condition for one field comparison
+func compare(field token, operator token, value token) (bson.M, *syntaxError) {
+	name := strings.ToLower(field.text)
+	op := operator.text
+	equality := op == ":" || op == "=" || op == "!="
+
+	for _, lf := range listFields {
+		if lf.param != name {
+			continue
+		}
+		if !equality {
+			return nil, &syntaxError{operator.position, fmt.Sprintf("%s only supports \":\", \"=\" and \"!=\"", name)}
+		}
+		if op == "!=" {
+			return lf.notIn([]string{value.text}), nil
+		}
+		return lf.in([]string{value.text}), nil
+	}
+
+	if path, ok := numericFields[name]; ok {
+		if equality && strings.Contains(value.text, "-") {
+			start, end, err := parseYearRange(value.text)
+			if err != nil {
+				return nil, &syntaxError{value.position, fmt.Sprintf("%s needs a number or a start-end range", name)}
+			}
+			condition := bson.M{path: bson.M{"$gte": start, "$lte": end}}
+			if op == "!=" {
+				return bson.M{"$nor": []bson.M{condition}}, nil
+			}
+			return condition, nil
+		}
+
+		n, err := strconv.Atoi(value.text)
+		if err != nil {
+			return nil, &syntaxError{value.position, fmt.Sprintf("%s needs a number", name)}
+		}
+		switch op {
+		case ":", "=":
+			return bson.M{path: n}, nil
+		case "!=":
+			return bson.M{path: bson.M{"$ne": n}}, nil
+		}
+		return bson.M{path: bson.M{comparisons[op]: n}}, nil
+	}
+
+	switch name {
+	case "provider":
+		id, err := strconv.Atoi(value.text)
+		if err != nil {
+			return nil, &syntaxError{value.position, "provider needs a provider id"}
+		}
+		if !equality {
+			return nil, &syntaxError{operator.position, "provider only supports \":\", \"=\" and \"!=\""}
+		}
+		condition := providerCondition([]string{"flatrate"}, []int{id})
+		if op == "!=" {
+			return bson.M{"$nor": []bson.M{condition}}, nil
+		}
+		return condition, nil
+
+	case "dani_approved":
+		approved, err := strconv.ParseBool(value.text)
+		if err != nil {
+			return nil, &syntaxError{value.position, "dani_approved needs true or false"}
+		}
+		if !equality {
+			return nil, &syntaxError{operator.position, "dani_approved only supports \":\", \"=\" and \"!=\""}
+		}
+		if op == "!=" {
+			approved = !approved
+		}
+		return bson.M{"Dani_Approved": approved}, nil
+
+	case "added":
+		ms, err := parseAddedBound(value.text)
+		if err != nil {
+			return nil, &syntaxError{value.position, "added needs a date (yyyy-mm-dd), RFC 3339 time or milliseconds"}
+		}
+		if equality {
+			return nil, &syntaxError{operator.position, "added only supports \">\", \">=\", \"<\" and \"<=\""}
+		}
+		return bson.M{"ms_added": bson.M{comparisons[op]: ms}}, nil
+	}
+
+	return nil, &syntaxError{field.position, fmt.Sprintf("unknown field %s", strconv.Quote(field.text))}
+}
+
+/*
+Parses a boolean filter expression into a MongoDB condition, e.g.
+
+	(genre:Action OR genre:Comedy) AND NOT holiday:Christmas AND year>=2000
+
+Fields are the list filters (genre, universe, exclusive, studio,
+holiday, director, rated), the numbers year, runtime, rating and
+ranking, provider, dani_approved and added. Values with spaces go in
+double quotes. Keywords are case-insensitive and AND binds tighter
+than OR.
+*/
+func parseExpression(expression string) (bson.M, *syntaxError) {
+	if len(expression) > maxExpressionLength {
+		return nil, &syntaxError{maxExpressionLength + 1, fmt.Sprintf("expression is longer than %d characters", maxExpressionLength)}
+	}
+
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	condition, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if rest := p.peek(); rest.kind != tokenEnd {
+		return nil, unexpected(rest, "AND, OR or end of expression")
+	}
+	return condition, nil
+}
@@ -0,0 +1,104 @@
+package movies
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseExpression(t *testing.T) {
+	genre := func(values ...string) bson.M {
+		return bson.M{"$or": []bson.M{
+			{"Genre": bson.M{"$in": values}},
+			{"Genre_2": bson.M{"$in": values}},
+		}}
+	}
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bson.M
+	}{
+		{"list field", "genre:Action", genre("Action")},
+		{"single field list", "studio=Pixar", bson.M{"Studio": bson.M{"$in": []string{"Pixar"}}}},
+		{"not equal list", "holiday!=Christmas", bson.M{"Holiday": bson.M{"$nin": []string{"Christmas"}}}},
+		{"quoted value", `director:"Ridley Scott"`, bson.M{"Director": bson.M{"$in": []string{"Ridley Scott"}}}},
+		{"escaped quote", `director:"The \"Kid\""`, bson.M{"Director": bson.M{"$in": []string{`The "Kid"`}}}},
+		{"number", "year=1999", bson.M{"Year": 1999}},
+		{"number not equal", "runtime!=90", bson.M{"Runtime": bson.M{"$ne": 90}}},
+		{"comparison", "rating>=80", bson.M{"JH_Score": bson.M{"$gte": 80}}},
+		{"range", "year:1980-1989", bson.M{"Year": bson.M{"$gte": 1980, "$lte": 1989}}},
+		{"excluded range", "year!=1980-1989", bson.M{"$nor": []bson.M{{"Year": bson.M{"$gte": 1980, "$lte": 1989}}}}},
+		{"approved", "dani_approved:true", bson.M{"Dani_Approved": true}},
+		{"approved negated", "dani_approved!=true", bson.M{"Dani_Approved": false}},
+		{"added", "added>1700000000000", bson.M{"ms_added": bson.M{"$gt": int64(1700000000000)}}},
+		{"not", "NOT genre:Horror", bson.M{"$nor": []bson.M{genre("Horror")}}},
+		{
+			"and binds tighter than or",
+			"genre:Action OR genre:Comedy AND year<2000",
+			bson.M{"$or": []bson.M{
+				genre("Action"),
+				{"$and": []bson.M{genre("Comedy"), {"Year": bson.M{"$lt": 2000}}}},
+			}},
+		},
+		{
+			"parentheses",
+			"(genre:Action or genre:Comedy) and year<2000",
+			bson.M{"$and": []bson.M{
+				{"$or": []bson.M{genre("Action"), genre("Comedy")}},
+				{"Year": bson.M{"$lt": 2000}},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseExpression(tt.expression)
+			if err != nil {
+				t.Fatalf("parseExpression(%q): %v", tt.expression, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseExpression(%q)\n got %v\nwant %v", tt.expression, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		position   int
+		message    string
+	}{
+		{"empty", "", 1, "expected a field name, NOT or \"(\" but found end of expression"},
+		{"unterminated string", `director:"Ridley`, 10, "unterminated string"},
+		{"lone bang", "genre !Action", 7, `expected "=" after "!"`},
+		{"missing operator", "genre Action", 7, "expected an operator such as \":\" or \">=\" but found \"Action\""},
+		{"missing value", "year>=", 7, "expected a value but found end of expression"},
+		{"unknown field", "year>2000 AND colour:red", 15, `unknown field "colour"`},
+		{"comparison on a list", "genre>Action", 6, "genre only supports \":\", \"=\" and \"!=\""},
+		{"not a number", "runtime<long", 9, "runtime needs a number"},
+		{"bad range", "year:1990-1980", 6, "year needs a number or a start-end range"},
+		{"bad provider", "provider:netflix", 10, "provider needs a provider id"},
+		{"equality on added", "added:2024-01-01", 6, "added only supports \">\", \">=\", \"<\" and \"<=\""},
+		{"unclosed parenthesis", "(genre:Action", 14, "expected \")\" or a boolean operator but found end of expression"},
+		{"dangling operator", "genre:Action AND", 17, "expected a field name, NOT or \"(\" but found end of expression"},
+		{"trailing tokens", "genre:Action genre:Comedy", 14, "expected AND, OR or end of expression but found \"genre\""},
+		{"positions count characters", `director:"Émile" AND x:1`, 22, `unknown field "x"`},
+		{"too deep", strings.Repeat("(", maxExpressionDepth+1) + "year:1", maxExpressionDepth + 1, "expression is nested too deeply"},
+		{"too long", strings.Repeat(" ", maxExpressionLength+1), maxExpressionLength + 1, "expression is longer than 2000 characters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseExpression(tt.expression)
+			if err == nil {
+				t.Fatalf("parseExpression(%q) succeeded", tt.expression)
+			}
+			if err.position != tt.position || err.message != tt.message {
+				t.Errorf("got %q at %d, want %q at %d", err.message, err.position, tt.message, tt.position)
+			}
+		})
+	}
+}
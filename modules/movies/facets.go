@@ -0,0 +1,475 @@
+package movies
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/cache"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Upper bound on facet queries ListTypes runs against MongoDB at once
+const maxConcurrentFacets = 4
+
+/*
+	 One dimension of /types/list. run receives the current filters and
+		the query for them minus the facet's own selection, and returns the
+		value placed under name in the response; failed describes a
+		failure to clients.
+*/
+type facet struct {
+	name   string
+	failed string
+	run    func(ctx context.Context, store facetStore, f Filter, match bson.M) (interface{}, error)
+}
+
+/*
+	 The queries facets are built from. Each counting query returns counts
+		over the whole catalog and over the movies matching match, so facets
+		can list values whose filtered count is zero.
+*/
+type facetStore interface {
+	// Movies per value of the field expressions, such as "$Genre"
+	valueCounts(ctx context.Context, match bson.M, fields ...string) (all []valueCount, matched []valueCount, err error)
+	// Movies per universe and sub-universe pair
+	universeCounts(ctx context.Context, match bson.M) (all []universeCount, matched []universeCount, err error)
+	// Movies per provider on any of the provider lists, such as "flatrate"
+	providerCounts(ctx context.Context, match bson.M, lists []string) (all []providerCount, matched []providerCount, err error)
+	// Shortest and longest runtimes of the matching movies
+	runtimeRange(ctx context.Context, match bson.M) ([]bson.M, error)
+}
+
+// Runs the facet queries against the movies collection
+type mongoFacets struct {
+	collection *mongo.Collection
+}
+
+var facets = []facet{
+	{"universes", "Failed to fetch universe data", universeFacet},
+	{"genre", "Failed to fetch genre data", genreFacet},
+	{"year", "Failed to fetch distinct years", valueFacet("$Year")},
+	{"provider", "Failed to fetch providers", providerFacet},
+	{"exclusive", "Failed to fetch distinct exclusives", valueFacet("$Exclusive")},
+	{"holiday", "Failed to fetch distinct holidays", valueFacet("$Holiday")},
+	{"studio", "Failed to fetch distinct studios", valueFacet("$Studio")},
+	{"rated", "Failed to fetch distinct MPAA ratings", valueFacet("$Rated")},
+	{"director", "Failed to fetch directors with counts", directorFacet},
+	{"runtime", "Failed to aggregate runtimes", runtimeFacet},
+}
+
+// A facet that could not be computed, reported next to the ones that were
+type facetError struct {
+	Facet  string `json:"facet"`
+	Detail string `json:"detail"`
+}
+
+// Number of movies matching the filters for one facet value
+type facetCount struct {
+	FieldValue interface{} `json:"fieldValue"`
+	TotalCount int32       `json:"totalCount"`
+}
+
+/*
+	 Result of facets that historically returned a plain list of
+		values. The list keeps its place in the response and the counts
+		go under "counts".
+*/
+type valueList struct {
+	values []interface{}
+	counts []facetCount
+}
+
+/*
+Returns every filterable value in the catalog with the number of movies
+matching the ListMovies filters in the query string. Each facet ignores
+its own selection, so selecting Horror still counts the other genres.
+Values with no matching movies are kept with a count of 0.
+
+The facet queries run concurrently; when some fail the rest are still
+returned along with an errors list, and the response is not cached.
+*/
+func ListTypes(c *gin.Context) {
+	f, errs := ParseFilter(c)
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	store := mongoFacets{collection: client.Database("jdmovies").Collection("movies")}
+	results, failed := runFacets(c.Request.Context(), store, f, maxConcurrentFacets)
+
+	response := bson.M{}
+	counts := bson.M{}
+	var failures []facetError
+	for i, fc := range facets {
+		if failed[i] != nil {
+			log.Printf("request %s: %s: %v", c.GetString("requestId"), fc.failed, failed[i])
+			failures = append(failures, facetError{Facet: fc.name, Detail: fc.failed})
+			continue
+		}
+		if list, ok := results[i].(valueList); ok {
+			response[fc.name] = list.values
+			counts[fc.name] = list.counts
+			continue
+		}
+		response[fc.name] = results[i]
+	}
+	response["counts"] = counts
+
+	if len(failures) == len(facets) {
+		problem.Abort(c, http.StatusInternalServerError, "Failed to fetch any catalog facets")
+		return
+	}
+	if len(failures) > 0 {
+		response["errors"] = failures
+		cache.Skip(c)
+	}
+
+	c.IndentedJSON(http.StatusOK, response)
+}
+
+/*
+Runs every facet with at most parallel queries at once. Results and
+errors are in the order of facets.
+*/
+func runFacets(ctx context.Context, store facetStore, f Filter, parallel int) ([]interface{}, []error) {
+	results := make([]interface{}, len(facets))
+	failed := make([]error, len(facets))
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, parallel)
+	for i, fc := range facets {
+		wg.Add(1)
+		go func(i int, fc facet) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results[i], failed[i] = fc.run(ctx, store, f, f.queryExcept(fc.name))
+		}(i, fc)
+	}
+	wg.Wait()
+	return results, failed
+}
+
+/*
+Runs the same stages over the whole catalog and over the movies matching
+match in one round trip, so facets can list values whose filtered count
+is zero.
+*/
+func countFacet[T any](ctx context.Context, collection *mongo.Collection, match bson.M, stages bson.A) ([]T, []T, error) {
+	matched := append(bson.A{bson.M{"$match": match}}, stages...)
+	pipeline := bson.A{
+		bson.M{"$facet": bson.M{
+			"all":     stages,
+			"matched": matched,
+		}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var results []struct {
+		All     []T `bson:"all"`
+		Matched []T `bson:"matched"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil, nil
+	}
+	return results[0].All, results[0].Matched, nil
+}
+
+// Map key for a decoded value, which may not be comparable
+func valueKey(value interface{}) string {
+	return fmt.Sprintf("%T:%v", value, value)
+}
+
+type valueCount struct {
+	Value interface{} `bson:"_id"`
+	Count int32       `bson:"count"`
+}
+
+/*
+Counts movies per value of the given field expressions, counting a movie
+once even when several of its fields hold the same value.
+*/
+func (m mongoFacets) valueCounts(ctx context.Context, match bson.M, fields ...string) ([]valueCount, []valueCount, error) {
+	exprs := make(bson.A, len(fields))
+	for i, field := range fields {
+		exprs[i] = field
+	}
+
+	stages := bson.A{
+		bson.M{"$project": bson.M{
+			"_id":    0,
+			"values": bson.M{"$setUnion": bson.A{exprs}},
+		}},
+		bson.M{"$unwind": "$values"},
+		bson.M{"$match": bson.M{"values": bson.M{"$ne": nil}}},
+		bson.M{"$group": bson.M{
+			"_id":   "$values",
+			"count": bson.M{"$sum": 1},
+		}},
+	}
+
+	return countFacet[valueCount](ctx, m.collection, match, stages)
+}
+
+/*
+Counts movies per value of the given field expressions. Values are
+ordered by filtered count, then by value.
+*/
+func countValues(ctx context.Context, store facetStore, match bson.M, fields ...string) ([]facetCount, error) {
+	all, matched, err := store.valueCounts(ctx, match, fields...)
+	if err != nil {
+		return nil, err
+	}
+
+	matchedCounts := make(map[string]int32, len(matched))
+	for _, m := range matched {
+		matchedCounts[valueKey(m.Value)] = m.Count
+	}
+
+	counts := make([]facetCount, len(all))
+	for i, a := range all {
+		counts[i] = facetCount{FieldValue: a.Value, TotalCount: matchedCounts[valueKey(a.Value)]}
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].TotalCount != counts[j].TotalCount {
+			return counts[i].TotalCount > counts[j].TotalCount
+		}
+		return fmt.Sprint(counts[i].FieldValue) < fmt.Sprint(counts[j].FieldValue)
+	})
+	return counts, nil
+}
+
+type universeCount struct {
+	ID struct {
+		Universe     interface{} `bson:"universe"`
+		Sub_Universe interface{} `bson:"sub_universe"`
+	} `bson:"_id"`
+	Count int32 `bson:"count"`
+}
+
+func (m mongoFacets) universeCounts(ctx context.Context, match bson.M) ([]universeCount, []universeCount, error) {
+	stages := bson.A{
+		bson.M{"$group": bson.M{
+			"_id": bson.M{
+				"universe":     bson.M{"$ifNull": bson.A{"$Universe", nil}},
+				"sub_universe": bson.M{"$ifNull": bson.A{"$Sub_Universe", nil}},
+			},
+			"count": bson.M{"$sum": 1},
+		}},
+	}
+
+	return countFacet[universeCount](ctx, m.collection, match, stages)
+}
+
+// Universes with their movie counts and sub-universes
+func universeFacet(ctx context.Context, store facetStore, _ Filter, match bson.M) (interface{}, error) {
+	all, matched, err := store.universeCounts(ctx, match)
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct{ universe, sub string }
+	matchedCounts := make(map[key]int32, len(matched))
+	for _, m := range matched {
+		matchedCounts[key{valueKey(m.ID.Universe), valueKey(m.ID.Sub_Universe)}] = m.Count
+	}
+
+	// Group sub-universes under their universe, keeping first-seen order
+	universes := []bson.M{}
+	index := make(map[string]int)
+	for _, a := range all {
+		count := matchedCounts[key{valueKey(a.ID.Universe), valueKey(a.ID.Sub_Universe)}]
+
+		i, seen := index[valueKey(a.ID.Universe)]
+		if !seen {
+			i = len(universes)
+			index[valueKey(a.ID.Universe)] = i
+			universes = append(universes, bson.M{
+				"_id":                a.ID.Universe,
+				"fieldValue":         a.ID.Universe,
+				"totalCount":         int32(0),
+				"subUniverses":       []facetCount{},
+				"noSubUniverseCount": int32(0),
+			})
+		}
+		u := universes[i]
+		u["totalCount"] = u["totalCount"].(int32) + count
+
+		if a.ID.Sub_Universe == nil {
+			u["noSubUniverseCount"] = u["noSubUniverseCount"].(int32) + count
+		} else {
+			u["subUniverses"] = append(u["subUniverses"].([]facetCount), facetCount{FieldValue: a.ID.Sub_Universe, TotalCount: count})
+		}
+	}
+	return universes, nil
+}
+
+// Genres counted across both Genre and Genre_2, most common first
+func genreFacet(ctx context.Context, store facetStore, _ Filter, match bson.M) (interface{}, error) {
+	return countValues(ctx, store, match, "$Genre", "$Genre_2")
+}
+
+// All values of a single field, with their counts
+func valueFacet(field string) func(ctx context.Context, store facetStore, f Filter, match bson.M) (interface{}, error) {
+	return func(ctx context.Context, store facetStore, _ Filter, match bson.M) (interface{}, error) {
+		counts, err := countValues(ctx, store, match, field)
+		if err != nil {
+			return nil, err
+		}
+
+		values := make([]interface{}, len(counts))
+		for i, count := range counts {
+			values[i] = count.FieldValue
+		}
+		sort.Slice(values, func(i, j int) bool {
+			return fmt.Sprint(values[i]) < fmt.Sprint(values[j])
+		})
+		return valueList{values: values, counts: counts}, nil
+	}
+}
+
+/*
+	 A streaming provider with how many movies it has. The fields are spelled
+		out because the driver skips unexported embedded structs.
+*/
+type providerCount struct {
+	Logo_path        string `bson:"logo_path" json:"logo_path"`
+	Provider_id      int32  `bson:"provider_id" json:"provider_id"`
+	Provider_name    string `bson:"provider_name" json:"provider_name"`
+	Display_priority int32  `bson:"display_priority" json:"display_priority"`
+	Count            int32  `bson:"count" json:"totalCount"`
+}
+
+/*
+Counts movies per provider over the provider lists, counting a movie
+once when a provider is on several of its lists.
+*/
+func (m mongoFacets) providerCounts(ctx context.Context, match bson.M, lists []string) ([]providerCount, []providerCount, error) {
+	offers := bson.A{}
+	for _, list := range lists {
+		offers = append(offers, bson.M{"$ifNull": bson.A{"$Provider." + list, bson.A{}}})
+	}
+	stages := bson.A{
+		bson.M{"$project": bson.M{"offers": bson.M{"$concatArrays": offers}}},
+		bson.M{"$unwind": "$offers"},
+		bson.M{"$group": bson.M{
+			"_id":   bson.M{"movie": "$_id", "provider": "$offers.provider_id"},
+			"offer": bson.M{"$first": "$offers"},
+		}},
+		bson.M{"$group": bson.M{
+			"_id":              "$offer.provider_id",
+			"logo_path":        bson.M{"$first": "$offer.logo_path"},
+			"provider_id":      bson.M{"$first": "$offer.provider_id"},
+			"provider_name":    bson.M{"$first": "$offer.provider_name"},
+			"display_priority": bson.M{"$first": "$offer.display_priority"},
+			"count":            bson.M{"$sum": 1},
+		}},
+	}
+
+	return countFacet[providerCount](ctx, m.collection, match, stages)
+}
+
+/*
+Providers on the lists the availability filter looks at, streaming by
+default, ordered by display priority.
+*/
+func providerFacet(ctx context.Context, store facetStore, f Filter, match bson.M) (interface{}, error) {
+	all, matched, err := store.providerCounts(ctx, match, f.providerLists())
+	if err != nil {
+		return nil, err
+	}
+
+	matchedCounts := make(map[int32]int32, len(matched))
+	for _, p := range matched {
+		matchedCounts[p.Provider_id] = p.Count
+	}
+	for i := range all {
+		all[i].Count = matchedCounts[all[i].Provider_id]
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Display_priority < all[j].Display_priority
+	})
+	return all, nil
+}
+
+/*
+Directors with at least three movies in the catalog, most matches
+first. The threshold uses catalog counts so filtering doesn't hide a
+director; both counts come from one query.
+*/
+func directorFacet(ctx context.Context, store facetStore, _ Filter, match bson.M) (interface{}, error) {
+	all, matched, err := store.valueCounts(ctx, match, "$Director")
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make(map[string]int32, len(matched))
+	for _, m := range matched {
+		filtered[valueKey(m.Value)] = m.Count
+	}
+
+	catalog := make(map[string]int32, len(all))
+	directors := []facetCount{}
+	for _, a := range all {
+		if a.Count >= 3 {
+			catalog[valueKey(a.Value)] = a.Count
+			directors = append(directors, facetCount{FieldValue: a.Value, TotalCount: filtered[valueKey(a.Value)]})
+		}
+	}
+	sort.Slice(directors, func(i, j int) bool {
+		a, b := directors[i], directors[j]
+		if a.TotalCount != b.TotalCount {
+			return a.TotalCount > b.TotalCount
+		}
+		if catalog[valueKey(a.FieldValue)] != catalog[valueKey(b.FieldValue)] {
+			return catalog[valueKey(a.FieldValue)] > catalog[valueKey(b.FieldValue)]
+		}
+		return fmt.Sprint(a.FieldValue) < fmt.Sprint(b.FieldValue)
+	})
+	return directors, nil
+}
+
+// Shortest and longest runtimes of the matching movies
+func runtimeFacet(ctx context.Context, store facetStore, _ Filter, match bson.M) (interface{}, error) {
+	return store.runtimeRange(ctx, match)
+}
+
+func (m mongoFacets) runtimeRange(ctx context.Context, match bson.M) ([]bson.M, error) {
+	runtimePipeline := bson.A{
+		bson.M{"$match": match},
+		bson.M{"$group": bson.M{
+			"_id": nil,
+			"max": bson.M{"$max": "$Runtime"},
+			"min": bson.M{"$min": "$Runtime"},
+		}},
+	}
+
+	cursor, err := m.collection.Aggregate(ctx, runtimePipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var runtimes []bson.M
+	if err = cursor.All(ctx, &runtimes); err != nil {
+		return nil, err
+	}
+	return runtimes, nil
+}
@@ -0,0 +1,289 @@
+package movies
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestProviderCountDecodes(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  bson.M
+		want providerCount
+	}{
+		{
+			name: "grouped provider",
+			doc:  bson.M{"_id": int32(8), "logo_path": "/netflix.jpg", "provider_id": int32(8), "provider_name": "Netflix", "display_priority": int32(1), "count": int32(42)},
+			want: providerCount{Logo_path: "/netflix.jpg", Provider_id: 8, Provider_name: "Netflix", Display_priority: 1, Count: 42},
+		},
+		{
+			name: "no logo",
+			doc:  bson.M{"_id": int32(337), "provider_id": int32(337), "provider_name": "Disney Plus", "display_priority": int32(3), "count": int32(0)},
+			want: providerCount{Provider_id: 337, Provider_name: "Disney Plus", Display_priority: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := bson.Marshal(tt.doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got providerCount
+			if err := bson.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// A catalog of n movies spread over a few genres, years, universes and providers
+func facetCatalog(n int) []bson.M {
+	genres := []string{"Horror", "Comedy", "Action", "Drama", "Animation"}
+	universes := []string{"Marvel", "Star Wars", "Pixar"}
+	providers := bson.A{
+		bson.M{"provider_id": int32(8), "provider_name": "Netflix", "logo_path": "/netflix.jpg", "display_priority": int32(1)},
+		bson.M{"provider_id": int32(337), "provider_name": "Disney Plus", "logo_path": "/disney.jpg", "display_priority": int32(3)},
+	}
+	docs := make([]bson.M, n)
+	for i := range docs {
+		doc := bson.M{
+			"Movie":    fmt.Sprintf("Movie %d", i),
+			"TMDBId":   int32(i + 1),
+			"Genre":    genres[i%len(genres)],
+			"Genre_2":  genres[(i+2)%len(genres)],
+			"Year":     int32(1980 + i%40),
+			"Studio":   fmt.Sprintf("Studio %d", i%7),
+			"Director": fmt.Sprintf("Director %d", i%11),
+			"Rated":    []string{"G", "PG", "PG-13", "R"}[i%4],
+			"Runtime":  int32(80 + i%70),
+			"JH_Score": int32(i % 101),
+			"Provider": bson.M{"flatrate": bson.A{providers[i%2]}},
+		}
+		if i%3 == 0 {
+			doc["Universe"] = universes[i%len(universes)]
+		}
+		if i%10 == 0 {
+			doc["Holiday"] = "Christmas"
+		}
+		docs[i] = doc
+	}
+	return docs
+}
+
+// The filter ParseFilter reads from the query string
+func filterFor(t testing.TB, query string) Filter {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/types/list?"+query, nil)
+	f, errs := ParseFilter(c)
+	if len(errs) > 0 {
+		t.Fatalf("ParseFilter(%q): %v", query, errs)
+	}
+	return f
+}
+
+// The result of the named facet
+func facetResult(t *testing.T, results []interface{}, failed []error, name string) interface{} {
+	t.Helper()
+	for i, fc := range facets {
+		if fc.name == name {
+			if failed[i] != nil {
+				t.Fatalf("facet %s failed: %v", name, failed[i])
+			}
+			return results[i]
+		}
+	}
+	t.Fatalf("no facet named %s", name)
+	return nil
+}
+
+func TestRunFacetsCounts(t *testing.T) {
+	store := memoryFacets{docs: []bson.M{
+		{"Genre": "Horror", "Year": int32(1984), "Runtime": int32(95), "Universe": "Elm Street"},
+		{"Genre": "Horror", "Genre_2": "Comedy", "Year": int32(1987), "Runtime": int32(85)},
+		{"Genre": "Comedy", "Year": int32(1984), "Runtime": int32(110)},
+		{"Genre": "Action", "Year": int32(1999), "Runtime": int32(136)},
+	}}
+
+	tests := []struct {
+		name   string
+		query  string
+		facet  string
+		counts []facetCount
+	}{
+		{
+			name:   "own selection is ignored",
+			query:  "genre=Horror",
+			facet:  "genre",
+			counts: []facetCount{{"Comedy", 2}, {"Horror", 2}, {"Action", 1}},
+		},
+		{
+			name:   "other selections narrow the counts",
+			query:  "genre=Horror",
+			facet:  "year",
+			counts: []facetCount{{int32(1984), 1}, {int32(1987), 1}, {int32(1999), 0}},
+		},
+		{
+			name:   "no filters",
+			query:  "",
+			facet:  "year",
+			counts: []facetCount{{int32(1984), 2}, {int32(1987), 1}, {int32(1999), 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, failed := runFacets(context.Background(), store, filterFor(t, tt.query), maxConcurrentFacets)
+			var got []facetCount
+			switch result := facetResult(t, results, failed, tt.facet).(type) {
+			case []facetCount:
+				got = result
+			case valueList:
+				got = result.counts
+			}
+			if !reflect.DeepEqual(got, tt.counts) {
+				t.Errorf("got %v, want %v", got, tt.counts)
+			}
+		})
+	}
+
+	results, failed := runFacets(context.Background(), store, filterFor(t, "genre=Horror"), 1)
+	runtimes := facetResult(t, results, failed, "runtime").([]bson.M)
+	if len(runtimes) != 1 || runtimes[0]["min"] != int32(85) || runtimes[0]["max"] != int32(95) {
+		t.Errorf("got runtimes %v, want 85 to 95", runtimes)
+	}
+}
+
+/*
+Compares running the facet queries one at a time with running them
+concurrently, against a store that takes two milliseconds per query
+like a round trip to MongoDB would.
+*/
+func BenchmarkListTypes(b *testing.B) {
+	store := memoryFacets{docs: facetCatalog(300), latency: 2 * time.Millisecond}
+	f := filterFor(b, "genre=Horror&year=1980-1989")
+	for _, bench := range []struct {
+		name     string
+		parallel int
+	}{
+		{"sequential", 1},
+		{"concurrent", maxConcurrentFacets},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, failed := runFacets(context.Background(), store, f, bench.parallel)
+				for _, err := range failed {
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// A facetStore that counts the value queries it runs
+type countingFacets struct {
+	memoryFacets
+	queries *int
+}
+
+func (m countingFacets) valueCounts(ctx context.Context, match bson.M, fields ...string) ([]valueCount, []valueCount, error) {
+	*m.queries++
+	return m.memoryFacets.valueCounts(ctx, match, fields...)
+}
+
+func TestDirectorFacet(t *testing.T) {
+	var docs []bson.M
+	add := func(director string, genre string, count int) {
+		for i := 0; i < count; i++ {
+			docs = append(docs, bson.M{"Director": director, "Genre": genre})
+		}
+	}
+	add("Carpenter", "Horror", 3)
+	add("Craven", "Horror", 2)
+	add("Craven", "Comedy", 1)
+	add("Scott", "Action", 4)
+	add("Raimi", "Horror", 1)
+	add("Raimi", "Comedy", 1)
+	add("Wright", "Comedy", 3)
+
+	tests := []struct {
+		name  string
+		match bson.M
+		want  []facetCount
+	}{
+		{
+			name:  "no filters",
+			match: bson.M{},
+			want:  []facetCount{{"Scott", 4}, {"Carpenter", 3}, {"Craven", 3}, {"Wright", 3}},
+		},
+		{
+			// Craven has only two horror movies but three in the catalog, so is still listed
+			name:  "filtered counts",
+			match: bson.M{"Genre": "Horror"},
+			want:  []facetCount{{"Carpenter", 3}, {"Craven", 2}, {"Scott", 0}, {"Wright", 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queries := 0
+			got, err := directorFacet(context.Background(), countingFacets{memoryFacets{docs: docs}, &queries}, Filter{}, tt.match)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if queries != 1 {
+				t.Errorf("ran %d queries, want 1", queries)
+			}
+		})
+	}
+}
+
+func TestProviderFacetAvailability(t *testing.T) {
+	netflix := bson.M{"provider_id": int32(8), "provider_name": "Netflix", "display_priority": int32(1)}
+	apple := bson.M{"provider_id": int32(2), "provider_name": "Apple TV", "display_priority": int32(2)}
+	store := memoryFacets{docs: []bson.M{
+		{"Genre": "Horror", "Provider": bson.M{"flatrate": bson.A{netflix}, "rent": bson.A{apple}}},
+		{"Genre": "Horror", "Provider": bson.M{"rent": bson.A{apple}, "buy": bson.A{apple}}},
+		{"Genre": "Comedy", "Provider": bson.M{"buy": bson.A{apple, netflix}}},
+	}}
+
+	tests := []struct {
+		query string
+		want  map[string]int32
+	}{
+		{"", map[string]int32{"Netflix": 1}},
+		{"availability=stream", map[string]int32{"Netflix": 1}},
+		{"availability=rent", map[string]int32{"Apple TV": 2}},
+		{"availability=buy", map[string]int32{"Netflix": 1, "Apple TV": 2}},
+		// A movie offered both ways counts once
+		{"availability=rent&availability=buy", map[string]int32{"Netflix": 1, "Apple TV": 3}},
+		{"availability=rent&genre=Horror", map[string]int32{"Apple TV": 2}},
+		{"availability=buy&genre=Comedy", map[string]int32{"Netflix": 1, "Apple TV": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			results, failed := runFacets(context.Background(), store, filterFor(t, tt.query), 1)
+			got := make(map[string]int32)
+			for _, p := range facetResult(t, results, failed, "provider").([]providerCount) {
+				got[p.Provider_name] = p.Count
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package movies
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+/*
+	 A condition on one filterable dimension. Dimensions are named after
+		the /types/list facet they select from.
+*/
+type clause struct {
+	dimension string
+	condition bson.M
+}
+
+// The filters of a listing request, shared by every endpoint that accepts them
+type Filter struct {
+	clauses []clause
+	// Provider lists the provider filters look at, from availability
+	lists []string
+}
+
+func (f *Filter) add(dimension string, condition bson.M) {
+	f.clauses = append(f.clauses, clause{dimension: dimension, condition: condition})
+}
+
+// Provider lists the filter looks at, streaming unless availability says otherwise
+func (f Filter) providerLists() []string {
+	if len(f.lists) == 0 {
+		return []string{"flatrate"}
+	}
+	return f.lists
+}
+
+// MongoDB query matching every clause
+func (f Filter) Query() bson.M {
+	return f.queryExcept("")
+}
+
+/*
+Query matching every clause except those on one dimension. Facet counts
+use it so a dimension's own selection doesn't hide its other values.
+*/
+func (f Filter) queryExcept(dimension string) bson.M {
+	var conditions []bson.M
+	for _, cl := range f.clauses {
+		if cl.dimension != dimension {
+			conditions = append(conditions, cl.condition)
+		}
+	}
+
+	// Combine all conditions with $and
+	if len(conditions) == 0 {
+		return bson.M{}
+	}
+	return bson.M{"$and": conditions}
+}
+
+/*
+	 A filter parameter taking a list of values, matched against one or
+		more string fields. Adding ! to the parameter (genre!=Horror)
+		excludes the values instead.
+*/
+type listField struct {
+	param     string
+	dimension string
+	fields    []string
+}
+
+var listFields = []listField{
+	{"genre", "genre", []string{"Genre", "Genre_2"}},
+	{"universe", "universes", []string{"Universe", "Sub_Universe"}},
+	{"exclusive", "exclusive", []string{"Exclusive"}},
+	{"studio", "studio", []string{"Studio"}},
+	{"holiday", "holiday", []string{"Holiday"}},
+	{"director", "director", []string{"Director"}},
+	{"rated", "rated", []string{"Rated"}},
+}
+
+// Matches movies where any of the fields holds one of the values
+func (lf listField) in(values []string) bson.M {
+	if len(lf.fields) == 1 {
+		return bson.M{lf.fields[0]: bson.M{"$in": values}}
+	}
+	var options []bson.M
+	for _, field := range lf.fields {
+		options = append(options, bson.M{field: bson.M{"$in": values}})
+	}
+	return bson.M{"$or": options}
+}
+
+// Matches movies where none of the fields holds any of the values
+func (lf listField) notIn(values []string) bson.M {
+	condition := bson.M{}
+	for _, field := range lf.fields {
+		condition[field] = bson.M{"$nin": values}
+	}
+	return condition
+}
+
+/*
+Matches movies offered by any of the providers on any of the provider
+lists, or by any provider at all when no ids are given.
+*/
+func providerCondition(lists []string, providers []int) bson.M {
+	var options []bson.M
+	for _, list := range lists {
+		if len(providers) > 0 {
+			options = append(options, bson.M{"Provider." + list + ".provider_id": bson.M{"$in": providers}})
+		} else {
+			options = append(options, bson.M{"Provider." + list + ".0": bson.M{"$exists": true}})
+		}
+	}
+	if len(options) == 1 {
+		return options[0]
+	}
+	return bson.M{"$or": options}
+}
+
+// Provider lists in the database, by the availability name clients use
+var availabilities = map[string]string{
+	"stream": "flatrate",
+	"rent":   "rent",
+	"buy":    "buy",
+}
+
+/*
+Parses an ms_added bound given either as a date (yyyy-mm-dd), an
+RFC 3339 timestamp or milliseconds since the epoch.
+*/
+func parseAddedBound(value string) (int64, error) {
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return ms, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t.UnixMilli(), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, err
+	}
+	return t.UnixMilli(), nil
+}
+
+// Whether ParseFilter reads the query parameter
+func isFilterParam(name string) bool {
+	for _, lf := range listFields {
+		if name == lf.param || name == lf.param+"!" {
+			return true
+		}
+	}
+	switch name {
+	case "year", "decade", "runtime", "rating", "provider", "provider!", "availability",
+		"filter", "dani_approved", "added_after", "added_before":
+		return true
+	}
+	return false
+}
+
+/*
+Reads the listing filters from the query string:
+
+	genre, universe, exclusive, studio, holiday, director, rated (MPAA)
+	year (single years or yyyy-yyyy ranges), decade (yyyy-yyyy)
+	runtime, rating (JH_Score) as two values for a range
+	provider (ids) and availability (stream, rent, buy; stream by default)
+	dani_approved (true or false)
+	added_after, added_before (inclusive bounds on ms_added)
+	filter, a boolean expression (see parseExpression)
+
+The list parameters and provider also accept exclusions written with
+!=, as in genre!=Horror or provider!=8.
+
+Returns every invalid parameter rather than stopping at the first.
+*/
+func ParseFilter(c *gin.Context) (Filter, []problem.FieldError) {
+	var f Filter
+	var errs []problem.FieldError
+
+	for _, lf := range listFields {
+		if values := c.QueryArray(lf.param); len(values) > 0 {
+			f.add(lf.dimension, lf.in(values))
+		}
+		if values := c.QueryArray(lf.param + "!"); len(values) > 0 {
+			f.add(lf.dimension, lf.notIn(values))
+		}
+	}
+
+	// Years and year ranges, matched as ranges rather than listing every year
+	year := c.QueryArray("year")
+	decade := c.QueryArray("decade")
+	if len(year) > 0 || len(decade) > 0 {
+		var years []int
+		var ranges []bson.M
+
+		for _, y := range year {
+			if strings.Contains(y, "-") {
+				start, end, err := parseYearRange(y)
+				if err != nil {
+					errs = append(errs, problem.FieldError{Field: "year", Detail: "year must be integer or yyyy-yyyy range"})
+					break
+				}
+				ranges = append(ranges, bson.M{"Year": bson.M{"$gte": start, "$lte": end}})
+				continue
+			}
+			n, err := strconv.Atoi(y)
+			if err != nil {
+				errs = append(errs, problem.FieldError{Field: "year", Detail: "year must be integer or yyyy-yyyy range"})
+				break
+			}
+			years = append(years, n)
+		}
+
+		for _, d := range decade {
+			start, end, err := parseYearRange(d)
+			if err != nil {
+				errs = append(errs, problem.FieldError{Field: "decade", Detail: "invalid decade format, expected yyyy-yyyy"})
+				break
+			}
+			ranges = append(ranges, bson.M{"Year": bson.M{"$gte": start, "$lte": end}})
+		}
+
+		if len(years) > 0 {
+			ranges = append(ranges, bson.M{"Year": bson.M{"$in": years}})
+		}
+		if len(ranges) == 1 {
+			f.add("year", ranges[0])
+		} else if len(ranges) > 1 {
+			f.add("year", bson.M{"$or": ranges})
+		}
+	}
+
+	runtime := c.QueryArray("runtime")
+	if len(runtime) > 0 {
+		runtimes, err := convertStringsToInts(runtime)
+		if err != nil || len(runtimes) != 2 {
+			errs = append(errs, problem.FieldError{Field: "runtime", Detail: "runtime must have two values for range, start and stop"})
+		} else {
+			sort.Ints(runtimes)
+			f.add("runtime", bson.M{"Runtime": bson.M{"$gte": runtimes[0], "$lte": runtimes[1]}})
+		}
+	}
+
+	rating := c.QueryArray("rating")
+	if len(rating) > 0 {
+		ratings, err := convertStringsToInts(rating)
+		if err != nil || len(ratings) != 2 {
+			errs = append(errs, problem.FieldError{Field: "rating", Detail: "rating must have two values for range, start and stop"})
+		} else {
+			sort.Ints(ratings)
+			f.add("rating", bson.M{"JH_Score": bson.M{"$gte": ratings[0], "$lte": ratings[1]}})
+		}
+	}
+
+	// Providers, on any of the requested ways to watch
+	lists := []string{"flatrate"}
+	availability := c.QueryArray("availability")
+	if len(availability) > 0 {
+		lists = nil
+		for _, a := range availability {
+			list, ok := availabilities[a]
+			if !ok {
+				errs = append(errs, problem.FieldError{Field: "availability", Detail: "availability must be stream, rent or buy"})
+				break
+			}
+			lists = append(lists, list)
+		}
+	}
+	f.lists = lists
+
+	provider := c.QueryArray("provider")
+	if len(provider) > 0 || len(availability) > 0 {
+		providers, err := convertStringsToInts(provider)
+		if err != nil {
+			errs = append(errs, problem.FieldError{Field: "provider", Detail: "provider must be id"})
+		} else {
+			f.add("provider", providerCondition(lists, providers))
+		}
+	}
+
+	// Providers to leave out, on the same ways to watch
+	excludedProviders := c.QueryArray("provider!")
+	if len(excludedProviders) > 0 {
+		providers, err := convertStringsToInts(excludedProviders)
+		if err != nil {
+			errs = append(errs, problem.FieldError{Field: "provider!", Detail: "provider must be id"})
+		} else {
+			f.add("provider", bson.M{"$nor": []bson.M{providerCondition(lists, providers)}})
+		}
+	}
+
+	if expression := c.Query("filter"); expression != "" {
+		condition, err := parseExpression(expression)
+		if err != nil {
+			errs = append(errs, problem.FieldError{Field: "filter", Detail: err.Error(), Position: err.position})
+		} else {
+			f.add("filter", condition)
+		}
+	}
+
+	if approved := c.Query("dani_approved"); approved != "" {
+		value, err := strconv.ParseBool(approved)
+		if err != nil {
+			errs = append(errs, problem.FieldError{Field: "dani_approved", Detail: "dani_approved must be true or false"})
+		} else {
+			f.add("dani_approved", bson.M{"Dani_Approved": value})
+		}
+	}
+
+	added := bson.M{}
+	for _, bound := range []struct{ param, operator string }{
+		{"added_after", "$gte"},
+		{"added_before", "$lte"},
+	} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		ms, err := parseAddedBound(value)
+		if err != nil {
+			errs = append(errs, problem.FieldError{Field: bound.param, Detail: bound.param + " must be a date (yyyy-mm-dd), RFC 3339 time or milliseconds"})
+			continue
+		}
+		// A bare date before which movies were added covers that whole day
+		if _, err := time.Parse(time.DateOnly, value); err == nil && bound.param == "added_before" {
+			added["$lt"] = ms + (24 * time.Hour).Milliseconds()
+			continue
+		}
+		added[bound.operator] = ms
+	}
+	if len(added) > 0 {
+		f.add("added", bson.M{"ms_added": added})
+	}
+
+	return f, errs
+}
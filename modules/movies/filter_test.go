@@ -0,0 +1,94 @@
+package movies
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// The filter and the fields of the errors ParseFilter reads from the query string
+func parseFilterFor(t *testing.T, query string) (Filter, []string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/movies/list?"+query, nil)
+	f, errs := ParseFilter(c)
+	var fields []string
+	for _, e := range errs {
+		fields = append(fields, e.Field)
+	}
+	return f, fields
+}
+
+func TestParseFilterAdded(t *testing.T) {
+	// 2024-06-01 and 2024-06-02 at midnight UTC
+	const june1, june2 = int64(1717200000000), int64(1717286400000)
+
+	tests := []struct {
+		query string
+		want  bson.M
+	}{
+		{"added_after=2024-06-01", bson.M{"$gte": june1}},
+		{"added_before=2024-06-01", bson.M{"$lt": june2}},
+		{"added_before=2024-06-01T00:00:00Z", bson.M{"$lte": june1}},
+		{"added_before=1717200000000", bson.M{"$lte": june1}},
+		{"added_after=2024-06-01&added_before=2024-06-01", bson.M{"$gte": june1, "$lt": june2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			f, errs := parseFilterFor(t, tt.query)
+			if len(errs) > 0 {
+				t.Fatalf("errors on %v", errs)
+			}
+			want := bson.M{"$and": []bson.M{{"ms_added": tt.want}}}
+			if got := f.Query(); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+
+	if _, errs := parseFilterFor(t, "added_before=June"); !reflect.DeepEqual(errs, []string{"added_before"}) {
+		t.Errorf("got errors on %v, want added_before", errs)
+	}
+}
+
+func TestParseFilterProviders(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bson.M
+		errs  []string
+	}{
+		{"provider=8", bson.M{"Provider.flatrate.provider_id": bson.M{"$in": []int{8}}}, nil},
+		{"availability=rent", bson.M{"Provider.rent.0": bson.M{"$exists": true}}, nil},
+		{
+			"provider=8&availability=rent&availability=buy",
+			bson.M{"$or": []bson.M{
+				{"Provider.rent.provider_id": bson.M{"$in": []int{8}}},
+				{"Provider.buy.provider_id": bson.M{"$in": []int{8}}},
+			}},
+			nil,
+		},
+		{"provider!=8", bson.M{"$nor": []bson.M{{"Provider.flatrate.provider_id": bson.M{"$in": []int{8}}}}}, nil},
+		// A bad provider is reported without adding a half-parsed condition
+		{"provider=netflix", nil, []string{"provider"}},
+		{"provider!=netflix", nil, []string{"provider!"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			f, errs := parseFilterFor(t, tt.query)
+			if !reflect.DeepEqual(errs, tt.errs) {
+				t.Fatalf("got errors on %v, want %v", errs, tt.errs)
+			}
+			want := bson.M{}
+			if tt.want != nil {
+				want = bson.M{"$and": []bson.M{tt.want}}
+			}
+			if got := f.Query(); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package movies
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"github.com/helfy18/movie-site-api/modules/stats"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Splits a comma separated list of people, e.g. Actors
+func splitPeople(value string) []string {
+	var people []string
+	for _, person := range strings.Split(value, ",") {
+		people = append(people, strings.TrimSpace(person))
+	}
+	return nonEmpty(people...)
+}
+
+// Entities that can be ranked, by the name used in the route
+var leaderboards = map[string]func(m Movie) []string{
+	"directors": func(m Movie) []string { return splitPeople(m.Director) },
+	"studios":   func(m Movie) []string { return nonEmpty(m.Studio) },
+	"actors":    func(m Movie) []string { return splitPeople(m.Actors) },
+	"universes": func(m Movie) []string { return nonEmpty(m.Universe) },
+}
+
+/*
+	 One ranked entity. Score is the average pulled towards the overall
+		average in proportion to how few movies back it.
+*/
+type leaderboardEntry struct {
+	Rank    int       `json:"rank"`
+	Name    string    `json:"name"`
+	Count   int       `json:"count"`
+	Average float64   `json:"average"`
+	Score   float64   `json:"score"`
+	Best    MovieCard `json:"best"`
+	Worst   MovieCard `json:"worst"`
+}
+
+/*
+Accepts the ListMovies filters, min (fewest movies to be ranked,
+default 3), prior (weight of the overall average, in movies, default
+min) and limit.
+Returns directors, studios, actors or universes ranked by Bayesian
+average JH_Score: (n * average + prior * overall) / (n + prior).
+*/
+func GetLeaderboard(c *gin.Context) {
+	keys, found := leaderboards[c.Param("entity")]
+	if !found {
+		problem.NotFound(c, "Leaderboards exist for directors, studios, actors and universes")
+		return
+	}
+
+	f, errs := ParseFilter(c)
+	minCount, err := strconv.Atoi(c.DefaultQuery("min", "3"))
+	if err != nil || minCount < 1 {
+		errs = append(errs, problem.FieldError{Field: "min", Detail: "min must be a positive integer"})
+	}
+	prior, err := strconv.ParseFloat(c.DefaultQuery("prior", strconv.Itoa(minCount)), 64)
+	if err != nil || prior < 0 {
+		errs = append(errs, problem.FieldError{Field: "prior", Detail: "prior must be a non-negative number"})
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil || limit < 0 {
+		errs = append(errs, problem.FieldError{Field: "limit", Detail: "limit must be a non-negative integer"})
+	}
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	collection := client.Database("jdmovies").Collection("movies")
+
+	projection := bson.M{"Movie": 1, "Year": 1, "TMDBId": 1, "JH_Score": 1, "Genre": 1, "Genre_2": 1, "Runtime": 1, "Rated": 1, "Poster": 1,
+		"Director": 1, "Studio": 1, "Actors": 1, "Universe": 1}
+	movies, err := FindMovies(c.Request.Context(), collection, f.Query(), options.Find().SetProjection(projection))
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+
+	overall := 0.0
+	grouped := make(map[string][]Movie)
+	for _, m := range movies {
+		overall += float64(m.JH_Score)
+		for _, key := range keys(m) {
+			grouped[key] = append(grouped[key], m)
+		}
+	}
+	if len(movies) > 0 {
+		overall /= float64(len(movies))
+	}
+
+	entries := []leaderboardEntry{}
+	for name, members := range grouped {
+		if len(members) < minCount {
+			continue
+		}
+		entry := leaderboardEntry{Name: name, Count: len(members), Best: CardOf(members[0]), Worst: CardOf(members[0])}
+		sum := 0.0
+		for _, m := range members {
+			sum += float64(m.JH_Score)
+			if m.JH_Score > entry.Best.JH_Score {
+				entry.Best = CardOf(m)
+			}
+			if m.JH_Score < entry.Worst.JH_Score {
+				entry.Worst = CardOf(m)
+			}
+		}
+		n := float64(len(members))
+		entry.Average = stats.Round(sum / n)
+		entry.Score = stats.Round((sum + prior*overall) / (n + prior))
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Score != entries[j].Score {
+			return entries[i].Score > entries[j].Score
+		}
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	for i := range entries {
+		entries[i].Rank = i + 1
+	}
+
+	c.IndentedJSON(http.StatusOK, bson.M{
+		"overallAverage": stats.Round(overall),
+		"prior":          prior,
+		"min":            minCount,
+		"entries":        entries,
+	})
+}
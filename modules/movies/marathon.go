@@ -0,0 +1,233 @@
+package movies
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Longest marathon planned, in minutes
+const maxMarathon = 48 * 60
+
+// A movie in a marathon with when it starts and ends, in minutes from the start
+type scheduledMovie struct {
+	Movie    MovieCard `json:"movie"`
+	Start    int       `json:"start"`
+	End      int       `json:"end"`
+	Included bool      `json:"included"`
+}
+
+/*
+Parses a time budget given as minutes ("360") or a duration ("6h",
+"4h30m").
+*/
+func parseBudget(value string) (int, bool) {
+	if minutes, err := strconv.Atoi(value); err == nil {
+		return minutes, minutes > 0 && minutes <= maxMarathon
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, false
+	}
+	minutes := int(d.Minutes())
+	return minutes, minutes > 0 && minutes <= maxMarathon
+}
+
+/*
+Picks at most one movie from each group so the total weight fits in
+capacity and the total JH_Score is as high as possible. With one movie
+per group this is the 0/1 knapsack; grouping by genre gives the variety
+goal.
+*/
+func planKnapsack(groups [][]Movie, weight func(m Movie) int, capacity int) []Movie {
+	// best[w] is the highest score using at most w minutes so far
+	best := make([]int, capacity+1)
+	// choice[g][w] is the movie picked from group g at w minutes, or -1
+	choice := make([][]int16, len(groups))
+
+	for g, group := range groups {
+		choice[g] = make([]int16, capacity+1)
+		next := append([]int{}, best...)
+		for w := 0; w <= capacity; w++ {
+			choice[g][w] = -1
+			for i, m := range group {
+				cost := weight(m)
+				if cost > w {
+					continue
+				}
+				// The extra point keeps movies scored 0 worth watching
+				if score := best[w-cost] + int(m.JH_Score) + 1; score > next[w] {
+					next[w] = score
+					choice[g][w] = int16(i)
+				}
+			}
+		}
+		best = next
+	}
+
+	picked := []Movie{}
+	w := capacity
+	for g := len(groups) - 1; g >= 0; g-- {
+		if i := choice[g][w]; i >= 0 {
+			m := groups[g][i]
+			picked = append(picked, m)
+			w -= weight(m)
+		}
+	}
+	return picked
+}
+
+/*
+Accepts budget (minutes, or a duration such as 6h30m), the ListMovies
+filters, goal (score, the default, or variety), include (tmdbids that
+must be in the marathon, repeatable) and break (minutes between movies).
+Returns the movies that fit the budget with the highest total JH_Score,
+in release order with start and end times. With goal=variety at most one
+movie of each genre is picked.
+*/
+func PlanMarathon(c *gin.Context) {
+	f, errs := ParseFilter(c)
+	budget, ok := parseBudget(c.Query("budget"))
+	if !ok {
+		errs = append(errs, problem.FieldError{Field: "budget", Detail: "budget must be minutes or a duration such as 6h30m, at most 48h"})
+	}
+	goal := c.DefaultQuery("goal", "score")
+	if goal != "score" && goal != "variety" {
+		errs = append(errs, problem.FieldError{Field: "goal", Detail: "goal must be score or variety"})
+	}
+	pause, err := strconv.Atoi(c.DefaultQuery("break", "0"))
+	if err != nil || pause < 0 || pause > 120 {
+		errs = append(errs, problem.FieldError{Field: "break", Detail: "break must be an integer from 0 to 120"})
+	}
+	include, err := convertStringsToInts(c.QueryArray("include"))
+	if err != nil {
+		errs = append(errs, problem.FieldError{Field: "include", Detail: "include must be integer"})
+	}
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	collection := client.Database("jdmovies").Collection("movies")
+	ctx := c.Request.Context()
+	projection := options.Find().SetProjection(bson.M{"Movie": 1, "Year": 1, "TMDBId": 1, "JH_Score": 1, "Genre": 1, "Genre_2": 1, "Runtime": 1, "Rated": 1, "Poster": 1})
+
+	// Every movie but the first is followed by a break, so the budget gains one
+	capacity := budget + pause
+	weight := func(m Movie) int { return int(m.Runtime) + pause }
+
+	required := []Movie{}
+	if len(include) > 0 {
+		required, err = FindMovies(ctx, collection, bson.M{"TMDBId": bson.M{"$in": include}}, projection)
+		if err != nil {
+			problem.Error(c, err, "Failed to fetch movies")
+			return
+		}
+		if len(required) != len(dedupe(include)) {
+			problem.BadRequest(c, "include", "every included tmdbid must be a movie in the catalog")
+			return
+		}
+	}
+	isRequired := make(map[int32]bool, len(required))
+	usedGenres := make(map[string]bool)
+	for _, m := range required {
+		isRequired[m.TMDBId] = true
+		usedGenres[m.Genre] = true
+		capacity -= weight(m)
+	}
+	if capacity < 0 {
+		problem.BadRequest(c, "include", "included movies run longer than the budget")
+		return
+	}
+
+	candidates, err := FindMovies(ctx, collection, f.Query(), projection)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+
+	var groups [][]Movie
+	byGenre := make(map[string][]Movie)
+	var genres []string
+	for _, m := range candidates {
+		// Movies without a runtime can't be planned around
+		if m.Runtime <= 0 || isRequired[m.TMDBId] || weight(m) > capacity {
+			continue
+		}
+		if goal == "score" {
+			groups = append(groups, []Movie{m})
+			continue
+		}
+		if usedGenres[m.Genre] {
+			continue
+		}
+		if _, found := byGenre[m.Genre]; !found {
+			genres = append(genres, m.Genre)
+		}
+		byGenre[m.Genre] = append(byGenre[m.Genre], m)
+	}
+	for _, genre := range genres {
+		groups = append(groups, byGenre[genre])
+	}
+
+	plan := append(required, planKnapsack(groups, weight, capacity)...)
+	sort.SliceStable(plan, func(i, j int) bool {
+		if plan[i].Year != plan[j].Year {
+			return plan[i].Year < plan[j].Year
+		}
+		return plan[i].Movie < plan[j].Movie
+	})
+
+	schedule := []scheduledMovie{}
+	clock, totalScore := 0, 0
+	genresSeen := make(map[string]bool)
+	for i, m := range plan {
+		if i > 0 {
+			clock += pause
+		}
+		schedule = append(schedule, scheduledMovie{Movie: CardOf(m), Start: clock, End: clock + int(m.Runtime), Included: isRequired[m.TMDBId]})
+		clock += int(m.Runtime)
+		totalScore += int(m.JH_Score)
+		for _, genre := range []string{m.Genre, m.Genre_2} {
+			if genre != "" {
+				genresSeen[genre] = true
+			}
+		}
+	}
+	genreList := make([]string, 0, len(genresSeen))
+	for genre := range genresSeen {
+		genreList = append(genreList, genre)
+	}
+	sort.Strings(genreList)
+
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"budget":     budget,
+		"used":       clock,
+		"remaining":  budget - clock,
+		"goal":       goal,
+		"totalScore": totalScore,
+		"genres":     genreList,
+		"movies":     schedule,
+	})
+}
+
+// The ids without repeats
+func dedupe(ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	unique := []int{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,132 @@
+package movies
+
+import (
+	"math/rand/v2"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseBudget(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+		ok    bool
+	}{
+		{"360", 360, true},
+		{"6h", 360, true},
+		{"4h30m", 270, true},
+		{"90m", 90, true},
+		{"48h", maxMarathon, true},
+		{"2881", 2881, false},
+		{"49h", 49 * 60, false},
+		{"0", 0, false},
+		{"-30", -30, false},
+		{"30s", 0, false},
+		{"", 0, false},
+		{"all night", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := parseBudget(tt.value)
+			if ok != tt.ok || (ok && got != tt.want) {
+				t.Errorf("parseBudget(%q) = %d, %v, want %d, %v", tt.value, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func runtimeOf(m Movie) int { return int(m.Runtime) }
+
+// One group per movie, as goal=score plans
+func singletons(movies ...Movie) [][]Movie {
+	groups := make([][]Movie, len(movies))
+	for i, m := range movies {
+		groups[i] = []Movie{m}
+	}
+	return groups
+}
+
+func pickedIds(picked []Movie) []int32 {
+	ids := []int32{}
+	for _, m := range picked {
+		ids = append(ids, m.TMDBId)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func TestPlanKnapsack(t *testing.T) {
+	epic := Movie{TMDBId: 1, Runtime: 200, JH_Score: 95, Genre: "Drama"}
+	short := Movie{TMDBId: 2, Runtime: 90, JH_Score: 70, Genre: "Comedy"}
+	medium := Movie{TMDBId: 3, Runtime: 110, JH_Score: 75, Genre: "Drama"}
+	flop := Movie{TMDBId: 4, Runtime: 80, JH_Score: 0, Genre: "Horror"}
+
+	tests := []struct {
+		name     string
+		groups   [][]Movie
+		capacity int
+		want     []int32
+	}{
+		{"two good movies beat one great one", singletons(epic, short, medium), 200, []int32{2, 3}},
+		{"great movie when it fits with room", singletons(epic, short, medium), 290, []int32{1, 2}},
+		{"zero scores are still worth watching", singletons(short, flop), 170, []int32{2, 4}},
+		{"exact fit", singletons(short, flop), 90, []int32{2}},
+		{"nothing fits", singletons(epic, medium), 100, []int32{}},
+		{"no movies", nil, 300, []int32{}},
+		{"one per group", [][]Movie{{epic, medium}, {short}}, 400, []int32{1, 2}},
+		{"group picks what fits", [][]Movie{{epic, medium}, {short}}, 200, []int32{2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pickedIds(planKnapsack(tt.groups, runtimeOf, tt.capacity))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Best total score by trying every choice from every group
+func bruteForcePlan(groups [][]Movie, capacity int) int {
+	if len(groups) == 0 {
+		return 0
+	}
+	best := bruteForcePlan(groups[1:], capacity)
+	for _, m := range groups[0] {
+		if runtimeOf(m) <= capacity {
+			best = max(best, int(m.JH_Score)+1+bruteForcePlan(groups[1:], capacity-runtimeOf(m)))
+		}
+	}
+	return best
+}
+
+func TestPlanKnapsackIsOptimal(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for trial := 0; trial < 200; trial++ {
+		var groups [][]Movie
+		id := int32(0)
+		for g := rng.IntN(6); g >= 0; g-- {
+			var group []Movie
+			for n := rng.IntN(3); n >= 0; n-- {
+				id++
+				group = append(group, Movie{TMDBId: id, Runtime: int32(60 + rng.IntN(120)), JH_Score: int32(rng.IntN(101))})
+			}
+			groups = append(groups, group)
+		}
+		capacity := rng.IntN(500)
+
+		picked := planKnapsack(groups, runtimeOf, capacity)
+		used, score := 0, 0
+		for _, m := range picked {
+			used += runtimeOf(m)
+			score += int(m.JH_Score) + 1
+		}
+		if used > capacity {
+			t.Fatalf("trial %d: plan uses %d of %d minutes", trial, used, capacity)
+		}
+		if want := bruteForcePlan(groups, capacity); score != want {
+			t.Fatalf("trial %d: plan scores %d, best is %d", trial, score, want)
+		}
+	}
+}
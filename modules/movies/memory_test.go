@@ -0,0 +1,345 @@
+package movies
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+/*
+	 A facetStore over documents held in memory, stored the way they are in
+		the movies collection. Latency is slept before every query to stand in
+		for the round trip to MongoDB.
+*/
+type memoryFacets struct {
+	docs    []bson.M
+	latency time.Duration
+}
+
+func (m memoryFacets) wait(ctx context.Context) error {
+	if m.latency == 0 {
+		return nil
+	}
+	select {
+	case <-time.After(m.latency):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Counts docs per key, over every doc and over those matching match
+func (m memoryFacets) count(ctx context.Context, match bson.M, keys func(doc bson.M) []interface{}) (map[string]int32, map[string]int32, map[string]interface{}, []string, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	all := make(map[string]int32)
+	matched := make(map[string]int32)
+	values := make(map[string]interface{})
+	var order []string
+	for _, doc := range m.docs {
+		isMatch := matchesQuery(doc, match)
+		for _, value := range keys(doc) {
+			key := valueKey(value)
+			if _, seen := values[key]; !seen {
+				values[key] = value
+				order = append(order, key)
+			}
+			all[key]++
+			if isMatch {
+				matched[key]++
+			}
+		}
+	}
+	return all, matched, values, order, nil
+}
+
+func (m memoryFacets) valueCounts(ctx context.Context, match bson.M, fields ...string) ([]valueCount, []valueCount, error) {
+	keys := func(doc bson.M) []interface{} {
+		seen := make(map[string]bool)
+		var values []interface{}
+		for _, field := range fields {
+			value, found := doc[strings.TrimPrefix(field, "$")]
+			if !found || value == nil || seen[valueKey(value)] {
+				continue
+			}
+			seen[valueKey(value)] = true
+			values = append(values, value)
+		}
+		return values
+	}
+	all, matched, values, order, err := m.count(ctx, match, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	var allCounts, matchedCounts []valueCount
+	for _, key := range order {
+		allCounts = append(allCounts, valueCount{Value: values[key], Count: all[key]})
+		if matched[key] > 0 {
+			matchedCounts = append(matchedCounts, valueCount{Value: values[key], Count: matched[key]})
+		}
+	}
+	return allCounts, matchedCounts, nil
+}
+
+func (m memoryFacets) universeCounts(ctx context.Context, match bson.M) ([]universeCount, []universeCount, error) {
+	pairs := make(map[string]universeCount)
+	keys := func(doc bson.M) []interface{} {
+		var u universeCount
+		u.ID.Universe, u.ID.Sub_Universe = doc["Universe"], doc["Sub_Universe"]
+		key := valueKey(u.ID.Universe) + "/" + valueKey(u.ID.Sub_Universe)
+		pairs[key] = u
+		return []interface{}{key}
+	}
+	all, matched, values, order, err := m.count(ctx, match, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	var allCounts, matchedCounts []universeCount
+	for _, key := range order {
+		u := pairs[values[key].(string)]
+		u.Count = all[key]
+		allCounts = append(allCounts, u)
+		if matched[key] > 0 {
+			u.Count = matched[key]
+			matchedCounts = append(matchedCounts, u)
+		}
+	}
+	return allCounts, matchedCounts, nil
+}
+
+func (m memoryFacets) providerCounts(ctx context.Context, match bson.M, lists []string) ([]providerCount, []providerCount, error) {
+	providers := make(map[int32]providerCount)
+	keys := func(doc bson.M) []interface{} {
+		var ids []interface{}
+		seen := make(map[int32]bool)
+		var offers []interface{}
+		for _, list := range lists {
+			offers = append(offers, lookup(doc, "Provider."+list)...)
+		}
+		for _, value := range offers {
+			p, ok := value.(bson.M)
+			if !ok {
+				continue
+			}
+			id, _ := p["provider_id"].(int32)
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			if _, seen := providers[id]; !seen {
+				name, _ := p["provider_name"].(string)
+				logo, _ := p["logo_path"].(string)
+				priority, _ := p["display_priority"].(int32)
+				providers[id] = providerCount{Provider_id: id, Provider_name: name, Logo_path: logo, Display_priority: priority}
+			}
+			ids = append(ids, id)
+		}
+		return ids
+	}
+	all, matched, values, order, err := m.count(ctx, match, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	var allCounts, matchedCounts []providerCount
+	for _, key := range order {
+		p := providers[values[key].(int32)]
+		p.Count = all[key]
+		allCounts = append(allCounts, p)
+		if matched[key] > 0 {
+			p.Count = matched[key]
+			matchedCounts = append(matchedCounts, p)
+		}
+	}
+	return allCounts, matchedCounts, nil
+}
+
+func (m memoryFacets) runtimeRange(ctx context.Context, match bson.M) ([]bson.M, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+	var shortest, longest interface{}
+	for _, doc := range m.docs {
+		runtime, found := doc["Runtime"]
+		if !found || !matchesQuery(doc, match) {
+			continue
+		}
+		if shortest == nil || compareValues(runtime, shortest) < 0 {
+			shortest = runtime
+		}
+		if longest == nil || compareValues(runtime, longest) > 0 {
+			longest = runtime
+		}
+	}
+	if shortest == nil {
+		return []bson.M{}, nil
+	}
+	return []bson.M{{"_id": nil, "min": shortest, "max": longest}}, nil
+}
+
+/*
+Whether the document matches a MongoDB query. Supports the operators
+ParseFilter and parseExpression produce and panics on any other, so a
+test can't pass by silently ignoring a condition.
+*/
+func matchesQuery(doc bson.M, query bson.M) bool {
+	for key, condition := range query {
+		switch key {
+		case "$and":
+			for _, q := range queryList(condition) {
+				if !matchesQuery(doc, q) {
+					return false
+				}
+			}
+		case "$or":
+			found := false
+			for _, q := range queryList(condition) {
+				found = found || matchesQuery(doc, q)
+			}
+			if !found {
+				return false
+			}
+		case "$nor":
+			for _, q := range queryList(condition) {
+				if matchesQuery(doc, q) {
+					return false
+				}
+			}
+		default:
+			if !matchesField(lookup(doc, key), condition) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchesField(values []interface{}, condition interface{}) bool {
+	operators, isOperators := condition.(bson.M)
+	if !isOperators {
+		return containsAny(values, []interface{}{condition})
+	}
+	for operator, operand := range operators {
+		var ok bool
+		switch operator {
+		case "$eq":
+			ok = containsAny(values, []interface{}{operand})
+		case "$ne":
+			ok = !containsAny(values, []interface{}{operand})
+		case "$in":
+			ok = containsAny(values, listOf(operand))
+		case "$nin":
+			ok = !containsAny(values, listOf(operand))
+		case "$exists":
+			ok = (len(values) > 0) == operand.(bool)
+		case "$gt", "$gte", "$lt", "$lte":
+			for _, v := range values {
+				cmp := compareValues(v, operand)
+				ok = ok || (operator == "$gt" && cmp > 0) || (operator == "$gte" && cmp >= 0) ||
+					(operator == "$lt" && cmp < 0) || (operator == "$lte" && cmp <= 0)
+			}
+		default:
+			panic("memoryFacets: unsupported operator " + operator)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// The values at a dotted path, looking inside arrays along the way
+func lookup(value interface{}, path string) []interface{} {
+	if path == "" {
+		if list, isList := value.(bson.A); isList {
+			return list
+		}
+		return []interface{}{value}
+	}
+	head, rest, _ := strings.Cut(path, ".")
+	switch v := value.(type) {
+	case bson.M:
+		child, found := v[head]
+		if !found || child == nil {
+			return nil
+		}
+		return lookup(child, rest)
+	case bson.A:
+		if i, err := strconv.Atoi(head); err == nil {
+			if i < len(v) {
+				return lookup(v[i], rest)
+			}
+			return nil
+		}
+		var values []interface{}
+		for _, item := range v {
+			values = append(values, lookup(item, path)...)
+		}
+		return values
+	}
+	return nil
+}
+
+func queryList(value interface{}) []bson.M {
+	var queries []bson.M
+	for _, q := range listOf(value) {
+		queries = append(queries, q.(bson.M))
+	}
+	return queries
+}
+
+// The items of any slice type as interfaces
+func listOf(value interface{}) []interface{} {
+	v := reflect.ValueOf(value)
+	items := make([]interface{}, v.Len())
+	for i := range items {
+		items[i] = v.Index(i).Interface()
+	}
+	return items
+}
+
+func containsAny(values []interface{}, wanted []interface{}) bool {
+	for _, v := range values {
+		for _, w := range wanted {
+			if compareValues(v, w) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Orders numbers by value whatever their type, and anything else by its text
+func compareValues(a interface{}, b interface{}) int {
+	x, aNumber := number(a)
+	y, bNumber := number(b)
+	if aNumber && bNumber {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
@@ -0,0 +1,226 @@
+package movies
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"github.com/helfy18/movie-site-api/modules/stats"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Word and letter suffixes used in money amounts, e.g. "$1.2 million"
+var moneyMultipliers = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"billion", 1e9},
+	{"million", 1e6},
+	{"thousand", 1e3},
+	{"b", 1e9},
+	{"m", 1e6},
+	{"k", 1e3},
+}
+
+/*
+Parses amounts such as "$1,000,000", "1000000" or "$1.2 million" into
+dollars. Empty, "N/A" and non-positive amounts are not parseable.
+*/
+func parseMoney(value string) (float64, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	value = strings.TrimPrefix(value, "$")
+	value = strings.ReplaceAll(value, ",", "")
+
+	multiplier := 1.0
+	for _, m := range moneyMultipliers {
+		if number, ok := strings.CutSuffix(value, m.suffix); ok {
+			value = strings.TrimSpace(number)
+			multiplier = m.multiplier
+			break
+		}
+	}
+
+	amount, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || amount <= 0 {
+		return 0, false
+	}
+	return amount * multiplier, true
+}
+
+// Return on investment of one movie, nominal and in base year dollars
+type movieROI struct {
+	Movie             string  `json:"movie"`
+	Year              int32   `json:"year"`
+	TMDBId            int32   `json:"tmdbid"`
+	JH_Score          int32   `json:"jh_score"`
+	Studio            string  `json:"studio"`
+	Budget            float64 `json:"budget"`
+	BoxOffice         float64 `json:"boxoffice"`
+	BudgetAdjusted    float64 `json:"budgetAdjusted"`
+	BoxOfficeAdjusted float64 `json:"boxofficeAdjusted"`
+	ROI               float64 `json:"roi"`
+}
+
+// Combined return of the movies sharing a studio or decade
+type groupROI struct {
+	FieldValue             string  `json:"fieldValue"`
+	Count                  int     `json:"count"`
+	TotalBudget            float64 `json:"totalBudget"`
+	TotalBoxOffice         float64 `json:"totalBoxoffice"`
+	TotalBudgetAdjusted    float64 `json:"totalBudgetAdjusted"`
+	TotalBoxOfficeAdjusted float64 `json:"totalBoxofficeAdjusted"`
+	// Return on the group's combined budget
+	ROI          float64 `json:"roi"`
+	MedianROI    float64 `json:"medianRoi"`
+	AverageScore float64 `json:"averageScore"`
+}
+
+// A movie left out of the analysis, with its raw money fields
+type unparsedMoney struct {
+	Movie     string `json:"movie"`
+	Year      int32  `json:"year"`
+	TMDBId    int32  `json:"tmdbid"`
+	Budget    string `json:"budget"`
+	BoxOffice string `json:"boxoffice"`
+	Reason    string `json:"reason"`
+}
+
+func groupByROI(movies []movieROI, key func(m movieROI) string) []groupROI {
+	grouped := make(map[string][]movieROI)
+	for _, m := range movies {
+		if k := key(m); k != "" {
+			grouped[k] = append(grouped[k], m)
+		}
+	}
+
+	groups := []groupROI{}
+	for k, members := range grouped {
+		g := groupROI{FieldValue: k, Count: len(members)}
+		var rois, scores []float64
+		for _, m := range members {
+			g.TotalBudget += m.Budget
+			g.TotalBoxOffice += m.BoxOffice
+			g.TotalBudgetAdjusted += m.BudgetAdjusted
+			g.TotalBoxOfficeAdjusted += m.BoxOfficeAdjusted
+			rois = append(rois, m.ROI)
+			scores = append(scores, float64(m.JH_Score))
+		}
+		g.TotalBudgetAdjusted = stats.Round(g.TotalBudgetAdjusted)
+		g.TotalBoxOfficeAdjusted = stats.Round(g.TotalBoxOfficeAdjusted)
+		// Adjusted totals so decades are weighed in the same dollars
+		g.ROI = stats.Round((g.TotalBoxOfficeAdjusted - g.TotalBudgetAdjusted) / g.TotalBudgetAdjusted)
+		g.MedianROI = stats.Round(stats.Median(rois))
+		g.AverageScore = stats.Round(stats.Mean(scores))
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].ROI != groups[j].ROI {
+			return groups[i].ROI > groups[j].ROI
+		}
+		return groups[i].FieldValue < groups[j].FieldValue
+	})
+	return groups
+}
+
+/*
+Accepts the ListMovies filters and base_year (dollars to adjust to,
+default the latest CPI year).
+Returns return on investment, (box office - budget) / budget, per movie,
+studio and decade, how spending relates to JH_Score, and amounts
+adjusted for inflation with the CPI. Movies with missing or unparseable
+budget or box office are counted and listed separately.
+*/
+func GetMoneyStats(c *gin.Context) {
+	f, errs := ParseFilter(c)
+
+	baseYear, err := strconv.Atoi(c.DefaultQuery("base_year", strconv.Itoa(lastCPIYear)))
+	if err != nil || baseYear < firstCPIYear || baseYear > lastCPIYear {
+		errs = append(errs, problem.FieldError{Field: "base_year", Detail: "base_year must be between " + strconv.Itoa(firstCPIYear) + " and " + strconv.Itoa(lastCPIYear)})
+	}
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	collection := client.Database("jdmovies").Collection("movies")
+
+	projection := bson.M{"Movie": 1, "Year": 1, "TMDBId": 1, "JH_Score": 1, "Studio": 1, "Budget": 1, "BoxOffice": 1}
+	movies, err := FindMovies(c.Request.Context(), collection, f.Query(), options.Find().SetProjection(projection))
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+
+	parsed := []movieROI{}
+	missing := []unparsedMoney{}
+	for _, m := range movies {
+		budget, hasBudget := parseMoney(m.Budget)
+		boxOffice, hasBoxOffice := parseMoney(m.BoxOffice)
+		if !hasBudget || !hasBoxOffice {
+			reason := "budget"
+			if !hasBoxOffice {
+				reason = "boxoffice"
+			}
+			if !hasBudget && !hasBoxOffice {
+				reason = "budget and boxoffice"
+			}
+			missing = append(missing, unparsedMoney{
+				Movie:     m.Movie,
+				Year:      m.Year,
+				TMDBId:    m.TMDBId,
+				Budget:    m.Budget,
+				BoxOffice: m.BoxOffice,
+				Reason:    reason + " missing or unparseable",
+			})
+			continue
+		}
+
+		parsed = append(parsed, movieROI{
+			Movie:             m.Movie,
+			Year:              m.Year,
+			TMDBId:            m.TMDBId,
+			JH_Score:          m.JH_Score,
+			Studio:            m.Studio,
+			Budget:            budget,
+			BoxOffice:         boxOffice,
+			BudgetAdjusted:    stats.Round(adjustForInflation(budget, int(m.Year), baseYear)),
+			BoxOfficeAdjusted: stats.Round(adjustForInflation(boxOffice, int(m.Year), baseYear)),
+			ROI:               stats.Round((boxOffice - budget) / budget),
+		})
+	}
+	sort.SliceStable(parsed, func(i, j int) bool {
+		return parsed[i].ROI > parsed[j].ROI
+	})
+
+	var budgets, rois, scores []float64
+	for _, m := range parsed {
+		budgets = append(budgets, m.BudgetAdjusted)
+		rois = append(rois, m.ROI)
+		scores = append(scores, float64(m.JH_Score))
+	}
+	spendVsScore := bson.M{"count": len(parsed)}
+	if r, ok := stats.Pearson(budgets, scores); ok {
+		spendVsScore["budgetCorrelation"] = stats.Round(r)
+	}
+	if r, ok := stats.Pearson(rois, scores); ok {
+		spendVsScore["roiCorrelation"] = stats.Round(r)
+	}
+
+	c.IndentedJSON(http.StatusOK, bson.M{
+		"baseYear":     baseYear,
+		"movies":       parsed,
+		"studios":      groupByROI(parsed, func(m movieROI) string { return m.Studio }),
+		"decades":      groupByROI(parsed, func(m movieROI) string { return decadeOf(m.Year) }),
+		"spendVsScore": spendVsScore,
+		"missing": bson.M{
+			"count":  len(missing),
+			"movies": missing,
+		},
+	})
+}
@@ -0,0 +1,97 @@
+package movies
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+		ok    bool
+	}{
+		{"$1,000,000", 1e6, true},
+		{"1000000", 1e6, true},
+		{"$1.2 million", 1.2e6, true},
+		{"$1.2 Million", 1.2e6, true},
+		{"2 billion", 2e9, true},
+		{"$350 thousand", 350e3, true},
+		{"$15M", 15e6, true},
+		{"$1.5b", 1.5e9, true},
+		{"750k", 750e3, true},
+		{" $42 ", 42, true},
+		{"", 0, false},
+		{"N/A", 0, false},
+		{"$0", 0, false},
+		{"-5000", 0, false},
+		{"a lot", 0, false},
+		{"million", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := parseMoney(tt.value)
+			if ok != tt.ok || math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("parseMoney(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestAdjustForInflation(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   float64
+		from, to int
+		want     float64
+	}{
+		{"same year", 100, 1999, 1999, 100},
+		{"forward", 100, 1984, 2024, 100 * 313.689 / 103.9},
+		{"backward", 313.689, 2024, 1984, 103.9},
+		{"before the table uses its first year", 100, 1900, 1913, 100},
+		{"after the table uses its last year", 100, 2024, 2030, 100},
+		{"both outside the table", 100, 1800, 2100, 100 * 313.689 / 9.9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := adjustForInflation(tt.amount, tt.from, tt.to); math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("adjustForInflation(%v, %d, %d) = %v, want %v", tt.amount, tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCPITableIsComplete(t *testing.T) {
+	for year := firstCPIYear; year <= lastCPIYear; year++ {
+		if cpiByYear[year] <= 0 {
+			t.Errorf("no CPI for %d", year)
+		}
+	}
+	if len(cpiByYear) != lastCPIYear-firstCPIYear+1 {
+		t.Errorf("cpiByYear has %d years outside %d-%d", len(cpiByYear)-(lastCPIYear-firstCPIYear+1), firstCPIYear, lastCPIYear)
+	}
+}
+
+func TestGroupByROI(t *testing.T) {
+	movies := []movieROI{
+		{Studio: "A", Budget: 10, BoxOffice: 30, BudgetAdjusted: 20, BoxOfficeAdjusted: 60, ROI: 2, JH_Score: 80},
+		{Studio: "A", Budget: 30, BoxOffice: 30, BudgetAdjusted: 30, BoxOfficeAdjusted: 30, ROI: 0, JH_Score: 60},
+		{Studio: "B", Budget: 10, BoxOffice: 50, BudgetAdjusted: 10, BoxOfficeAdjusted: 50, ROI: 4, JH_Score: 90},
+		{Studio: "", Budget: 10, BoxOffice: 10, BudgetAdjusted: 10, BoxOfficeAdjusted: 10, ROI: 0, JH_Score: 10},
+	}
+	groups := groupByROI(movies, func(m movieROI) string { return m.Studio })
+
+	want := []groupROI{
+		{FieldValue: "B", Count: 1, TotalBudget: 10, TotalBoxOffice: 50, TotalBudgetAdjusted: 10, TotalBoxOfficeAdjusted: 50, ROI: 4, MedianROI: 4, AverageScore: 90},
+		// Combined adjusted return, (90 - 50) / 50, not the average of 2 and 0
+		{FieldValue: "A", Count: 2, TotalBudget: 40, TotalBoxOffice: 60, TotalBudgetAdjusted: 50, TotalBoxOfficeAdjusted: 90, ROI: 0.8, MedianROI: 1, AverageScore: 70},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("got %d groups, want %d: %+v", len(groups), len(want), groups)
+	}
+	for i := range want {
+		if groups[i] != want[i] {
+			t.Errorf("group %d: got %+v, want %+v", i, groups[i], want[i])
+		}
+	}
+}
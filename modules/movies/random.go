@@ -0,0 +1,338 @@
+package movies
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"math"
+	mathrand "math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Header carrying the random pick session token
+const RandomSessionHeader = "X-Random-Session"
+
+const (
+	maxRandomCount = 20
+	// Picks a session remembers and avoids
+	sessionMemory = 100
+	// How long an unused session is kept
+	sessionLifetime = 24 * time.Hour
+	// Days after being picked until a movie is weighted fully again
+	freshnessDays = 30.0
+	// Smallest weight so no movie is ruled out entirely
+	minWeight = 0.01
+)
+
+/*
+	 Movies served to one client, so later picks can avoid them. Served is
+		oldest first.
+*/
+type randomSession struct {
+	Token     string    `bson:"_id"`
+	Served    []int32   `bson:"served"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+// When a movie was last picked at random, for the fresh weighting
+type pickRecord struct {
+	TMDBId     int32     `bson:"_id"`
+	LastPicked time.Time `bson:"lastPicked"`
+	Count      int       `bson:"count"`
+}
+
+// Weightings a random pick can combine, each from 0 to 1
+var randomWeights = map[string]func(m Movie, lastPicked time.Time, now time.Time) float64{
+	// Higher JH_Score, likelier pick
+	"score": func(m Movie, _ time.Time, _ time.Time) float64 {
+		s := float64(m.JH_Score) / 100
+		return s * s
+	},
+	// Movies picked recently wait their turn
+	"fresh": func(_ Movie, lastPicked time.Time, now time.Time) float64 {
+		if lastPicked.IsZero() {
+			return 1
+		}
+		return math.Min(1, now.Sub(lastPicked).Hours()/24/freshnessDays)
+	},
+	// Streaming beats renting or buying, which beats unavailable
+	"available": func(m Movie, _ time.Time, _ time.Time) float64 {
+		switch {
+		case len(m.Provider.Flatrate) > 0:
+			return 1
+		case len(m.Provider.Rent) > 0 || len(m.Provider.Buy) > 0:
+			return 0.5
+		default:
+			return 0.1
+		}
+	},
+}
+
+/*
+Creates the indexes the movies package relies on: expiry of random pick
+sessions.
+*/
+func EnsureIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("randomSessions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "updatedAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(sessionLifetime.Seconds())),
+	})
+	return err
+}
+
+/*
+Draws count distinct movies, each with chance proportional to its
+weight, using the Efraimidis-Spirakis keys u^(1/w).
+*/
+func weightedSample(movies []Movie, weights []float64, count int) []Movie {
+	type keyed struct {
+		movie Movie
+		key   float64
+	}
+	keys := make([]keyed, len(movies))
+	for i, m := range movies {
+		keys[i] = keyed{movie: m, key: math.Pow(mathrand.Float64(), 1/weights[i])}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].key > keys[j].key
+	})
+
+	picked := []Movie{}
+	for i := 0; i < count && i < len(keys); i++ {
+		picked = append(picked, keys[i].movie)
+	}
+	return picked
+}
+
+/*
+Loads the session for the token, or starts one when the token is "new".
+An unknown token starts a new session rather than failing, since sessions
+expire.
+*/
+func loadRandomSession(ctx context.Context, sessions *mongo.Collection, token string) (randomSession, error) {
+	var session randomSession
+	if token != "new" {
+		err := sessions.FindOne(ctx, bson.M{"_id": token}).Decode(&session)
+		if err == nil {
+			return session, nil
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return session, err
+		}
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return session, err
+	}
+	return randomSession{Token: base64.RawURLEncoding.EncodeToString(buf), Served: []int32{}}, nil
+}
+
+/*
+Accepts the same optional filters as ListMovies, weight (score, fresh or
+available, repeatable to combine them), count (1 to 20 distinct movies)
+and session (a token from the X-Random-Session header, or "new" to start
+one; the header works too).
+Returns one random movie matching them, or a list of count movies when
+count is given. Sessions avoid movies they were recently served.
+*/
+func GetRandomMovie(c *gin.Context) {
+	f, errs := ParseFilter(c)
+	weights := c.QueryArray("weight")
+	for _, w := range weights {
+		if _, found := randomWeights[w]; !found {
+			errs = append(errs, problem.FieldError{Field: "weight", Detail: "weight must be score, fresh or available"})
+		}
+	}
+	count := 1
+	if value, asked := c.GetQuery("count"); asked {
+		var err error
+		count, err = strconv.Atoi(value)
+		if err != nil || count < 1 || count > maxRandomCount {
+			errs = append(errs, problem.FieldError{Field: "count", Detail: "count must be an integer from 1 to 20"})
+		}
+	}
+	token := c.Query("session")
+	if token == "" {
+		token = c.GetHeader(RandomSessionHeader)
+	}
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	collection := db.Collection("movies")
+	ctx := c.Request.Context()
+	now := time.Now()
+
+	var session randomSession
+	query := f.Query()
+	if token != "" {
+		var err error
+		session, err = loadRandomSession(ctx, db.Collection("randomSessions"), token)
+		if err != nil {
+			problem.Error(c, err, "Failed to load session")
+			return
+		}
+		// Only avoid served movies while enough others match
+		avoiding := bson.M{"$and": bson.A{query, bson.M{"TMDBId": bson.M{"$nin": append([]int32{}, session.Served...)}}}}
+		remaining, err := collection.CountDocuments(ctx, avoiding)
+		if err != nil {
+			problem.Error(c, err, "Failed to fetch movies")
+			return
+		}
+		if remaining >= int64(count) {
+			query = avoiding
+		}
+	}
+
+	var movies []Movie
+	if len(weights) == 0 {
+		pipeline := bson.A{
+			bson.M{"$match": query},
+			bson.M{"$sample": bson.M{"size": count}},
+		}
+		cursor, err := collection.Aggregate(ctx, pipeline)
+		if err != nil {
+			problem.Error(c, err, "Failed to fetch movies")
+			return
+		}
+		if err := cursor.All(ctx, &movies); err != nil {
+			problem.Error(c, err, "Failed to decode movie")
+			return
+		}
+		movies = distinctMovies(movies)
+	} else {
+		var err error
+		movies, err = weightedPicks(ctx, db, query, weights, count, now)
+		if err != nil {
+			problem.Error(c, err, "Failed to fetch movies")
+			return
+		}
+	}
+
+	if len(movies) == 0 {
+		problem.NotFound(c, "No movies found matching the criteria")
+		return
+	}
+
+	if err := recordPicks(ctx, db, movies, now); err != nil {
+		problem.Error(c, err, "Failed to record picks")
+		return
+	}
+	if token != "" {
+		for _, m := range movies {
+			session.Served = append(session.Served, m.TMDBId)
+		}
+		if len(session.Served) > sessionMemory {
+			session.Served = session.Served[len(session.Served)-sessionMemory:]
+		}
+		session.UpdatedAt = now
+		_, err := db.Collection("randomSessions").ReplaceOne(ctx, bson.M{"_id": session.Token}, session, options.Replace().SetUpsert(true))
+		if err != nil {
+			problem.Error(c, err, "Failed to save session")
+			return
+		}
+		c.Header(RandomSessionHeader, session.Token)
+	}
+
+	if _, asked := c.GetQuery("count"); asked {
+		c.IndentedJSON(http.StatusOK, movies)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, movies[0])
+}
+
+// $sample can return a movie twice, so keep the first of each
+func distinctMovies(movies []Movie) []Movie {
+	seen := make(map[int32]bool, len(movies))
+	distinct := []Movie{}
+	for _, m := range movies {
+		if !seen[m.TMDBId] {
+			seen[m.TMDBId] = true
+			distinct = append(distinct, m)
+		}
+	}
+	return distinct
+}
+
+// Draws count movies matching the query, weighted by the product of the weightings
+func weightedPicks(ctx context.Context, db *mongo.Database, query bson.M, weights []string, count int, now time.Time) ([]Movie, error) {
+	projection := bson.M{"TMDBId": 1, "JH_Score": 1, "Provider": 1}
+	candidates, err := FindMovies(ctx, db.Collection("movies"), query, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := db.Collection("randomPicks").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var records []pickRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	lastPicked := make(map[int32]time.Time, len(records))
+	for _, r := range records {
+		lastPicked[r.TMDBId] = r.LastPicked
+	}
+
+	values := make([]float64, len(candidates))
+	for i, m := range candidates {
+		value := 1.0
+		for _, w := range weights {
+			value *= randomWeights[w](m, lastPicked[m.TMDBId], now)
+		}
+		values[i] = math.Max(minWeight, value)
+	}
+	picked := weightedSample(candidates, values, count)
+	if len(picked) == 0 {
+		return picked, nil
+	}
+
+	// Fetch the full movies, keeping the order they were drawn in
+	ids := make([]int32, len(picked))
+	for i, m := range picked {
+		ids[i] = m.TMDBId
+	}
+	full, err := FindMovies(ctx, db.Collection("movies"), bson.M{"TMDBId": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[int32]Movie, len(full))
+	for _, m := range full {
+		byId[m.TMDBId] = m
+	}
+	movies := []Movie{}
+	for _, id := range ids {
+		if m, found := byId[id]; found {
+			movies = append(movies, m)
+		}
+	}
+	return movies, nil
+}
+
+// Notes when each movie was picked so fresh weighting can hold it back
+func recordPicks(ctx context.Context, db *mongo.Database, movies []Movie, now time.Time) error {
+	updates := make([]mongo.WriteModel, len(movies))
+	for i, m := range movies {
+		updates[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": m.TMDBId}).
+			SetUpdate(bson.M{"$set": bson.M{"lastPicked": now}, "$inc": bson.M{"count": 1}}).
+			SetUpsert(true)
+	}
+	_, err := db.Collection("randomPicks").BulkWrite(ctx, updates)
+	return err
+}
@@ -0,0 +1,107 @@
+package movies
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestWeightedSample(t *testing.T) {
+	movies := []Movie{{TMDBId: 1}, {TMDBId: 2}, {TMDBId: 3}, {TMDBId: 4}}
+	weights := []float64{1, 2, 7, minWeight}
+
+	tests := []struct {
+		name  string
+		count int
+		want  int
+	}{
+		{"one", 1, 1},
+		{"several", 3, 3},
+		{"all", 4, 4},
+		{"more than there are", 10, 4},
+		{"none", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			picked := weightedSample(movies, weights, tt.count)
+			if len(picked) != tt.want {
+				t.Fatalf("got %d movies, want %d", len(picked), tt.want)
+			}
+			seen := make(map[int32]bool)
+			for _, m := range picked {
+				if seen[m.TMDBId] {
+					t.Errorf("movie %d drawn twice", m.TMDBId)
+				}
+				seen[m.TMDBId] = true
+			}
+		})
+	}
+
+	if picked := weightedSample(nil, nil, 3); len(picked) != 0 {
+		t.Errorf("got %v from no movies", picked)
+	}
+}
+
+// Single draws land on each movie in proportion to its weight
+func TestWeightedSampleFrequencies(t *testing.T) {
+	movies := []Movie{{TMDBId: 1}, {TMDBId: 2}, {TMDBId: 3}, {TMDBId: 4}}
+	weights := []float64{1, 2, 7, minWeight}
+	total := 10 + minWeight
+
+	const draws = 20000
+	counts := make(map[int32]int)
+	for i := 0; i < draws; i++ {
+		counts[weightedSample(movies, weights, 1)[0].TMDBId]++
+	}
+	for i, m := range movies {
+		want := weights[i] / total
+		// Over six standard deviations, so the test doesn't flake
+		if got := float64(counts[m.TMDBId]) / draws; math.Abs(got-want) > 0.02 {
+			t.Errorf("movie %d drawn %.3f of the time, want %.3f", m.TMDBId, got, want)
+		}
+	}
+}
+
+func TestRandomWeights(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	netflix := []providerInfo{{Provider_id: 8, Provider_name: "Netflix"}}
+
+	tests := []struct {
+		name       string
+		weight     string
+		movie      Movie
+		lastPicked time.Time
+		want       float64
+	}{
+		{"score squares", "score", Movie{JH_Score: 50}, time.Time{}, 0.25},
+		{"perfect score", "score", Movie{JH_Score: 100}, time.Time{}, 1},
+		{"never picked", "fresh", Movie{}, time.Time{}, 1},
+		{"picked just now", "fresh", Movie{}, now, 0},
+		{"picked half a period ago", "fresh", Movie{}, now.AddDate(0, 0, -15), 0.5},
+		{"picked long ago", "fresh", Movie{}, now.AddDate(-1, 0, 0), 1},
+		{"streaming", "available", Movie{Provider: providers{Flatrate: netflix, Rent: netflix}}, time.Time{}, 1},
+		{"rent only", "available", Movie{Provider: providers{Rent: netflix}}, time.Time{}, 0.5},
+		{"buy only", "available", Movie{Provider: providers{Buy: netflix}}, time.Time{}, 0.5},
+		{"unavailable", "available", Movie{}, time.Time{}, 0.1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := randomWeights[tt.weight](tt.movie, tt.lastPicked, now); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistinctMovies(t *testing.T) {
+	got := distinctMovies([]Movie{{TMDBId: 3}, {TMDBId: 1}, {TMDBId: 3}, {TMDBId: 2}, {TMDBId: 1}})
+	want := []int32{3, 1, 2}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].TMDBId != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
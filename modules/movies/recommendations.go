@@ -0,0 +1,103 @@
+package movies
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Reads the tmdbid route parameter, rejecting the request when it is invalid
+func tmdbidParam(c *gin.Context) (int32, bool) {
+	id, err := strconv.ParseInt(c.Param("tmdbid"), 10, 32)
+	if err != nil {
+		problem.BadRequest(c, "tmdbid", "tmdbid must be integer")
+		return 0, false
+	}
+	return int32(id), true
+}
+
+/*
+Splits the source's recommendations into catalog movies, in TMDB's order
+(by relevance) or by JH_Score with TMDB's order breaking ties, and the
+ids of the rest. The source itself and repeated ids are left out.
+*/
+func rankRecommendations(source Movie, byId map[int32]Movie, order string) ([]MovieCard, []int32) {
+	inCatalog := []MovieCard{}
+	candidates := []int32{}
+	seen := map[int32]bool{source.TMDBId: true}
+	for _, id := range source.Recommendations {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if m, ok := byId[id]; ok {
+			inCatalog = append(inCatalog, CardOf(m))
+		} else {
+			candidates = append(candidates, id)
+		}
+	}
+	if order == "score" {
+		sort.SliceStable(inCatalog, func(i, j int) bool {
+			return inCatalog[i].JH_Score > inCatalog[j].JH_Score
+		})
+	}
+	return inCatalog, candidates
+}
+
+/*
+Accepts tmdbid (path) and sort (tmdb, the default, or score).
+Returns the movie's TMDB recommendations that are in the catalog, with
+their scores, and the ids of the rest as watchlist candidates.
+*/
+func GetRecommendations(c *gin.Context) {
+	tmdbid, ok := tmdbidParam(c)
+	if !ok {
+		return
+	}
+	order := c.DefaultQuery("sort", "tmdb")
+	if order != "tmdb" && order != "score" {
+		problem.BadRequest(c, "sort", "sort must be tmdb or score")
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	collection := client.Database("jdmovies").Collection("movies")
+	ctx := c.Request.Context()
+
+	var source Movie
+	err := collection.FindOne(ctx, bson.M{"TMDBId": tmdbid}).Decode(&source)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		problem.NotFound(c, "No movie has this tmdbid")
+		return
+	}
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movie")
+		return
+	}
+
+	// A nil slice would be encoded as null, which $in rejects
+	ids := append([]int32{}, source.Recommendations...)
+	found, err := FindMovies(ctx, collection, bson.M{"TMDBId": bson.M{"$in": ids}})
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch recommendations")
+		return
+	}
+	byId := make(map[int32]Movie, len(found))
+	for _, m := range found {
+		byId[m.TMDBId] = m
+	}
+
+	inCatalog, candidates := rankRecommendations(source, byId, order)
+
+	c.IndentedJSON(http.StatusOK, bson.M{
+		"movie":               CardOf(source),
+		"inCatalog":           inCatalog,
+		"watchlistCandidates": candidates,
+	})
+}
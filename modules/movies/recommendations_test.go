@@ -0,0 +1,47 @@
+package movies
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRankRecommendations(t *testing.T) {
+	byId := map[int32]Movie{
+		10: {TMDBId: 10, Movie: "Ten", JH_Score: 70},
+		20: {TMDBId: 20, Movie: "Twenty", JH_Score: 90},
+		30: {TMDBId: 30, Movie: "Thirty", JH_Score: 70},
+		40: {TMDBId: 40, Movie: "Forty", JH_Score: 80},
+		1:  {TMDBId: 1, Movie: "Source", JH_Score: 100},
+	}
+	source := Movie{TMDBId: 1, Recommendations: []int32{30, 500, 20, 10, 1, 600, 40, 20, 500}}
+
+	tests := []struct {
+		order      string
+		inCatalog  []int32
+		candidates []int32
+	}{
+		{"tmdb", []int32{30, 20, 10, 40}, []int32{500, 600}},
+		// 30 stays ahead of 10 on the tie since TMDB lists it first
+		{"score", []int32{20, 40, 30, 10}, []int32{500, 600}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			inCatalog, candidates := rankRecommendations(source, byId, tt.order)
+			ids := []int32{}
+			for _, m := range inCatalog {
+				ids = append(ids, m.TMDBId)
+			}
+			if !reflect.DeepEqual(ids, tt.inCatalog) {
+				t.Errorf("got movies %v, want %v", ids, tt.inCatalog)
+			}
+			if !reflect.DeepEqual(candidates, tt.candidates) {
+				t.Errorf("got candidates %v, want %v", candidates, tt.candidates)
+			}
+		})
+	}
+
+	inCatalog, candidates := rankRecommendations(Movie{TMDBId: 1}, byId, "tmdb")
+	if inCatalog == nil || candidates == nil || len(inCatalog)+len(candidates) != 0 {
+		t.Errorf("got %v and %v without recommendations, want empty lists", inCatalog, candidates)
+	}
+}
@@ -0,0 +1,531 @@
+package movies
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"github.com/helfy18/movie-site-api/modules/stats"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+	 The reviewers the original schema was built around. Their reviews are
+		also kept in the legacy fields: JH_Score and Review for the scorer,
+		Dani_Approved for the approver.
+*/
+const (
+	legacyScorer   = "jh"
+	legacyApprover = "dani"
+)
+
+var reviewerSlug = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// Fields needed to work out every movie's reviews
+var reviewProjection = bson.M{
+	"Movie": 1, "Year": 1, "TMDBId": 1, "JH_Score": 1, "Genre": 1, "Genre_2": 1, "Runtime": 1, "Rated": 1, "Poster": 1,
+	"Ranking": 1, "Review": 1, "Dani_Approved": 1, "Reviewers": 1,
+}
+
+/*
+Every review of the movie. Reviews stored before reviewers existed are
+read from the legacy fields; Dani_Approved only counts as an approval
+when true since false was also the default for unreviewed movies.
+*/
+func (m Movie) Reviews() []Review {
+	reviews := append([]Review{}, m.Reviewers...)
+	has := func(reviewer string) bool {
+		for _, r := range reviews {
+			if r.Reviewer == reviewer {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !has(legacyScorer) {
+		score := m.JH_Score
+		reviews = append(reviews, Review{Reviewer: legacyScorer, Score: &score, Review: m.Review})
+	}
+	if !has(legacyApprover) && m.Dani_Approved {
+		approved := true
+		reviews = append(reviews, Review{Reviewer: legacyApprover, Approved: &approved})
+	}
+	return reviews
+}
+
+/*
+Decodes a movie as stored, then fills Reviewers with every review so
+all responses show the same reviews. Documents without JH_Score, such as
+projections that leave it out, are left as stored.
+*/
+func (m *Movie) UnmarshalBSON(data []byte) error {
+	// A type without the method, so decoding doesn't recurse
+	type stored Movie
+	if err := bson.Unmarshal(data, (*stored)(m)); err != nil {
+		return err
+	}
+	if _, err := bson.Raw(data).LookupErr("JH_Score"); err == nil {
+		m.Reviewers = m.Reviews()
+	}
+	return nil
+}
+
+// The reviewer's review of the movie, if any
+func (m Movie) ReviewBy(reviewer string) (Review, bool) {
+	for _, r := range m.Reviews() {
+		if r.Reviewer == reviewer {
+			return r, true
+		}
+	}
+	return Review{}, false
+}
+
+// Reads the reviewer route parameter, rejecting the request when it is invalid
+func reviewerParam(c *gin.Context) (string, bool) {
+	reviewer := c.Param("reviewer")
+	if !reviewerSlug.MatchString(reviewer) {
+		problem.BadRequest(c, "reviewer", "reviewer must be 1 to 32 lowercase letters, digits or dashes")
+		return "", false
+	}
+	return reviewer, true
+}
+
+// What one reviewer has covered
+type reviewerSummary struct {
+	Reviewer     string  `json:"reviewer"`
+	Reviews      int     `json:"reviews"`
+	Scored       int     `json:"scored"`
+	AverageScore float64 `json:"averageScore"`
+	Approved     int     `json:"approved"`
+}
+
+// Returns every reviewer with how many movies they reviewed, scored and approved
+func GetReviewers(c *gin.Context) {
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	collection := client.Database("jdmovies").Collection("movies")
+
+	movies, err := FindMovies(c.Request.Context(), collection, bson.M{}, options.Find().SetProjection(reviewProjection))
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+
+	byReviewer := make(map[string]*reviewerSummary)
+	scores := make(map[string][]float64)
+	for _, m := range movies {
+		for _, r := range m.Reviews() {
+			summary, found := byReviewer[r.Reviewer]
+			if !found {
+				summary = &reviewerSummary{Reviewer: r.Reviewer}
+				byReviewer[r.Reviewer] = summary
+			}
+			summary.Reviews++
+			if r.Score != nil {
+				summary.Scored++
+				scores[r.Reviewer] = append(scores[r.Reviewer], float64(*r.Score))
+			}
+			if r.Approved != nil && *r.Approved {
+				summary.Approved++
+			}
+		}
+	}
+
+	reviewers := []reviewerSummary{}
+	for reviewer, summary := range byReviewer {
+		summary.AverageScore = stats.Round(stats.Mean(scores[reviewer]))
+		reviewers = append(reviewers, *summary)
+	}
+	sort.Slice(reviewers, func(i, j int) bool {
+		if reviewers[i].Reviews != reviewers[j].Reviews {
+			return reviewers[i].Reviews > reviewers[j].Reviews
+		}
+		return reviewers[i].Reviewer < reviewers[j].Reviewer
+	})
+	c.IndentedJSON(http.StatusOK, reviewers)
+}
+
+// A movie with one reviewer's review of it
+type reviewedMovie struct {
+	Movie  MovieCard `json:"movie"`
+	Review Review    `json:"review"`
+}
+
+/*
+Accepts reviewer (path), the ListMovies filters and approved (true or
+false).
+Returns the movies the reviewer reviewed, highest scored first.
+*/
+func GetReviewerMovies(c *gin.Context) {
+	reviewer, ok := reviewerParam(c)
+	if !ok {
+		return
+	}
+	f, errs := ParseFilter(c)
+	approved := c.Query("approved")
+	if approved != "" && approved != "true" && approved != "false" {
+		errs = append(errs, problem.FieldError{Field: "approved", Detail: "approved must be true or false"})
+	}
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	collection := client.Database("jdmovies").Collection("movies")
+
+	movies, err := FindMovies(c.Request.Context(), collection, f.Query(), options.Find().SetProjection(reviewProjection).SetSort(bson.M{"Ranking": 1}))
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+
+	reviewed := []reviewedMovie{}
+	for _, m := range movies {
+		r, found := m.ReviewBy(reviewer)
+		if !found {
+			continue
+		}
+		if approved != "" && strconv.FormatBool(r.Approved != nil && *r.Approved) != approved {
+			continue
+		}
+		reviewed = append(reviewed, reviewedMovie{Movie: CardOf(m), Review: r})
+	}
+	sort.SliceStable(reviewed, func(i, j int) bool {
+		a, b := reviewed[i].Review.Score, reviewed[j].Review.Score
+		return a != nil && (b == nil || *a > *b)
+	})
+	c.IndentedJSON(http.StatusOK, reviewed)
+}
+
+// Two reviewers' scores for one movie
+type reviewerGap struct {
+	Movie      MovieCard `json:"movie"`
+	A          int32     `json:"a"`
+	B          int32     `json:"b"`
+	Difference int32     `json:"difference"`
+}
+
+/*
+Accepts a and b (reviewers), the ListMovies filters and limit (movies
+they disagree on most, default 10).
+Returns how two reviewers compare over the movies both reviewed: score
+correlation, average difference (a minus b), how often their approvals
+match and their biggest disagreements.
+*/
+func CompareReviewers(c *gin.Context) {
+	f, errs := ParseFilter(c)
+	a, b := c.Query("a"), c.Query("b")
+	if !reviewerSlug.MatchString(a) {
+		errs = append(errs, problem.FieldError{Field: "a", Detail: "a must be a reviewer"})
+	}
+	if !reviewerSlug.MatchString(b) {
+		errs = append(errs, problem.FieldError{Field: "b", Detail: "b must be a reviewer"})
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > 100 {
+		errs = append(errs, problem.FieldError{Field: "limit", Detail: "limit must be an integer from 1 to 100"})
+	}
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	collection := client.Database("jdmovies").Collection("movies")
+
+	movies, err := FindMovies(c.Request.Context(), collection, f.Query(), options.Find().SetProjection(reviewProjection))
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+
+	var as, bs, differences []float64
+	gaps := []reviewerGap{}
+	both, approvals, agreed := 0, 0, 0
+	for _, m := range movies {
+		ra, foundA := m.ReviewBy(a)
+		rb, foundB := m.ReviewBy(b)
+		if !foundA || !foundB {
+			continue
+		}
+		both++
+		if ra.Approved != nil && rb.Approved != nil {
+			approvals++
+			if *ra.Approved == *rb.Approved {
+				agreed++
+			}
+		}
+		if ra.Score != nil && rb.Score != nil {
+			as = append(as, float64(*ra.Score))
+			bs = append(bs, float64(*rb.Score))
+			differences = append(differences, float64(*ra.Score-*rb.Score))
+			gaps = append(gaps, reviewerGap{Movie: CardOf(m), A: *ra.Score, B: *rb.Score, Difference: *ra.Score - *rb.Score})
+		}
+	}
+
+	sort.SliceStable(gaps, func(i, j int) bool {
+		return math.Abs(float64(gaps[i].Difference)) > math.Abs(float64(gaps[j].Difference))
+	})
+	if len(gaps) > limit {
+		gaps = gaps[:limit]
+	}
+
+	scores := bson.M{"count": len(as), "averageDifference": stats.Round(stats.Mean(differences))}
+	if r, ok := stats.Pearson(as, bs); ok {
+		scores["correlation"] = stats.Round(r)
+	}
+	approval := bson.M{"count": approvals}
+	if approvals > 0 {
+		approval["agreement"] = stats.Round(float64(agreed) / float64(approvals))
+	}
+
+	c.IndentedJSON(http.StatusOK, bson.M{
+		"a":              a,
+		"b":              b,
+		"reviewedByBoth": both,
+		"scores":         scores,
+		"approvals":      approval,
+		"disagreements":  gaps,
+	})
+}
+
+/*
+Parses weights such as "jh:2,alex:1" into a weight per reviewer.
+Reviewers left out get no weight; an empty value weighs everyone equally.
+*/
+func parseWeights(value string) (map[string]float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	weights := make(map[string]float64)
+	for _, part := range strings.Split(value, ",") {
+		reviewer, weight, found := strings.Cut(part, ":")
+		w, err := strconv.ParseFloat(weight, 64)
+		if !found || !reviewerSlug.MatchString(reviewer) || err != nil || w < 0 {
+			return nil, errors.New("weights must look like jh:2,alex:1 with non-negative weights")
+		}
+		weights[reviewer] = w
+	}
+	return weights, nil
+}
+
+// A movie's combined score and the scores it came from
+type combinedScore struct {
+	Movie     MovieCard        `json:"movie"`
+	Combined  float64          `json:"combined"`
+	Scores    map[string]int32 `json:"scores"`
+	Approvals []string         `json:"approvals"`
+}
+
+/*
+Accepts the ListMovies filters, weights (e.g. jh:2,alex:1, default equal),
+min (fewest weighted scores a movie needs, default 1) and limit (default
+all).
+Returns movies ranked by the weighted average of their reviewers'
+scores, with who approved each.
+*/
+func GetCombinedScores(c *gin.Context) {
+	f, errs := ParseFilter(c)
+	weights, err := parseWeights(c.Query("weights"))
+	if err != nil {
+		errs = append(errs, problem.FieldError{Field: "weights", Detail: err.Error()})
+	}
+	minScores, err := strconv.Atoi(c.DefaultQuery("min", "1"))
+	if err != nil || minScores < 1 {
+		errs = append(errs, problem.FieldError{Field: "min", Detail: "min must be a positive integer"})
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil || limit < 0 {
+		errs = append(errs, problem.FieldError{Field: "limit", Detail: "limit must be a non-negative integer"})
+	}
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	collection := client.Database("jdmovies").Collection("movies")
+
+	movies, err := FindMovies(c.Request.Context(), collection, f.Query(), options.Find().SetProjection(reviewProjection))
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+
+	combined := []combinedScore{}
+	for _, m := range movies {
+		entry := combinedScore{Movie: CardOf(m), Scores: map[string]int32{}, Approvals: []string{}}
+		var sum, total float64
+		counted := 0
+		for _, r := range m.Reviews() {
+			if r.Approved != nil && *r.Approved {
+				entry.Approvals = append(entry.Approvals, r.Reviewer)
+			}
+			if r.Score == nil {
+				continue
+			}
+			entry.Scores[r.Reviewer] = *r.Score
+			weight := 1.0
+			if weights != nil {
+				weight = weights[r.Reviewer]
+			}
+			if weight > 0 {
+				sum += weight * float64(*r.Score)
+				total += weight
+				counted++
+			}
+		}
+		if counted < minScores {
+			continue
+		}
+		entry.Combined = stats.Round(sum / total)
+		combined = append(combined, entry)
+	}
+
+	sort.SliceStable(combined, func(i, j int) bool {
+		return combined[i].Combined > combined[j].Combined
+	})
+	if limit > 0 && len(combined) > limit {
+		combined = combined[:limit]
+	}
+	c.IndentedJSON(http.StatusOK, combined)
+}
+
+/*
+Accepts tmdbid and reviewer (path) and any of score (0 to 100), review
+and approved (JSON).
+Saves the reviewer's review of the movie. Reviews by the legacy reviewers
+also update JH_Score and Review, or Dani_Approved, so older clients keep
+seeing them.
+*/
+func PutReview(c *gin.Context) {
+	tmdbid, ok := tmdbidParam(c)
+	if !ok {
+		return
+	}
+	reviewer, ok := reviewerParam(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Score    *int32  `json:"score"`
+		Review   *string `json:"review"`
+		Approved *bool   `json:"approved"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		problem.BadRequest(c, "body", "Body must be JSON with score, review or approved")
+		return
+	}
+	if body.Score != nil && (*body.Score < 0 || *body.Score > 100) {
+		problem.BadRequest(c, "score", "score must be an integer from 0 to 100")
+		return
+	}
+
+	// The fields the body changes on the review, and in the legacy fields
+	fields := bson.M{}
+	legacy := bson.M{}
+	if body.Score != nil {
+		fields["score"] = *body.Score
+	}
+	if body.Review != nil {
+		fields["review"] = *body.Review
+	}
+	if body.Approved != nil {
+		fields["approved"] = *body.Approved
+	}
+	switch reviewer {
+	case legacyScorer:
+		if body.Score != nil {
+			legacy["JH_Score"] = *body.Score
+		}
+		if body.Review != nil {
+			legacy["Review"] = *body.Review
+		}
+	case legacyApprover:
+		if body.Approved != nil {
+			legacy["Dani_Approved"] = *body.Approved
+		}
+	}
+	if len(fields) == 0 {
+		problem.BadRequest(c, "body", "Body must set score, review or approved")
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	collection := client.Database("jdmovies").Collection("movies")
+	ctx := c.Request.Context()
+	after := options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(reviewProjection)
+
+	var m Movie
+	saved := false
+	for attempt := 0; attempt < 2 && !saved; attempt++ {
+		// Change the reviewer's stored review in place
+		set := bson.M{}
+		for field, value := range legacy {
+			set[field] = value
+		}
+		for field, value := range fields {
+			set["Reviewers.$."+field] = value
+		}
+		err := collection.FindOneAndUpdate(ctx, bson.M{"TMDBId": tmdbid, "Reviewers.reviewer": reviewer}, bson.M{"$set": set}, after).Decode(&m)
+		if err == nil {
+			saved = true
+			break
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			problem.Error(c, err, "Failed to save review")
+			return
+		}
+
+		// Or store a new one, starting from the legacy fields if the reviewer has them
+		var current Movie
+		err = collection.FindOne(ctx, bson.M{"TMDBId": tmdbid}, options.FindOne().SetProjection(reviewProjection)).Decode(&current)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			problem.NotFound(c, "No movie has this tmdbid")
+			return
+		}
+		if err != nil {
+			problem.Error(c, err, "Failed to fetch movie")
+			return
+		}
+		review, _ := current.ReviewBy(reviewer)
+		review.Reviewer = reviewer
+		if body.Score != nil {
+			review.Score = body.Score
+		}
+		if body.Review != nil {
+			review.Review = *body.Review
+		}
+		if body.Approved != nil {
+			review.Approved = body.Approved
+		}
+		update := bson.M{"$push": bson.M{"Reviewers": review}}
+		if len(legacy) > 0 {
+			update["$set"] = legacy
+		}
+		// Only when no request stored one meanwhile; otherwise go round and change that
+		err = collection.FindOneAndUpdate(ctx, bson.M{"TMDBId": tmdbid, "Reviewers.reviewer": bson.M{"$ne": reviewer}}, update, after).Decode(&m)
+		if err == nil {
+			saved = true
+		} else if !errors.Is(err, mongo.ErrNoDocuments) {
+			problem.Error(c, err, "Failed to save review")
+			return
+		}
+	}
+	if !saved {
+		problem.Abort(c, http.StatusConflict, "The review was changed by another request, try again")
+		return
+	}
+
+	review, _ := m.ReviewBy(reviewer)
+	c.IndentedJSON(http.StatusOK, reviewedMovie{Movie: CardOf(m), Review: review})
+}
@@ -0,0 +1,84 @@
+package movies
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func int32Ptr(n int32) *int32 { return &n }
+func boolPtr(b bool) *bool    { return &b }
+
+func TestMovieDecodesReviews(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  bson.M
+		want []Review
+	}{
+		{
+			name: "legacy fields only",
+			doc:  bson.M{"TMDBId": int32(1), "JH_Score": int32(88), "Review": "Great", "Dani_Approved": true},
+			want: []Review{
+				{Reviewer: legacyScorer, Score: int32Ptr(88), Review: "Great"},
+				{Reviewer: legacyApprover, Approved: boolPtr(true)},
+			},
+		},
+		{
+			name: "stored reviews come first",
+			doc: bson.M{"TMDBId": int32(2), "JH_Score": int32(70), "Dani_Approved": false,
+				"Reviewers": bson.A{bson.M{"reviewer": "kim", "score": int32(64)}}},
+			want: []Review{
+				{Reviewer: "kim", Score: int32Ptr(64)},
+				{Reviewer: legacyScorer, Score: int32Ptr(70)},
+			},
+		},
+		{
+			name: "stored legacy review wins over the legacy fields",
+			doc: bson.M{"TMDBId": int32(3), "JH_Score": int32(50),
+				"Reviewers": bson.A{bson.M{"reviewer": legacyScorer, "score": int32(50), "review": "Fine"}}},
+			want: []Review{
+				{Reviewer: legacyScorer, Score: int32Ptr(50), Review: "Fine"},
+			},
+		},
+		{
+			name: "projection without JH_Score is left as stored",
+			doc:  bson.M{"TMDBId": int32(4), "Reviewers": bson.A{bson.M{"reviewer": "kim", "approved": true}}},
+			want: []Review{
+				{Reviewer: "kim", Approved: boolPtr(true)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := bson.Marshal(tt.doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var m Movie
+			if err := bson.Unmarshal(data, &m); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(m.Reviewers, tt.want) {
+				t.Errorf("got %+v, want %+v", m.Reviewers, tt.want)
+			}
+			// Working out the reviews again must not add the legacy ones twice
+			if _, scored := tt.doc["JH_Score"]; !scored {
+				return
+			}
+			if got := m.Reviews(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Reviews() got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMovieEncodesReviewersKey(t *testing.T) {
+	data, err := bson.Marshal(Movie{Reviewers: []Review{{Reviewer: "kim", Score: int32Ptr(90)}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bson.Raw(data).LookupErr("Reviewers"); err != nil {
+		t.Errorf("Reviewers isn't stored under the key PutReview writes: %v", err)
+	}
+}
@@ -0,0 +1,370 @@
+package movies
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"github.com/helfy18/movie-site-api/modules/stats"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+/*
+	 How often the similarity index looks for newly added movies, and how
+		often it reloads everything to pick up edits and deletions.
+*/
+const (
+	similarRefreshInterval = 30 * time.Second
+	similarRebuildInterval = time.Hour
+	maxSimilar             = 50
+)
+
+// Weights of each kind of resemblance in a similarity score
+const (
+	weightGenre    = 3.0
+	weightUniverse = 2.0
+	weightDirector = 2.0
+	weightActor    = 0.5
+	maxActorWeight = 2.0
+	weightStudio   = 1.0
+	weightDecade   = 0.5
+	weightRuntime  = 0.5
+	weightPlot     = 3.0
+)
+
+// Words too common to say anything about a plot
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "his": true, "her": true, "their": true,
+	"from": true, "into": true, "that": true, "this": true, "who": true, "when": true, "they": true,
+	"are": true, "was": true, "has": true, "have": true, "but": true, "its": true, "him": true,
+	"she": true, "one": true, "after": true, "while": true, "must": true, "out": true, "all": true,
+	"about": true, "there": true, "them": true, "what": true, "which": true, "will": true, "where": true,
+	"only": true, "more": true, "than": true, "been": true, "also": true, "over": true, "find": true,
+}
+
+// Splits a plot into lowercase terms, dropping stop words and short words
+func plotTerms(plot string) map[string]float64 {
+	terms := make(map[string]float64)
+	words := strings.FieldsFunc(strings.ToLower(plot), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if len(word) >= 3 && !stopWords[word] {
+			terms[word]++
+		}
+	}
+	return terms
+}
+
+// The features of one movie the similarity model compares
+type similarDocument struct {
+	movie     Movie
+	genres    []string
+	directors []string
+	actors    []string
+	terms     map[string]float64
+}
+
+func documentOf(m Movie) *similarDocument {
+	return &similarDocument{
+		movie:     m,
+		genres:    nonEmpty(m.Genre, m.Genre_2),
+		directors: splitPeople(m.Director),
+		actors:    splitPeople(m.Actors),
+		terms:     plotTerms(m.Plot),
+	}
+}
+
+/*
+	 In-process content-based similarity model over the catalog. Movies
+		are added incrementally as they appear (by ms_added) and the whole
+		index is reloaded periodically.
+*/
+type similarityIndex struct {
+	mu          sync.RWMutex
+	documents   map[int32]*similarDocument
+	frequencies map[string]int
+	latestAdded int64
+	checked     time.Time
+	built       time.Time
+
+	// Serializes refreshes so concurrent requests don't load twice
+	refreshing sync.Mutex
+}
+
+func newSimilarityIndex() *similarityIndex {
+	return &similarityIndex{
+		documents:   make(map[int32]*similarDocument),
+		frequencies: make(map[string]int),
+	}
+}
+
+var similarIndex = newSimilarityIndex()
+
+// Where the similarity index reads movies from
+type movieLoader interface {
+	allMovies(ctx context.Context) ([]Movie, error)
+	// Movies whose ms_added is after since
+	moviesAddedAfter(ctx context.Context, since int64) ([]Movie, error)
+}
+
+// Loads movies from the movies collection
+type mongoLoader struct {
+	collection *mongo.Collection
+}
+
+func (l mongoLoader) allMovies(ctx context.Context) ([]Movie, error) {
+	return FindMovies(ctx, l.collection, bson.M{})
+}
+
+func (l mongoLoader) moviesAddedAfter(ctx context.Context, since int64) ([]Movie, error) {
+	return FindMovies(ctx, l.collection, bson.M{"ms_added": bson.M{"$gt": since}})
+}
+
+// Adds or replaces a movie; the caller holds the write lock
+func (idx *similarityIndex) add(m Movie) {
+	if old, found := idx.documents[m.TMDBId]; found {
+		for term := range old.terms {
+			if idx.frequencies[term]--; idx.frequencies[term] == 0 {
+				delete(idx.frequencies, term)
+			}
+		}
+	}
+	doc := documentOf(m)
+	idx.documents[m.TMDBId] = doc
+	for term := range doc.terms {
+		idx.frequencies[term]++
+	}
+	if m.Ms_added > idx.latestAdded {
+		idx.latestAdded = m.Ms_added
+	}
+}
+
+/*
+Brings the index up to date: a full load when it is empty or stale,
+otherwise only movies added since the newest one indexed.
+*/
+func (idx *similarityIndex) refresh(ctx context.Context, loader movieLoader) error {
+	idx.refreshing.Lock()
+	defer idx.refreshing.Unlock()
+
+	idx.mu.RLock()
+	full := len(idx.documents) == 0 || time.Since(idx.built) > similarRebuildInterval
+	due := time.Since(idx.checked) > similarRefreshInterval
+	latest := idx.latestAdded
+	idx.mu.RUnlock()
+
+	if !full && !due {
+		return nil
+	}
+
+	var movies []Movie
+	var err error
+	if full {
+		movies, err = loader.allMovies(ctx)
+	} else {
+		movies, err = loader.moviesAddedAfter(ctx, latest)
+	}
+	if err != nil {
+		return err
+	}
+	idx.load(movies, full)
+	return nil
+}
+
+// Adds the movies, first emptying the index when full is set
+func (idx *similarityIndex) load(movies []Movie, full bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if full {
+		idx.documents = make(map[int32]*similarDocument, len(movies))
+		idx.frequencies = make(map[string]int)
+		idx.latestAdded = 0
+		idx.built = time.Now()
+	}
+	for _, m := range movies {
+		idx.add(m)
+	}
+	idx.checked = time.Now()
+}
+
+// TF-IDF weight of each term; the caller holds the read lock
+func (idx *similarityIndex) vector(doc *similarDocument) map[string]float64 {
+	total := float64(len(idx.documents))
+	vector := make(map[string]float64, len(doc.terms))
+	for term, count := range doc.terms {
+		vector[term] = count * math.Log(1+total/float64(1+idx.frequencies[term]))
+	}
+	return vector
+}
+
+func cosine(a map[string]float64, b map[string]float64) float64 {
+	var dot, normA, normB float64
+	for term, weight := range a {
+		dot += weight * b[term]
+		normA += weight * weight
+	}
+	for _, weight := range b {
+		normB += weight * weight
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// Values present in both lists
+func shared(a []string, b []string) []string {
+	var both []string
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				both = append(both, x)
+				break
+			}
+		}
+	}
+	return both
+}
+
+// A similar movie with the reasons it was picked
+type similarMovie struct {
+	MovieCard
+	Similarity float64  `json:"similarity"`
+	Reasons    []string `json:"reasons"`
+}
+
+// Scores how alike two movies are and explains why
+func compareDocuments(a *similarDocument, b *similarDocument, plot float64) (float64, []string) {
+	var score float64
+	reasons := []string{}
+
+	if genres := shared(a.genres, b.genres); len(genres) > 0 {
+		union := nonEmpty(append(append([]string{}, a.genres...), b.genres...)...)
+		score += weightGenre * float64(len(genres)) / float64(len(union))
+		reasons = append(reasons, "both "+strings.Join(genres, " and "))
+	}
+	if a.movie.Universe != "" && a.movie.Universe == b.movie.Universe {
+		score += weightUniverse
+		reasons = append(reasons, "same universe ("+a.movie.Universe+")")
+		if a.movie.Sub_Universe != "" && a.movie.Sub_Universe == b.movie.Sub_Universe {
+			score += weightUniverse / 2
+		}
+	}
+	if directors := shared(a.directors, b.directors); len(directors) > 0 {
+		score += weightDirector
+		reasons = append(reasons, "same director ("+strings.Join(directors, ", ")+")")
+	}
+	if actors := shared(a.actors, b.actors); len(actors) > 0 {
+		score += math.Min(weightActor*float64(len(actors)), maxActorWeight)
+		if len(actors) == 1 {
+			reasons = append(reasons, "shares "+actors[0])
+		} else {
+			reasons = append(reasons, fmt.Sprintf("shares %d actors", len(actors)))
+		}
+	}
+	if a.movie.Studio != "" && a.movie.Studio == b.movie.Studio {
+		score += weightStudio
+		reasons = append(reasons, "same studio ("+a.movie.Studio+")")
+	}
+	if decade := decadeOf(a.movie.Year); decade != "" && decade == decadeOf(b.movie.Year) {
+		score += weightDecade
+		reasons = append(reasons, "both from the "+decade)
+	}
+	if a.movie.Runtime > 0 && b.movie.Runtime > 0 {
+		gap := math.Abs(float64(a.movie.Runtime - b.movie.Runtime))
+		score += weightRuntime * math.Max(0, 1-gap/60)
+	}
+	if plot > 0 {
+		score += weightPlot * plot
+		if plot >= 0.15 {
+			reasons = append(reasons, "similar plot")
+		}
+	}
+	return score, reasons
+}
+
+/*
+The limit movies most similar to the one with the tmdbid, most similar
+first, along with that movie. Returns false when it isn't indexed.
+*/
+func (idx *similarityIndex) similar(tmdbid int32, limit int) ([]similarMovie, Movie, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	source, found := idx.documents[tmdbid]
+	if !found {
+		return nil, Movie{}, false
+	}
+	sourceVector := idx.vector(source)
+
+	results := []similarMovie{}
+	for id, doc := range idx.documents {
+		if id == tmdbid {
+			continue
+		}
+		score, reasons := compareDocuments(source, doc, cosine(sourceVector, idx.vector(doc)))
+		if score <= 0 {
+			continue
+		}
+		results = append(results, similarMovie{MovieCard: CardOf(doc.movie), Similarity: stats.Round(score), Reasons: reasons})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Similarity != results[j].Similarity {
+			return results[i].Similarity > results[j].Similarity
+		}
+		return results[i].TMDBId < results[j].TMDBId
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, source.movie, true
+}
+
+/*
+Accepts tmdbid (path) and limit (default 10, at most 50).
+Returns the most similar catalog movies by genre, universe, director,
+actors, studio, decade, runtime and plot keywords (TF-IDF), each with
+the reasons it matched.
+*/
+func GetSimilarMovies(c *gin.Context) {
+	tmdbid, ok := tmdbidParam(c)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > maxSimilar {
+		problem.BadRequest(c, "limit", "limit must be an integer from 1 to 50")
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	collection := client.Database("jdmovies").Collection("movies")
+
+	if err := similarIndex.refresh(c.Request.Context(), mongoLoader{collection: collection}); err != nil {
+		problem.Error(c, err, "Failed to load movies")
+		return
+	}
+
+	results, movie, found := similarIndex.similar(tmdbid, limit)
+	if !found {
+		problem.NotFound(c, "No movie has this tmdbid")
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, bson.M{
+		"movie":   CardOf(movie),
+		"similar": results,
+	})
+}
@@ -0,0 +1,154 @@
+package movies
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// A movieLoader over a fixed list of movies
+type sliceLoader []Movie
+
+func (l sliceLoader) allMovies(ctx context.Context) ([]Movie, error) {
+	return l, nil
+}
+
+func (l sliceLoader) moviesAddedAfter(ctx context.Context, since int64) ([]Movie, error) {
+	var added []Movie
+	for _, m := range l {
+		if m.Ms_added > since {
+			added = append(added, m)
+		}
+	}
+	return added, nil
+}
+
+var similarCatalog = sliceLoader{
+	{TMDBId: 1, Movie: "Alien", Genre: "Horror", Genre_2: "Science Fiction", Year: 1979, Director: "Ridley Scott",
+		Plot: "The crew of a commercial spaceship is hunted by a deadly alien creature aboard their vessel.", Ms_added: 1},
+	{TMDBId: 2, Movie: "Aliens", Genre: "Action", Genre_2: "Science Fiction", Year: 1986, Director: "James Cameron",
+		Plot: "Ripley returns with marines to fight the deadly alien creature colony on a distant moon.", Ms_added: 2},
+	{TMDBId: 3, Movie: "The Thing", Genre: "Horror", Genre_2: "Science Fiction", Year: 1982, Director: "John Carpenter",
+		Plot: "An antarctic research crew is hunted by a shape-shifting alien creature.", Ms_added: 3},
+	{TMDBId: 4, Movie: "Blade Runner", Genre: "Science Fiction", Year: 1982, Director: "Ridley Scott",
+		Plot: "A blade runner hunts replicants through a rainy future city.", Ms_added: 4},
+	{TMDBId: 5, Movie: "Notting Hill", Genre: "Romance", Genre_2: "Comedy", Year: 1999, Runtime: 124,
+		Plot: "A bookshop owner falls for a famous actress.", Ms_added: 5},
+}
+
+func TestSimilarMovies(t *testing.T) {
+	idx := newSimilarityIndex()
+	if err := idx.refresh(context.Background(), similarCatalog); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		tmdbid int32
+		limit  int
+		want   []int32
+	}{
+		{"plot, genres and director rank first", 1, 3, []int32{3, 4, 2}},
+		{"limit cuts the list", 1, 1, []int32{3}},
+		{"unrelated movies are left out", 5, 10, []int32{}},
+		{"shared director counts", 4, 1, []int32{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, movie, found := idx.similar(tt.tmdbid, tt.limit)
+			if !found || movie.TMDBId != tt.tmdbid {
+				t.Fatalf("movie %d not found", tt.tmdbid)
+			}
+			if len(results) > tt.limit {
+				t.Errorf("got %d results, limit is %d", len(results), tt.limit)
+			}
+			got := []int32{}
+			for _, r := range results {
+				if r.TMDBId == tt.tmdbid {
+					t.Errorf("movie %d is listed as similar to itself", tt.tmdbid)
+				}
+				got = append(got, r.TMDBId)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	if _, _, found := idx.similar(99, 10); found {
+		t.Error("found a movie that isn't in the catalog")
+	}
+}
+
+// Movies added a few at a time index the same as a full load of the result
+func TestSimilarIncrementalMatchesRebuild(t *testing.T) {
+	ctx := context.Background()
+	idx := newSimilarityIndex()
+	if err := idx.refresh(ctx, similarCatalog[:3]); err != nil {
+		t.Fatal(err)
+	}
+	built := idx.built
+
+	// Blade Runner and Notting Hill arrive, and The Thing is re-added with a new plot
+	thing := similarCatalog[2]
+	thing.Plot = "A research team in antarctica meets a parasitic organism that imitates them."
+	thing.Ms_added = 6
+	later := sliceLoader{similarCatalog[0], similarCatalog[1], similarCatalog[3], similarCatalog[4], thing}
+	for _, step := range []sliceLoader{later[:3], later[:4], later} {
+		idx.checked = time.Time{}
+		if err := idx.refresh(ctx, step); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if idx.built != built {
+		t.Fatal("refreshes rebuilt the index instead of adding to it")
+	}
+
+	full := newSimilarityIndex()
+	if err := full.refresh(ctx, later); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(idx.documents) != len(full.documents) {
+		t.Fatalf("got %d movies, want %d", len(idx.documents), len(full.documents))
+	}
+	if idx.latestAdded != full.latestAdded {
+		t.Errorf("latest added is %d, want %d", idx.latestAdded, full.latestAdded)
+	}
+	if !reflect.DeepEqual(idx.frequencies, full.frequencies) {
+		t.Errorf("term frequencies differ:\n%v\n%v", idx.frequencies, full.frequencies)
+	}
+	for _, m := range later {
+		got, _, _ := idx.similar(m.TMDBId, maxSimilar)
+		want, _, _ := full.similar(m.TMDBId, maxSimilar)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("movie %d: got %+v, want %+v", m.TMDBId, got, want)
+		}
+	}
+}
+
+func TestCosine(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b map[string]float64
+		want float64
+	}{
+		{"identical", map[string]float64{"alien": 2, "crew": 1}, map[string]float64{"alien": 2, "crew": 1}, 1},
+		{"disjoint", map[string]float64{"alien": 1}, map[string]float64{"romance": 1}, 0},
+		{"empty", map[string]float64{}, map[string]float64{"alien": 1}, 0},
+		{"scaled", map[string]float64{"alien": 1, "crew": 1}, map[string]float64{"alien": 3, "crew": 3}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cosine(tt.a, tt.b); got < tt.want-1e-9 || got > tt.want+1e-9 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
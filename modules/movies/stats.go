@@ -0,0 +1,138 @@
+package movies
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"github.com/helfy18/movie-site-api/modules/stats"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Score distribution of the movies sharing one value of a dimension
+type groupSummary struct {
+	FieldValue string `json:"fieldValue"`
+	stats.Summary
+}
+
+/*
+	 A dimension /stats groups by. keys returns the groups a movie
+		belongs to, which may be none or several.
+*/
+type statsDimension struct {
+	name string
+	keys func(m Movie) []string
+}
+
+// Drops empty and repeated values
+func nonEmpty(values ...string) []string {
+	var keys []string
+	for i, v := range values {
+		if v == "" {
+			continue
+		}
+		repeated := false
+		for _, earlier := range values[:i] {
+			repeated = repeated || earlier == v
+		}
+		if !repeated {
+			keys = append(keys, v)
+		}
+	}
+	return keys
+}
+
+// Decade label of a year, e.g. 1994 is "1990s"
+func decadeOf(year int32) string {
+	if year <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%ds", year/10*10)
+}
+
+var statsDimensions = []statsDimension{
+	{"genre", func(m Movie) []string { return nonEmpty(m.Genre, m.Genre_2) }},
+	{"studio", func(m Movie) []string { return nonEmpty(m.Studio) }},
+	{"universe", func(m Movie) []string { return nonEmpty(m.Universe) }},
+	{"decade", func(m Movie) []string { return nonEmpty(decadeOf(m.Year)) }},
+	{"director", func(m Movie) []string { return nonEmpty(m.Director) }},
+	{"rated", func(m Movie) []string { return nonEmpty(m.Rated) }},
+	{"holiday", func(m Movie) []string { return nonEmpty(m.Holiday) }},
+}
+
+/*
+Summarizes JH_Score per value of one dimension, keeping groups with at
+least minCount movies. Largest groups come first.
+*/
+func summarizeBy(movies []Movie, keys func(m Movie) []string, bucketWidth float64, minCount int) []groupSummary {
+	scores := make(map[string][]float64)
+	for _, m := range movies {
+		for _, key := range keys(m) {
+			scores[key] = append(scores[key], float64(m.JH_Score))
+		}
+	}
+
+	groups := []groupSummary{}
+	for key, values := range scores {
+		if len(values) >= minCount {
+			groups = append(groups, groupSummary{FieldValue: key, Summary: stats.Summarize(values, bucketWidth)})
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].FieldValue < groups[j].FieldValue
+	})
+	return groups
+}
+
+/*
+Accepts the ListMovies filters, bucket (histogram width, default 10)
+and min (smallest group reported, default 1).
+Returns JH_Score average, median, standard deviation and histogram
+overall and per genre, studio, universe, decade, director, MPAA rating
+and holiday.
+*/
+func GetStats(c *gin.Context) {
+	f, errs := ParseFilter(c)
+
+	bucket, err := strconv.Atoi(c.DefaultQuery("bucket", "10"))
+	if err != nil || bucket <= 0 {
+		errs = append(errs, problem.FieldError{Field: "bucket", Detail: "bucket must be a positive integer"})
+	}
+	minCount, err := strconv.Atoi(c.DefaultQuery("min", "1"))
+	if err != nil || minCount <= 0 {
+		errs = append(errs, problem.FieldError{Field: "min", Detail: "min must be a positive integer"})
+	}
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	collection := client.Database("jdmovies").Collection("movies")
+
+	projection := bson.M{"JH_Score": 1, "Genre": 1, "Genre_2": 1, "Studio": 1, "Universe": 1, "Year": 1, "Director": 1, "Rated": 1, "Holiday": 1}
+	movies, err := FindMovies(c.Request.Context(), collection, f.Query(), options.Find().SetProjection(projection))
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+
+	scores := make([]float64, len(movies))
+	for i, m := range movies {
+		scores[i] = float64(m.JH_Score)
+	}
+
+	response := bson.M{"overall": stats.Summarize(scores, float64(bucket))}
+	for _, d := range statsDimensions {
+		response[d.name] = summarizeBy(movies, d.keys, float64(bucket), minCount)
+	}
+	c.IndentedJSON(http.StatusOK, response)
+}
@@ -0,0 +1,295 @@
+package movies
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Tiers from best to worst. F takes everything below D
+var tierNames = []string{"S", "A", "B", "C", "D", "F"}
+
+// Lowest JH_Score for each tier unless the request sets thresholds
+var defaultThresholds = map[string]int32{"S": 90, "A": 80, "B": 70, "C": 60, "D": 50, "F": 0}
+
+// Row colors of the image layout, the usual tier list palette
+var tierColors = map[string]string{
+	"S": "#ff7f7f",
+	"A": "#ffbf7f",
+	"B": "#ffdf7f",
+	"C": "#ffff7f",
+	"D": "#bfff7f",
+	"F": "#7fff7f",
+}
+
+// Sizes of the image layout in pixels. Tiles keep the 2:3 poster ratio
+const (
+	labelWidth    = 120
+	tileGap       = 4
+	defaultTile   = 100
+	defaultColumn = 10
+)
+
+func isTier(name string) bool {
+	for _, t := range tierNames {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Parses thresholds such as "S:95,A:85" over the defaults. Each tier's
+minimum must be below the one of the tier above it.
+*/
+func parseThresholds(value string) (map[string]int32, error) {
+	thresholds := make(map[string]int32, len(defaultThresholds))
+	for t, min := range defaultThresholds {
+		thresholds[t] = min
+	}
+	if value == "" {
+		return thresholds, nil
+	}
+
+	for _, part := range strings.Split(value, ",") {
+		name, min, found := strings.Cut(part, ":")
+		name = strings.ToUpper(strings.TrimSpace(name))
+		score, err := strconv.Atoi(strings.TrimSpace(min))
+		if !found || !isTier(name) || name == "F" || err != nil || score < 0 || score > 100 {
+			return nil, fmt.Errorf("thresholds must look like S:90,A:80 with tiers S to D and scores 0 to 100")
+		}
+		thresholds[name] = int32(score)
+	}
+	for i := 1; i < len(tierNames)-1; i++ {
+		if thresholds[tierNames[i]] >= thresholds[tierNames[i-1]] {
+			return nil, fmt.Errorf("threshold for %s must be below the one for %s", tierNames[i], tierNames[i-1])
+		}
+	}
+	return thresholds, nil
+}
+
+// The tier a score falls in
+func tierOf(score int32, thresholds map[string]int32) string {
+	for _, t := range tierNames {
+		if score >= thresholds[t] {
+			return t
+		}
+	}
+	return "F"
+}
+
+// One row of a tier list
+type tier struct {
+	Tier string `json:"tier"`
+	// Lowest JH_Score in the tier, for tiers made from scores
+	Min    *int32      `json:"min,omitempty"`
+	Count  int         `json:"count"`
+	Movies []MovieCard `json:"movies"`
+}
+
+// A movie's place in the image layout
+type tile struct {
+	TMDBId int32  `json:"tmdbid"`
+	Movie  string `json:"movie"`
+	Poster string `json:"poster"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// A tier's row in the image layout
+type layoutRow struct {
+	Tier   string `json:"tier"`
+	Color  string `json:"color"`
+	Y      int    `json:"y"`
+	Height int    `json:"height"`
+	Tiles  []tile `json:"tiles"`
+}
+
+/*
+Positions every poster on a canvas: a label column, then rows of tiles
+that wrap after the given number of columns. Empty tiers keep one row so
+the list reads S to F.
+*/
+func layoutOf(tiers []tier, columns int, tileWidth int) gin.H {
+	tileHeight := tileWidth * 3 / 2
+	width := labelWidth + columns*(tileWidth+tileGap) + tileGap
+
+	rows := []layoutRow{}
+	y := 0
+	for _, t := range tiers {
+		lines := max(1, (len(t.Movies)+columns-1)/columns)
+		row := layoutRow{Tier: t.Tier, Color: tierColors[t.Tier], Y: y, Height: lines*(tileHeight+tileGap) + tileGap, Tiles: []tile{}}
+		for i, m := range t.Movies {
+			row.Tiles = append(row.Tiles, tile{
+				TMDBId: m.TMDBId,
+				Movie:  m.Movie,
+				Poster: m.Poster,
+				X:      labelWidth + tileGap + (i%columns)*(tileWidth+tileGap),
+				Y:      y + tileGap + (i/columns)*(tileHeight+tileGap),
+				Width:  tileWidth,
+				Height: tileHeight,
+			})
+		}
+		rows = append(rows, row)
+		y += row.Height
+	}
+
+	return gin.H{"width": width, "height": y, "labelWidth": labelWidth, "rows": rows}
+}
+
+// The tier list as a markdown document, one heading per tier
+func markdownOf(tiers []tier, unassigned []MovieCard) string {
+	var b strings.Builder
+	b.WriteString("# Tier list\n")
+	section := func(heading string, movies []MovieCard) {
+		b.WriteString("\n## " + heading + "\n\n")
+		if len(movies) == 0 {
+			b.WriteString("_None_\n")
+		}
+		for _, m := range movies {
+			fmt.Fprintf(&b, "- %s (%d) - %d\n", m.Movie, m.Year, m.JH_Score)
+		}
+	}
+	for _, t := range tiers {
+		heading := t.Tier
+		if t.Min != nil {
+			heading += fmt.Sprintf(" (%d+)", *t.Min)
+		}
+		section(heading, t.Movies)
+	}
+	if len(unassigned) > 0 {
+		section("Unassigned", unassigned)
+	}
+	return b.String()
+}
+
+/*
+Accepts the ListMovies filters, source (score, the default, or manual),
+thresholds (e.g. S:95,A:85, the lowest JH_Score of each tier), format
+(json, markdown or layout) and, for layouts, columns and tile (width in
+pixels).
+Returns the movies grouped into S to F tiers, either by JH_Score or by
+the tiers assigned to each movie. With manual tiers, movies without one
+are listed as unassigned.
+*/
+func GetTiers(c *gin.Context) {
+	f, errs := ParseFilter(c)
+	source := c.DefaultQuery("source", "score")
+	if source != "score" && source != "manual" {
+		errs = append(errs, problem.FieldError{Field: "source", Detail: "source must be score or manual"})
+	}
+	thresholds, err := parseThresholds(c.Query("thresholds"))
+	if err != nil {
+		errs = append(errs, problem.FieldError{Field: "thresholds", Detail: err.Error()})
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "markdown" && format != "layout" {
+		errs = append(errs, problem.FieldError{Field: "format", Detail: "format must be json, markdown or layout"})
+	}
+	columns, err := strconv.Atoi(c.DefaultQuery("columns", strconv.Itoa(defaultColumn)))
+	if err != nil || columns < 1 || columns > 50 {
+		errs = append(errs, problem.FieldError{Field: "columns", Detail: "columns must be an integer from 1 to 50"})
+	}
+	tileWidth, err := strconv.Atoi(c.DefaultQuery("tile", strconv.Itoa(defaultTile)))
+	if err != nil || tileWidth < 20 || tileWidth > 500 {
+		errs = append(errs, problem.FieldError{Field: "tile", Detail: "tile must be an integer from 20 to 500"})
+	}
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	collection := client.Database("jdmovies").Collection("movies")
+
+	projection := bson.M{"Movie": 1, "Year": 1, "TMDBId": 1, "JH_Score": 1, "Genre": 1, "Genre_2": 1, "Runtime": 1, "Rated": 1, "Poster": 1, "Tier": 1}
+	sorting := bson.D{{Key: "JH_Score", Value: -1}, {Key: "Ranking", Value: 1}}
+	movies, err := FindMovies(c.Request.Context(), collection, f.Query(), options.Find().SetProjection(projection).SetSort(sorting))
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+
+	byTier := make(map[string][]MovieCard)
+	unassigned := []MovieCard{}
+	for _, m := range movies {
+		name := tierOf(m.JH_Score, thresholds)
+		if source == "manual" {
+			name = m.Tier
+		}
+		if !isTier(name) {
+			unassigned = append(unassigned, CardOf(m))
+			continue
+		}
+		byTier[name] = append(byTier[name], CardOf(m))
+	}
+
+	tiers := make([]tier, len(tierNames))
+	for i, name := range tierNames {
+		tiers[i] = tier{Tier: name, Count: len(byTier[name]), Movies: append([]MovieCard{}, byTier[name]...)}
+		if source == "score" {
+			min := thresholds[name]
+			tiers[i].Min = &min
+		}
+	}
+
+	switch format {
+	case "markdown":
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(markdownOf(tiers, unassigned)))
+	case "layout":
+		c.IndentedJSON(http.StatusOK, layoutOf(tiers, columns, tileWidth))
+	default:
+		c.IndentedJSON(http.StatusOK, gin.H{"source": source, "tiers": tiers, "unassigned": unassigned})
+	}
+}
+
+/*
+Accepts tmdbid (path) and tier (JSON, S to F, or empty to clear it).
+Assigns the movie's manual tier.
+*/
+func PutTier(c *gin.Context) {
+	tmdbid, ok := tmdbidParam(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Tier string `json:"tier"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		problem.BadRequest(c, "body", "Body must be JSON with a tier")
+		return
+	}
+	body.Tier = strings.ToUpper(strings.TrimSpace(body.Tier))
+	if body.Tier != "" && !isTier(body.Tier) {
+		problem.BadRequest(c, "tier", "tier must be one of S, A, B, C, D or F")
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	collection := client.Database("jdmovies").Collection("movies")
+
+	update := bson.M{"$set": bson.M{"Tier": body.Tier}}
+	if body.Tier == "" {
+		update = bson.M{"$unset": bson.M{"Tier": ""}}
+	}
+	result, err := collection.UpdateOne(c.Request.Context(), bson.M{"TMDBId": tmdbid}, update)
+	if err != nil {
+		problem.Error(c, err, "Failed to save tier")
+		return
+	}
+	if result.MatchedCount == 0 {
+		problem.NotFound(c, "No movie has this tmdbid")
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"tmdbid": tmdbid, "tier": body.Tier})
+}
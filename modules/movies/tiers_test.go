@@ -0,0 +1,188 @@
+package movies
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseThresholds(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    map[string]int32
+		wantErr string
+	}{
+		{"", defaultThresholds, ""},
+		{"S:95,A:85", map[string]int32{"S": 95, "A": 85, "B": 70, "C": 60, "D": 50, "F": 0}, ""},
+		{" s : 95 , d:10 ", map[string]int32{"S": 95, "A": 80, "B": 70, "C": 60, "D": 10, "F": 0}, ""},
+		{"S:100,A:99,B:98,C:97,D:1", map[string]int32{"S": 100, "A": 99, "B": 98, "C": 97, "D": 1, "F": 0}, ""},
+		{"S", nil, "thresholds must look like S:90,A:80 with tiers S to D and scores 0 to 100"},
+		{"S:high", nil, "thresholds must look like S:90,A:80 with tiers S to D and scores 0 to 100"},
+		{"E:40", nil, "thresholds must look like S:90,A:80 with tiers S to D and scores 0 to 100"},
+		{"F:10", nil, "thresholds must look like S:90,A:80 with tiers S to D and scores 0 to 100"},
+		{"S:101", nil, "thresholds must look like S:90,A:80 with tiers S to D and scores 0 to 100"},
+		{"D:-1", nil, "thresholds must look like S:90,A:80 with tiers S to D and scores 0 to 100"},
+		{"A:90", nil, "threshold for A must be below the one for S"},
+		{"S:75", nil, "threshold for A must be below the one for S"},
+		{"C:75", nil, "threshold for C must be below the one for B"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseThresholds(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The defaults can't be changed through a parsed copy
+	got, _ := parseThresholds("")
+	got["S"] = 1
+	if defaultThresholds["S"] != 90 {
+		t.Errorf("parsing changed the default thresholds")
+	}
+}
+
+func TestTierOf(t *testing.T) {
+	tests := []struct {
+		score int32
+		want  string
+	}{
+		{100, "S"},
+		{90, "S"},
+		{89, "A"},
+		{80, "A"},
+		{79, "B"},
+		{70, "B"},
+		{60, "C"},
+		{59, "D"},
+		{50, "D"},
+		{49, "F"},
+		{0, "F"},
+		{-5, "F"},
+	}
+	for _, tt := range tests {
+		if got := tierOf(tt.score, defaultThresholds); got != tt.want {
+			t.Errorf("tierOf(%d) = %s, want %s", tt.score, got, tt.want)
+		}
+	}
+
+	custom, _ := parseThresholds("S:95,D:10")
+	if got := tierOf(94, custom); got != "A" {
+		t.Errorf("tierOf(94) with S:95 = %s, want A", got)
+	}
+	if got := tierOf(10, custom); got != "D" {
+		t.Errorf("tierOf(10) with D:10 = %s, want D", got)
+	}
+}
+
+// Tiers S to F holding the given numbers of movies
+func tiersOf(counts ...int) []tier {
+	tiers := make([]tier, len(counts))
+	id := int32(1)
+	for i, count := range counts {
+		tiers[i] = tier{Tier: tierNames[i], Count: count, Movies: []MovieCard{}}
+		for j := 0; j < count; j++ {
+			tiers[i].Movies = append(tiers[i].Movies, MovieCard{TMDBId: id, Movie: "Movie " + string(rune('A'+id-1)), Year: 2000, JH_Score: 100 - id})
+			id++
+		}
+	}
+	return tiers
+}
+
+func TestLayoutOf(t *testing.T) {
+	// Two columns of 100 by 150 tiles: S wraps onto a second line, A is empty
+	layout := layoutOf(tiersOf(3, 0, 1, 0, 0, 0), 2, 100)
+
+	if got, want := layout["width"], labelWidth+2*(100+tileGap)+tileGap; got != want {
+		t.Errorf("got width %v, want %v", got, want)
+	}
+	line := 150 + tileGap
+	rows := layout["rows"].([]layoutRow)
+	if len(rows) != 6 {
+		t.Fatalf("got %d rows, want 6", len(rows))
+	}
+	wantRows := []struct {
+		y, height, tiles int
+	}{
+		{0, 2*line + tileGap, 3},
+		{2*line + tileGap, line + tileGap, 0},
+		{3*line + 2*tileGap, line + tileGap, 1},
+	}
+	for i, want := range wantRows {
+		row := rows[i]
+		if row.Tier != tierNames[i] || row.Color != tierColors[tierNames[i]] {
+			t.Errorf("row %d is %s in %s", i, row.Tier, row.Color)
+		}
+		if row.Y != want.y || row.Height != want.height || len(row.Tiles) != want.tiles {
+			t.Errorf("row %s at y %d, height %d with %d tiles, want %d, %d and %d", row.Tier, row.Y, row.Height, len(row.Tiles), want.y, want.height, want.tiles)
+		}
+	}
+	if got, want := layout["height"], 6*(line+tileGap)+line; got != want {
+		t.Errorf("got height %v, want %v", got, want)
+	}
+
+	first := labelWidth + tileGap
+	second := first + 100 + tileGap
+	wantTiles := []tile{
+		{TMDBId: 1, Movie: "Movie A", X: first, Y: tileGap, Width: 100, Height: 150},
+		{TMDBId: 2, Movie: "Movie B", X: second, Y: tileGap, Width: 100, Height: 150},
+		{TMDBId: 3, Movie: "Movie C", X: first, Y: tileGap + line, Width: 100, Height: 150},
+	}
+	if !reflect.DeepEqual(rows[0].Tiles, wantTiles) {
+		t.Errorf("got S tiles %+v, want %+v", rows[0].Tiles, wantTiles)
+	}
+	if got := rows[2].Tiles[0]; got.X != first || got.Y != rows[2].Y+tileGap {
+		t.Errorf("B tile at %d,%d, want %d,%d", got.X, got.Y, first, rows[2].Y+tileGap)
+	}
+}
+
+func TestMarkdownOf(t *testing.T) {
+	tiers := tiersOf(2, 0, 0, 0, 0, 1)
+	min := int32(90)
+	tiers[0].Min = &min
+
+	want := `# Tier list
+
+## S (90+)
+
+- Movie A (2000) - 99
+- Movie B (2000) - 98
+
+## A
+
+_None_
+
+## B
+
+_None_
+
+## C
+
+_None_
+
+## D
+
+_None_
+
+## F
+
+- Movie C (2000) - 97
+`
+	if got := markdownOf(tiers, nil); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	unassigned := []MovieCard{{Movie: "Loose", Year: 1999, JH_Score: 40}}
+	if got := markdownOf(tiers, unassigned); got != want+"\n## Unassigned\n\n- Loose (1999) - 40\n" {
+		t.Errorf("unassigned movies missing from\n%s", got)
+	}
+}
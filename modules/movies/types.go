@@ -30,7 +30,7 @@ type rating struct {
 	 Information about a movie as stored in the database. Some fields
 		will be empty.
 */
-type movie struct {
+type Movie struct {
 	Movie           string    `json:"movie"`
 	JH_Score        int32     `json:"jh_score"`
 	Universe        string    `json:"universe"`
@@ -61,4 +61,53 @@ type movie struct {
 	Metacritic      string    `json:"metacritic"`
 	Trailer         string    `json:"trailer"`
 	Ms_added        int64     `json:"ms_added"`
+	Reviewers       []Review  `bson:"Reviewers" json:"reviewers"`
+	Tier            string    `bson:"Tier" json:"tier"`
+}
+
+/*
+	 One reviewer's take on a movie. Score and Approved are optional since
+		some reviewers only score and others only approve.
+*/
+type Review struct {
+	Reviewer string `bson:"reviewer" json:"reviewer"`
+	Score    *int32 `bson:"score,omitempty" json:"score,omitempty"`
+	Review   string `bson:"review,omitempty" json:"review,omitempty"`
+	Approved *bool  `bson:"approved,omitempty" json:"approved,omitempty"`
+}
+
+// Compact view of a movie embedded in other responses
+type MovieCard struct {
+	Movie    string `json:"movie"`
+	Year     int32  `json:"year"`
+	TMDBId   int32  `json:"tmdbid"`
+	JH_Score int32  `json:"jh_score"`
+	Genre    string `json:"genre"`
+	Genre_2  string `json:"genre_2"`
+	Runtime  int32  `json:"runtime"`
+	Rated    string `json:"rated"`
+	Poster   string `json:"poster"`
+}
+
+func CardOf(m Movie) MovieCard {
+	return MovieCard{
+		Movie:    m.Movie,
+		Year:     m.Year,
+		TMDBId:   m.TMDBId,
+		JH_Score: m.JH_Score,
+		Genre:    m.Genre,
+		Genre_2:  m.Genre_2,
+		Runtime:  m.Runtime,
+		Rated:    m.Rated,
+		Poster:   m.Poster,
+	}
+}
+
+// Names of the services streaming the movie with a subscription
+func (m Movie) StreamingOn() []string {
+	names := []string{}
+	for _, p := range m.Provider.Flatrate {
+		names = append(names, p.Provider_name)
+	}
+	return names
 }
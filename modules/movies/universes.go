@@ -0,0 +1,233 @@
+package movies
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"github.com/helfy18/movie-site-api/modules/stats"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+	 Watch orders for a universe, stored in the universes collection. Release
+		overrides the order by Year, which can't separate movies from the
+		same year; Chronological is the order of events in the story.
+*/
+type universeOrder struct {
+	Name          string    `bson:"_id" json:"universe"`
+	Release       []int32   `bson:"release" json:"release"`
+	Chronological []int32   `bson:"chronological" json:"chronological"`
+	UpdatedAt     time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// A movie's place in a watch order
+type watchOrderEntry struct {
+	Position     int       `json:"position"`
+	Sub_Universe string    `json:"sub_universe"`
+	Movie        MovieCard `json:"movie"`
+	// True when the order doesn't list the movie and it was placed by release
+	Estimated bool `json:"estimated"`
+}
+
+// Movies of the universe, by Universe or Sub_Universe
+func universeMovies(c *gin.Context, collection *mongo.Collection, name string) ([]Movie, error) {
+	query := bson.M{"$or": bson.A{bson.M{"Universe": name}, bson.M{"Sub_Universe": name}}}
+	projection := bson.M{"Movie": 1, "Year": 1, "TMDBId": 1, "JH_Score": 1, "Genre": 1, "Genre_2": 1, "Runtime": 1, "Rated": 1, "Poster": 1, "Sub_Universe": 1}
+	return FindMovies(c.Request.Context(), collection, query, options.Find().SetProjection(projection))
+}
+
+/*
+Orders the movies for the mode: those in the explicit order first, as
+listed, then the rest by release. Listed ids no longer in the universe
+are skipped. Movies placed by release are estimated unless no release
+order is stored, when release order is the order asked for.
+*/
+func orderMovies(movies []Movie, order []int32, mode string) []watchOrderEntry {
+	byRelease := append([]Movie{}, movies...)
+	sort.SliceStable(byRelease, func(i, j int) bool {
+		if byRelease[i].Year != byRelease[j].Year {
+			return byRelease[i].Year < byRelease[j].Year
+		}
+		return byRelease[i].Movie < byRelease[j].Movie
+	})
+
+	byId := make(map[int32]Movie, len(movies))
+	for _, m := range movies {
+		byId[m.TMDBId] = m
+	}
+
+	entries := []watchOrderEntry{}
+	placed := make(map[int32]bool, len(movies))
+	add := func(m Movie, estimated bool) {
+		placed[m.TMDBId] = true
+		entries = append(entries, watchOrderEntry{Position: len(entries) + 1, Sub_Universe: m.Sub_Universe, Movie: CardOf(m), Estimated: estimated})
+	}
+	for _, id := range order {
+		if m, found := byId[id]; found && !placed[id] {
+			add(m, false)
+		}
+	}
+	for _, m := range byRelease {
+		if !placed[m.TMDBId] {
+			add(m, mode != "release" || len(order) > 0)
+		}
+	}
+	return entries
+}
+
+// Formats minutes as hours and minutes, e.g. "12h 5m"
+func formatRuntime(minutes int) string {
+	return fmt.Sprintf("%dh %dm", minutes/60, minutes%60)
+}
+
+/*
+Accepts name (path) and mode (release, the default, or chronological).
+Returns the universe's movies in watch order with their total runtime
+and average JH_Score. Movies missing from a stored order are placed by
+release and flagged as estimated.
+*/
+func GetWatchOrder(c *gin.Context) {
+	name := c.Param("name")
+	mode := c.DefaultQuery("mode", "release")
+	if mode != "release" && mode != "chronological" {
+		problem.BadRequest(c, "mode", "mode must be release or chronological")
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+
+	movies, err := universeMovies(c, db.Collection("movies"), name)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+	if len(movies) == 0 {
+		problem.NotFound(c, "No movies are in this universe")
+		return
+	}
+
+	var order universeOrder
+	err = db.Collection("universes").FindOne(c.Request.Context(), bson.M{"_id": name}).Decode(&order)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		problem.Error(c, err, "Failed to fetch watch order")
+		return
+	}
+	listed := order.Release
+	if mode == "chronological" {
+		listed = order.Chronological
+	}
+
+	runtime := 0
+	var scores []float64
+	for _, m := range movies {
+		runtime += int(m.Runtime)
+		scores = append(scores, float64(m.JH_Score))
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"universe":     name,
+		"mode":         mode,
+		"count":        len(movies),
+		"totalRuntime": runtime,
+		"runtime":      formatRuntime(runtime),
+		"averageScore": stats.Round(stats.Mean(scores)),
+		"movies":       orderMovies(movies, listed, mode),
+	})
+}
+
+// Problems with a watch order: tmdbids outside the universe or listed twice
+func checkWatchOrder(field string, ids []int32, inUniverse map[int32]bool) []problem.FieldError {
+	var errs []problem.FieldError
+	seen := make(map[int32]bool, len(ids))
+	for i, id := range ids {
+		position := field + "[" + strconv.Itoa(i) + "]"
+		if !inUniverse[id] {
+			errs = append(errs, problem.FieldError{Field: position, Detail: "tmdbid " + strconv.Itoa(int(id)) + " isn't in this universe"})
+		} else if seen[id] {
+			errs = append(errs, problem.FieldError{Field: position, Detail: "tmdbid " + strconv.Itoa(int(id)) + " is repeated"})
+		}
+		seen[id] = true
+	}
+	return errs
+}
+
+/*
+Accepts name (path) and release and chronological (JSON, tmdbids in
+order). Either can be left out to keep the stored one.
+Saves the universe's watch orders. Every tmdbid must be a movie of the
+universe, listed once.
+*/
+func PutWatchOrder(c *gin.Context) {
+	name := c.Param("name")
+	var body struct {
+		Release       *[]int32 `json:"release"`
+		Chronological *[]int32 `json:"chronological"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		problem.BadRequest(c, "body", "Body must be JSON with release or chronological tmdbid lists")
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+
+	movies, err := universeMovies(c, db.Collection("movies"), name)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+	if len(movies) == 0 {
+		problem.NotFound(c, "No movies are in this universe")
+		return
+	}
+	inUniverse := make(map[int32]bool, len(movies))
+	for _, m := range movies {
+		inUniverse[m.TMDBId] = true
+	}
+
+	var errs []problem.FieldError
+	set := bson.M{"updatedAt": time.Now()}
+	onInsert := bson.M{}
+	orders := []struct {
+		field string
+		ids   *[]int32
+	}{{"release", body.Release}, {"chronological", body.Chronological}}
+	for _, o := range orders {
+		field, ids := o.field, o.ids
+		if ids == nil {
+			onInsert[field] = bson.A{}
+			continue
+		}
+		errs = append(errs, checkWatchOrder(field, *ids, inUniverse)...)
+		set[field] = append([]int32{}, *ids...)
+	}
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+
+	update := bson.M{"$set": set}
+	if len(onInsert) > 0 {
+		update["$setOnInsert"] = onInsert
+	}
+	var order universeOrder
+	err = db.Collection("universes").FindOneAndUpdate(c.Request.Context(),
+		bson.M{"_id": name},
+		update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&order)
+	if err != nil {
+		problem.Error(c, err, "Failed to save watch order")
+		return
+	}
+	c.IndentedJSON(http.StatusOK, order)
+}
@@ -0,0 +1,144 @@
+package movies
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/problem"
+)
+
+// Episodes IV to VI and I, released out of story order
+var starWars = []Movie{
+	{TMDBId: 11, Movie: "A New Hope", Year: 1977},
+	{TMDBId: 1891, Movie: "The Empire Strikes Back", Year: 1980},
+	{TMDBId: 1892, Movie: "Return of the Jedi", Year: 1983},
+	{TMDBId: 1893, Movie: "The Phantom Menace", Year: 1999},
+}
+
+type placedMovie struct {
+	id        int32
+	estimated bool
+}
+
+func TestOrderMovies(t *testing.T) {
+	tests := []struct {
+		name  string
+		order []int32
+		mode  string
+		want  []placedMovie
+	}{
+		{
+			name: "no release order is exact",
+			mode: "release",
+			want: []placedMovie{{11, false}, {1891, false}, {1892, false}, {1893, false}},
+		},
+		{
+			name: "no chronological order is estimated",
+			mode: "chronological",
+			want: []placedMovie{{11, true}, {1891, true}, {1892, true}, {1893, true}},
+		},
+		{
+			name:  "stored order",
+			order: []int32{1893, 11, 1891, 1892},
+			mode:  "chronological",
+			want:  []placedMovie{{1893, false}, {11, false}, {1891, false}, {1892, false}},
+		},
+		{
+			name:  "partial chronological order",
+			order: []int32{1893, 1892},
+			mode:  "chronological",
+			want:  []placedMovie{{1893, false}, {1892, false}, {11, true}, {1891, true}},
+		},
+		{
+			name:  "partial release order",
+			order: []int32{1891},
+			mode:  "release",
+			want:  []placedMovie{{1891, false}, {11, true}, {1892, true}, {1893, true}},
+		},
+		{
+			name:  "ids gone from the universe and repeats are skipped",
+			order: []int32{1893, 999, 1893, 11},
+			mode:  "release",
+			want:  []placedMovie{{1893, false}, {11, false}, {1891, true}, {1892, true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := orderMovies(starWars, tt.order, tt.mode)
+			got := []placedMovie{}
+			for i, e := range entries {
+				if e.Position != i+1 {
+					t.Errorf("entry %d has position %d", i, e.Position)
+				}
+				got = append(got, placedMovie{e.Movie.TMDBId, e.Estimated})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderMoviesBreaksYearTiesByTitle(t *testing.T) {
+	entries := orderMovies([]Movie{{TMDBId: 2, Movie: "Beta", Year: 2000}, {TMDBId: 1, Movie: "Alpha", Year: 2000}}, nil, "release")
+	if entries[0].Movie.TMDBId != 1 || entries[1].Movie.TMDBId != 2 {
+		t.Errorf("got %v, want Alpha before Beta", entries)
+	}
+}
+
+func TestCheckWatchOrder(t *testing.T) {
+	inUniverse := map[int32]bool{11: true, 1891: true, 1892: true}
+	tests := []struct {
+		name string
+		ids  []int32
+		want []problem.FieldError
+	}{
+		{"valid", []int32{1892, 11, 1891}, nil},
+		{"empty", []int32{}, nil},
+		{
+			"outside the universe",
+			[]int32{11, 550},
+			[]problem.FieldError{{Field: "release[1]", Detail: "tmdbid 550 isn't in this universe"}},
+		},
+		{
+			"repeated",
+			[]int32{11, 1891, 11},
+			[]problem.FieldError{{Field: "release[2]", Detail: "tmdbid 11 is repeated"}},
+		},
+		{
+			"every problem is reported",
+			[]int32{550, 550, 11, 11},
+			[]problem.FieldError{
+				{Field: "release[0]", Detail: "tmdbid 550 isn't in this universe"},
+				{Field: "release[1]", Detail: "tmdbid 550 isn't in this universe"},
+				{Field: "release[3]", Detail: "tmdbid 11 is repeated"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkWatchOrder("release", tt.ids, inUniverse); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Bodies that aren't watch orders are rejected before the database is used
+func TestPutWatchOrderRejectsBadBodies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, body := range []string{"", "[]", `{"release": "1,2"}`, `{"chronological": [1, "two"]}`} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPut, "/universes/Star%20Wars/watch-order", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		PutWatchOrder(c)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("body %q: got status %d, want 400", body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package problem
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Media type for RFC 7807 problem details
+const ContentType = "application/problem+json"
+
+// Header carrying the id of a request, accepted from clients and echoed back
+const RequestIDHeader = "X-Request-ID"
+
+/*
+	 Problem types returned by the API. Relative URIs are allowed by
+		RFC 7807 and resolve against the API's own address.
+*/
+const (
+	TypeInvalidRequest = "/problems/invalid-request"
+	TypeNotFound       = "/problems/not-found"
+	TypeUnauthorized   = "/problems/unauthorized"
+	TypeForbidden      = "/problems/forbidden"
+	TypeConflict       = "/problems/conflict"
+	TypeInternal       = "/problems/internal-error"
+	TypeUnavailable    = "/problems/unavailable"
+)
+
+/*
+	 A single invalid input, named by the query parameter or body field.
+		Position is the 1-based character offset of a syntax error within
+		the value, when there is one.
+*/
+type FieldError struct {
+	Field    string `json:"field"`
+	Detail   string `json:"detail"`
+	Position int    `json:"position,omitempty"`
+}
+
+/*
+	 The body of every error response (RFC 7807). Errors is only set
+		for validation failures.
+*/
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+func typeFor(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return TypeInvalidRequest
+	case http.StatusNotFound:
+		return TypeNotFound
+	case http.StatusUnauthorized:
+		return TypeUnauthorized
+	case http.StatusForbidden:
+		return TypeForbidden
+	case http.StatusConflict:
+		return TypeConflict
+	case http.StatusServiceUnavailable:
+		return TypeUnavailable
+	}
+	if status >= 500 {
+		return TypeInternal
+	}
+	return "about:blank"
+}
+
+/*
+Middleware that assigns every request an id, reusing the one sent by the
+client when present. The id is echoed in the response header and in
+problem bodies so errors can be matched to server logs.
+*/
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > 64 {
+			buf := make([]byte, 8)
+			if _, err := rand.Read(buf); err == nil {
+				id = hex.EncodeToString(buf)
+			}
+		}
+		c.Set("requestId", id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+/*
+Writes a problem response with the given status and aborts the handler
+chain. Handlers must still return after calling it.
+*/
+func Abort(c *gin.Context, status int, detail string, errs ...FieldError) {
+	p := Problem{
+		Type:      typeFor(status),
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  c.Request.URL.Path,
+		RequestID: c.GetString("requestId"),
+		Errors:    errs,
+	}
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(status, p)
+}
+
+// Rejects a request with one or more invalid fields
+func Invalid(c *gin.Context, errs ...FieldError) {
+	detail := "The request has invalid parameters"
+	if len(errs) == 1 {
+		detail = errs[0].Detail
+	}
+	Abort(c, http.StatusBadRequest, detail, errs...)
+}
+
+// Rejects a request because of a single invalid field
+func BadRequest(c *gin.Context, field string, detail string) {
+	Invalid(c, FieldError{Field: field, Detail: detail})
+}
+
+func NotFound(c *gin.Context, detail string) {
+	Abort(c, http.StatusNotFound, detail)
+}
+
+/*
+Reports a failure to the client without exposing the underlying error,
+which is logged with the request id instead. mongo.ErrNoDocuments is
+reported as 404 since it only means nothing matched.
+*/
+func Error(c *gin.Context, err error, detail string) {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		NotFound(c, detail)
+		return
+	}
+	log.Printf("request %s: %s: %v", c.GetString("requestId"), detail, err)
+	Abort(c, http.StatusInternalServerError, detail)
+}
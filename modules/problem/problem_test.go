@@ -0,0 +1,141 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Serves handler at /movies behind RequestID and decodes the problem it writes
+func serve(t *testing.T, handler gin.HandlerFunc, requestID string) (*httptest.ResponseRecorder, Problem) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/movies", RequestID(), handler)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/movies?genre=x", nil)
+	if requestID != "" {
+		r.Header.Set(RequestIDHeader, requestID)
+	}
+	router.ServeHTTP(w, r)
+
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("body %s: %v", w.Body, err)
+	}
+	return w, p
+}
+
+func TestError(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		kind   string
+	}{
+		{"no documents", mongo.ErrNoDocuments, http.StatusNotFound, TypeNotFound},
+		{"wrapped no documents", fmt.Errorf("finding movie: %w", mongo.ErrNoDocuments), http.StatusNotFound, TypeNotFound},
+		{"other error", errors.New("connection refused"), http.StatusInternalServerError, TypeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, p := serve(t, func(c *gin.Context) {
+				Error(c, tt.err, "Failed to fetch movie")
+			}, "")
+			if w.Code != tt.status || p.Status != tt.status || p.Type != tt.kind {
+				t.Errorf("got %d with %+v, want %d of type %s", w.Code, p, tt.status, tt.kind)
+			}
+			if p.Detail != "Failed to fetch movie" || strings.Contains(w.Body.String(), "connection refused") {
+				t.Errorf("got body %s, want only the detail", w.Body)
+			}
+		})
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	year := FieldError{Field: "year", Detail: "year must be a number or range", Position: 5}
+	limit := FieldError{Field: "limit", Detail: "limit must be an integer from 1 to 100"}
+
+	tests := []struct {
+		name   string
+		errs   []FieldError
+		detail string
+	}{
+		{"one field", []FieldError{year}, "year must be a number or range"},
+		{"several fields", []FieldError{year, limit}, "The request has invalid parameters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, p := serve(t, func(c *gin.Context) {
+				Invalid(c, tt.errs...)
+			}, "")
+			want := Problem{
+				Type:      TypeInvalidRequest,
+				Title:     "Bad Request",
+				Status:    http.StatusBadRequest,
+				Detail:    tt.detail,
+				Instance:  "/movies",
+				RequestID: w.Header().Get(RequestIDHeader),
+				Errors:    tt.errs,
+			}
+			if w.Code != http.StatusBadRequest || !reflect.DeepEqual(p, want) {
+				t.Errorf("got %d with %+v, want %+v", w.Code, p, want)
+			}
+			if got := w.Header().Get("Content-Type"); got != ContentType {
+				t.Errorf("got Content-Type %q, want %q", got, ContentType)
+			}
+		})
+	}
+
+	// Positions are left out when there is none
+	w, _ := serve(t, func(c *gin.Context) {
+		BadRequest(c, "limit", "limit must be an integer from 1 to 100")
+	}, "")
+	if strings.Contains(w.Body.String(), "position") {
+		t.Errorf("got body %s, want no position", w.Body)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name  string
+		sent  string
+		reuse bool
+	}{
+		{"sent by the client", "abc-123", true},
+		{"missing", "", false},
+		{"too long", strings.Repeat("a", 65), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, p := serve(t, func(c *gin.Context) {
+				NotFound(c, "No movie has this tmdbid")
+			}, tt.sent)
+			id := w.Header().Get(RequestIDHeader)
+			if tt.reuse && id != tt.sent {
+				t.Errorf("got id %q, want %q", id, tt.sent)
+			}
+			if !tt.reuse && (len(id) != 16 || id == tt.sent) {
+				t.Errorf("got id %q, want 16 generated hex digits", id)
+			}
+			if p.RequestID != id {
+				t.Errorf("body has id %q, header has %q", p.RequestID, id)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package ranking
+
+import "math"
+
+// Glicko-1 constants. Deviations shrink as a movie is compared more
+const (
+	baseRating   = 1500.0
+	maxDeviation = 350.0
+	minDeviation = 30.0
+	// Spread of the ratings seeded from the hand-made Ranking
+	seedSpread = 400.0
+	// Deviation of movies seeded from Ranking, lower than unranked ones
+	seedDeviation = 200.0
+)
+
+var q = math.Ln10 / 400
+
+// A movie's rating and how unsure it is
+type rating struct {
+	Rating    float64 `bson:"rating" json:"rating"`
+	Deviation float64 `bson:"deviation" json:"deviation"`
+	Games     int     `bson:"games" json:"games"`
+}
+
+func g(deviation float64) float64 {
+	return 1 / math.Sqrt(1+3*q*q*deviation*deviation/(math.Pi*math.Pi))
+}
+
+// Chance that a beats b
+func expected(a rating, b rating) float64 {
+	return 1 / (1 + math.Pow(10, -g(b.Deviation)*(a.Rating-b.Rating)/400))
+}
+
+// a's rating after one game against b, scoring 1 for a win and 0 for a loss
+func update(a rating, b rating, score float64) rating {
+	e := expected(a, b)
+	gb := g(b.Deviation)
+	dSquared := 1 / (q * q * gb * gb * e * (1 - e))
+	precision := 1/(a.Deviation*a.Deviation) + 1/dSquared
+
+	return rating{
+		Rating:    a.Rating + q/precision*gb*(score-e),
+		Deviation: math.Max(minDeviation, math.Sqrt(1/precision)),
+		Games:     a.Games + 1,
+	}
+}
+
+// Starting rating of a movie that has no Ranking
+var unrated = rating{Rating: baseRating, Deviation: maxDeviation}
+
+/*
+Starting rating for the movie at position i of n ranked movies, spread
+evenly so the suggested order starts out as the current Ranking.
+*/
+func seed(i int, n int) rating {
+	if n <= 1 {
+		return rating{Rating: baseRating, Deviation: seedDeviation}
+	}
+	return rating{
+		Rating:    baseRating + seedSpread*(0.5-float64(i)/float64(n-1)),
+		Deviation: seedDeviation,
+	}
+}
@@ -0,0 +1,85 @@
+package ranking
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a float64, b float64, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+// Values from Glickman's worked example of the Glicko system
+func TestExpected(t *testing.T) {
+	player := rating{Rating: 1500, Deviation: 200}
+	tests := []struct {
+		opponent rating
+		g        float64
+		expected float64
+	}{
+		{rating{Rating: 1400, Deviation: 30}, 0.9955, 0.639},
+		{rating{Rating: 1550, Deviation: 100}, 0.9531, 0.432},
+		{rating{Rating: 1700, Deviation: 300}, 0.7242, 0.303},
+	}
+	for _, tt := range tests {
+		if got := g(tt.opponent.Deviation); !near(got, tt.g, 1e-4) {
+			t.Errorf("g(%v) = %.4f, want %.4f", tt.opponent.Deviation, got, tt.g)
+		}
+		if got := expected(player, tt.opponent); !near(got, tt.expected, 1e-3) {
+			t.Errorf("expected against %v = %.3f, want %.3f", tt.opponent.Rating, got, tt.expected)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		a, b      rating
+		score     float64
+		rating    float64
+		deviation float64
+	}{
+		{"expected win", rating{1500, 200, 4}, rating{1400, 30, 9}, 1, 1563.43, 175.22},
+		{"upset loss", rating{1500, 200, 4}, rating{1400, 30, 9}, 0, 1387.49, 175.22},
+		{"unknown movies move a lot", rating{1500, maxDeviation, 0}, rating{1500, maxDeviation, 0}, 1, 1662.21, 290.23},
+		{"settled movies barely move", rating{1500, minDeviation, 50}, rating{1500, minDeviation, 50}, 1, 1502.56, minDeviation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := update(tt.a, tt.b, tt.score)
+			if !near(got.Rating, tt.rating, 0.01) || !near(got.Deviation, tt.deviation, 0.01) {
+				t.Errorf("got %.2f ± %.2f, want %.2f ± %.2f", got.Rating, got.Deviation, tt.rating, tt.deviation)
+			}
+			if got.Games != tt.a.Games+1 {
+				t.Errorf("got %d games, want %d", got.Games, tt.a.Games+1)
+			}
+		})
+	}
+}
+
+func TestUpdateIsSymmetric(t *testing.T) {
+	a, b := rating{Rating: 1620, Deviation: 120}, rating{Rating: 1480, Deviation: 120}
+	winner, loser := update(a, b, 1), update(b, a, 0)
+	if gain, loss := winner.Rating-a.Rating, b.Rating-loser.Rating; !near(gain, loss, 1e-9) {
+		t.Errorf("winner gained %v but loser lost %v", gain, loss)
+	}
+}
+
+func TestSeed(t *testing.T) {
+	tests := []struct {
+		i, n int
+		want float64
+	}{
+		{0, 1, baseRating},
+		{0, 5, baseRating + seedSpread/2},
+		{2, 5, baseRating},
+		{4, 5, baseRating - seedSpread/2},
+		{1, 3, baseRating},
+	}
+	for _, tt := range tests {
+		got := seed(tt.i, tt.n)
+		if !near(got.Rating, tt.want, 1e-9) || got.Deviation != seedDeviation || got.Games != 0 {
+			t.Errorf("seed(%d, %d) = %+v, want rating %v", tt.i, tt.n, got, tt.want)
+		}
+	}
+}
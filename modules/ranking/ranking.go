@@ -0,0 +1,553 @@
+package ranking
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/auth"
+	"github.com/helfy18/movie-site-api/modules/movies"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// How many places either side of a movie its opponent is drawn from
+	neighborWindow = 3
+	// How long a served pair can be voted on
+	pairLifetime = 24 * time.Hour
+	// Times a vote is retried when another vote changes the same ratings
+	voteAttempts = 3
+)
+
+var (
+	errRatingChanged = errors.New("rating changed since it was read")
+	errPairNotServed = errors.New("pair was not served to the user")
+)
+
+/*
+	 The pair last served to a user by GetPair, stored in the rankingPairs
+		collection. Movies holds both tmdbids, smallest first, and is removed
+		once voted on so each pair counts once.
+*/
+type servedPair struct {
+	UserID   primitive.ObjectID `bson:"_id"`
+	Movies   []int32            `bson:"movies"`
+	ServedAt time.Time          `bson:"servedAt"`
+}
+
+// The tmdbids of a pair in the order they are stored
+func pairKey(a int32, b int32) []int32 {
+	if a > b {
+		a, b = b, a
+	}
+	return []int32{a, b}
+}
+
+// Creates the indexes ranking relies on: expiry of served pairs
+func EnsureIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("rankingPairs").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "servedAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(pairLifetime.Seconds())),
+	})
+	return err
+}
+
+/*
+	 A movie's rating as stored in the elo collection. The fields are spelled
+		out because the driver skips unexported embedded structs.
+*/
+type storedRating struct {
+	TMDBId    int32     `bson:"_id"`
+	Rating    float64   `bson:"rating"`
+	Deviation float64   `bson:"deviation"`
+	Games     int       `bson:"games"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+func storedRatingOf(tmdbid int32, r rating, now time.Time) storedRating {
+	return storedRating{TMDBId: tmdbid, Rating: r.Rating, Deviation: r.Deviation, Games: r.Games, UpdatedAt: now}
+}
+
+func (s storedRating) toRating() rating {
+	return rating{Rating: s.Rating, Deviation: s.Deviation, Games: s.Games}
+}
+
+// One pairwise vote, kept so ratings can be audited or replayed
+type comparison struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Winner    int32              `bson:"winner"`
+	Loser     int32              `bson:"loser"`
+	UserID    primitive.ObjectID `bson:"userId"`
+	CreatedAt time.Time          `bson:"createdAt"`
+}
+
+/*
+	 A movie's place in the suggested order. Change is how many places it
+		would move up (negative for down) if the order were accepted.
+*/
+type standing struct {
+	Movie     movies.MovieCard `json:"movie"`
+	Ranking   int32            `json:"ranking"`
+	Suggested int32            `json:"suggested"`
+	Change    int32            `json:"change"`
+	rating
+	// Whether the rating is in the elo collection rather than seeded
+	stored bool
+}
+
+/*
+Every movie ordered by rating. Movies never compared are seeded from
+their current Ranking; unranked ones start in the middle, fully uncertain.
+*/
+func loadStandings(ctx context.Context, db *mongo.Database) ([]standing, error) {
+	projection := bson.M{"Movie": 1, "Year": 1, "TMDBId": 1, "JH_Score": 1, "Genre": 1, "Genre_2": 1, "Runtime": 1, "Rated": 1, "Poster": 1, "Ranking": 1}
+	found, err := movies.FindMovies(ctx, db.Collection("movies"), bson.M{}, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := db.Collection("elo").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var stored []storedRating
+	if err := cursor.All(ctx, &stored); err != nil {
+		return nil, err
+	}
+	ratings := make(map[int32]rating, len(stored))
+	for _, s := range stored {
+		ratings[s.TMDBId] = s.toRating()
+	}
+
+	var ranked []movies.Movie
+	for _, m := range found {
+		if m.Ranking > 0 {
+			ranked = append(ranked, m)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Ranking < ranked[j].Ranking
+	})
+	seeds := make(map[int32]rating, len(ranked))
+	for i, m := range ranked {
+		seeds[m.TMDBId] = seed(i, len(ranked))
+	}
+
+	standings := make([]standing, len(found))
+	for i, m := range found {
+		r, stored := ratings[m.TMDBId]
+		if !stored {
+			r = unrated
+			if seeded, ranked := seeds[m.TMDBId]; ranked {
+				r = seeded
+			}
+		}
+		standings[i] = standing{Movie: movies.CardOf(m), Ranking: m.Ranking, rating: r, stored: stored}
+	}
+
+	sort.SliceStable(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		if a.Rating != b.Rating {
+			return a.Rating > b.Rating
+		}
+		if (a.Ranking > 0) != (b.Ranking > 0) {
+			return a.Ranking > 0
+		}
+		if a.Ranking != b.Ranking {
+			return a.Ranking < b.Ranking
+		}
+		return a.Movie.TMDBId < b.Movie.TMDBId
+	})
+	for i := range standings {
+		standings[i].Suggested = int32(i + 1)
+		if standings[i].Ranking > 0 {
+			standings[i].Change = standings[i].Ranking - standings[i].Suggested
+		}
+	}
+	return standings, nil
+}
+
+/*
+The stored rating of the movie, or the one it is seeded with from its
+Ranking when it has never been compared. Stored is false when seeded.
+*/
+func currentRating(ctx context.Context, db *mongo.Database, m movies.Movie) (current storedRating, stored bool, err error) {
+	err = db.Collection("elo").FindOne(ctx, bson.M{"_id": m.TMDBId}).Decode(&current)
+	if err == nil {
+		return current, true, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return current, false, err
+	}
+
+	r := unrated
+	if m.Ranking > 0 {
+		collection := db.Collection("movies")
+		ranked, err := collection.CountDocuments(ctx, bson.M{"Ranking": bson.M{"$gt": 0}})
+		if err != nil {
+			return current, false, err
+		}
+		ahead, err := collection.CountDocuments(ctx, bson.M{"Ranking": bson.M{"$gt": 0, "$lt": m.Ranking}})
+		if err != nil {
+			return current, false, err
+		}
+		r = seed(int(ahead), int(ranked))
+	}
+	return storedRatingOf(m.TMDBId, r, time.Time{}), false, nil
+}
+
+/*
+Writes a movie's new rating, failing with errRatingChanged when another
+vote saved it since previous was read.
+*/
+func saveRating(ctx context.Context, elo *mongo.Collection, previous storedRating, stored bool, r rating, now time.Time) error {
+	next := storedRatingOf(previous.TMDBId, r, now)
+	if !stored {
+		_, err := elo.InsertOne(ctx, next)
+		if mongo.IsDuplicateKeyError(err) {
+			return errRatingChanged
+		}
+		return err
+	}
+	result, err := elo.ReplaceOne(ctx, bson.M{"_id": previous.TMDBId, "games": previous.Games, "updatedAt": previous.UpdatedAt}, next)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errRatingChanged
+	}
+	return nil
+}
+
+// Identifies a suggested order so an admin accepts exactly the one they saw
+func orderToken(standings []standing) string {
+	h := fnv.New64a()
+	for _, s := range standings {
+		binary.Write(h, binary.BigEndian, s.Movie.TMDBId)
+	}
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+/*
+Draws a movie weighted by how uncertain its rating is, then pairs it
+with the most uncertain of its neighbors in the suggested order, where a
+vote says the most about the order.
+*/
+func pickPair(standings []standing) (standing, standing) {
+	total := 0.0
+	for _, s := range standings {
+		total += s.Deviation * s.Deviation
+	}
+	first := len(standings) - 1
+	target := rand.Float64() * total
+	for i, s := range standings {
+		target -= s.Deviation * s.Deviation
+		if target <= 0 {
+			first = i
+			break
+		}
+	}
+
+	second := -1
+	for i := max(0, first-neighborWindow); i <= min(len(standings)-1, first+neighborWindow); i++ {
+		if i == first {
+			continue
+		}
+		if second < 0 || standings[i].Deviation > standings[second].Deviation ||
+			(standings[i].Deviation == standings[second].Deviation && rand.IntN(2) == 0) {
+			second = i
+		}
+	}
+
+	// Show the pair in random order so position doesn't hint at the favorite
+	if rand.IntN(2) == 0 {
+		return standings[first], standings[second]
+	}
+	return standings[second], standings[first]
+}
+
+/*
+Accepts the ListMovies filters, limiting which movies are paired.
+Returns two movies to compare, favoring movies whose place in the order
+is least certain.
+*/
+func GetPair(c *gin.Context) {
+	f, errs := movies.ParseFilter(c)
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	ctx := c.Request.Context()
+
+	standings, err := loadStandings(ctx, db)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch rankings")
+		return
+	}
+
+	if query := f.Query(); len(query) > 0 {
+		matching, err := movies.FindMovies(ctx, db.Collection("movies"), query, options.Find().SetProjection(bson.M{"TMDBId": 1}))
+		if err != nil {
+			problem.Error(c, err, "Failed to fetch movies")
+			return
+		}
+		keep := make(map[int32]bool, len(matching))
+		for _, m := range matching {
+			keep[m.TMDBId] = true
+		}
+		filtered := []standing{}
+		for _, s := range standings {
+			if keep[s.Movie.TMDBId] {
+				filtered = append(filtered, s)
+			}
+		}
+		standings = filtered
+	}
+
+	if len(standings) < 2 {
+		problem.NotFound(c, "Fewer than two movies match the filters")
+		return
+	}
+	a, b := pickPair(standings)
+
+	// Remember the pair so only it can be voted on
+	pair := servedPair{UserID: auth.MustUser(c).ID, Movies: pairKey(a.Movie.TMDBId, b.Movie.TMDBId), ServedAt: time.Now()}
+	_, err = db.Collection("rankingPairs").ReplaceOne(ctx, bson.M{"_id": pair.UserID}, pair, options.Replace().SetUpsert(true))
+	if err != nil {
+		problem.Error(c, err, "Failed to save pair")
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"a": a.Movie, "b": b.Movie})
+}
+
+/*
+Accepts winner and loser (JSON, tmdbids), the pair last served to the
+user by GetPair.
+Records a vote between the two movies and updates both ratings. Each
+served pair can be voted on once. The ratings, the vote and the served
+pair are written in one transaction, retried when another vote changed
+the same ratings meanwhile.
+*/
+func PostComparison(c *gin.Context) {
+	var body struct {
+		Winner int32 `json:"winner"`
+		Loser  int32 `json:"loser"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		problem.BadRequest(c, "body", "Body must be JSON with winner and loser tmdbids")
+		return
+	}
+	if body.Winner == body.Loser {
+		problem.BadRequest(c, "loser", "winner and loser must be different movies")
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	ctx := c.Request.Context()
+	user := auth.MustUser(c)
+
+	found, err := movies.FindMovies(ctx, db.Collection("movies"),
+		bson.M{"TMDBId": bson.M{"$in": []int32{body.Winner, body.Loser}}},
+		options.Find().SetProjection(bson.M{"TMDBId": 1, "Ranking": 1}),
+	)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+	byId := make(map[int32]movies.Movie, len(found))
+	for _, m := range found {
+		byId[m.TMDBId] = m
+	}
+	winner, winnerFound := byId[body.Winner]
+	loser, loserFound := byId[body.Loser]
+	var errs []problem.FieldError
+	if !winnerFound {
+		errs = append(errs, problem.FieldError{Field: "winner", Detail: "no movie has this tmdbid"})
+	}
+	if !loserFound {
+		errs = append(errs, problem.FieldError{Field: "loser", Detail: "no movie has this tmdbid"})
+	}
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+
+	session, err := client.StartSession()
+	if err != nil {
+		problem.Error(c, err, "Failed to save ratings")
+		return
+	}
+	defer session.EndSession(ctx)
+
+	var won, lost rating
+	for attempt := 1; ; attempt++ {
+		_, err = session.WithTransaction(ctx, func(tx mongo.SessionContext) (interface{}, error) {
+			result, err := db.Collection("rankingPairs").DeleteOne(tx, bson.M{"_id": user.ID, "movies": pairKey(body.Winner, body.Loser)})
+			if err != nil {
+				return nil, err
+			}
+			if result.DeletedCount == 0 {
+				return nil, errPairNotServed
+			}
+
+			w, winnerStored, err := currentRating(tx, db, winner)
+			if err != nil {
+				return nil, err
+			}
+			l, loserStored, err := currentRating(tx, db, loser)
+			if err != nil {
+				return nil, err
+			}
+			// Both updates use the ratings from before the game
+			won = update(w.toRating(), l.toRating(), 1)
+			lost = update(l.toRating(), w.toRating(), 0)
+
+			now := time.Now()
+			elo := db.Collection("elo")
+			if err := saveRating(tx, elo, w, winnerStored, won, now); err != nil {
+				return nil, err
+			}
+			if err := saveRating(tx, elo, l, loserStored, lost, now); err != nil {
+				return nil, err
+			}
+			vote := comparison{ID: primitive.NewObjectID(), Winner: body.Winner, Loser: body.Loser, UserID: user.ID, CreatedAt: now}
+			return db.Collection("comparisons").InsertOne(tx, vote)
+		})
+		if !errors.Is(err, errRatingChanged) || attempt == voteAttempts {
+			break
+		}
+	}
+	switch {
+	case errors.Is(err, errPairNotServed):
+		problem.Abort(c, http.StatusConflict, "Vote on the pair from /ranking/pair, once")
+		return
+	case errors.Is(err, errRatingChanged):
+		problem.Abort(c, http.StatusConflict, "Other votes changed these ratings, try again")
+		return
+	case err != nil:
+		problem.Error(c, err, "Failed to save ratings")
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"winner": gin.H{"tmdbid": body.Winner, "rating": won},
+		"loser":  gin.H{"tmdbid": body.Loser, "rating": lost},
+	})
+}
+
+/*
+Accepts changed (true to list only movies that would move).
+Returns every movie in the order the votes suggest, next to its current
+Ranking, and a token identifying the order for AcceptRanking.
+*/
+func GetSuggestedRanking(c *gin.Context) {
+	changed := c.Query("changed")
+	if changed != "" && changed != "true" && changed != "false" {
+		problem.BadRequest(c, "changed", "changed must be true or false")
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	standings, err := loadStandings(c.Request.Context(), client.Database("jdmovies"))
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch rankings")
+		return
+	}
+
+	listed := standings
+	if changed == "true" {
+		listed = []standing{}
+		for _, s := range standings {
+			if s.Ranking != s.Suggested {
+				listed = append(listed, s)
+			}
+		}
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"order": orderToken(standings), "movies": listed})
+}
+
+/*
+Accepts order (JSON), the token from GetSuggestedRanking.
+Rewrites every movie's Ranking to the suggested order in one
+transaction. Fails with 409 if votes changed the order since the token
+was issued. Seeded ratings are saved too, since reseeding them from the
+new Ranking would shift the order again.
+*/
+func AcceptRanking(c *gin.Context) {
+	var body struct {
+		Order string `json:"order"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Order == "" {
+		problem.BadRequest(c, "order", "order must be the token from /ranking/suggested")
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	ctx := c.Request.Context()
+
+	standings, err := loadStandings(ctx, db)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch rankings")
+		return
+	}
+	if orderToken(standings) != body.Order {
+		problem.Abort(c, http.StatusConflict, "The suggested order changed, fetch it again before accepting")
+		return
+	}
+
+	updates := []mongo.WriteModel{}
+	seeded := []mongo.WriteModel{}
+	now := time.Now()
+	for _, s := range standings {
+		if s.Ranking != s.Suggested {
+			updates = append(updates, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"TMDBId": s.Movie.TMDBId}).
+				SetUpdate(bson.M{"$set": bson.M{"Ranking": s.Suggested}}))
+		}
+		if !s.stored {
+			seeded = append(seeded, mongo.NewReplaceOneModel().
+				SetFilter(bson.M{"_id": s.Movie.TMDBId}).
+				SetReplacement(storedRatingOf(s.Movie.TMDBId, s.rating, now)).
+				SetUpsert(true))
+		}
+	}
+
+	if len(updates) > 0 {
+		session, err := client.StartSession()
+		if err != nil {
+			problem.Error(c, err, "Failed to update rankings")
+			return
+		}
+		defer session.EndSession(ctx)
+
+		_, err = session.WithTransaction(ctx, func(tx mongo.SessionContext) (interface{}, error) {
+			if len(seeded) > 0 {
+				if _, err := db.Collection("elo").BulkWrite(tx, seeded); err != nil {
+					return nil, err
+				}
+			}
+			return db.Collection("movies").BulkWrite(tx, updates)
+		})
+		if err != nil {
+			problem.Error(c, err, "Failed to update rankings")
+			return
+		}
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"order": body.Order, "updated": len(updates)})
+}
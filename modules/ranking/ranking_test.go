@@ -0,0 +1,66 @@
+package ranking
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestStoredRatingRoundTrip(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		in   rating
+	}{
+		{"seeded", rating{Rating: 1700, Deviation: seedDeviation}},
+		{"compared", rating{Rating: 1432.5, Deviation: 87.25, Games: 12}},
+		{"unranked", rating{Rating: baseRating, Deviation: maxDeviation}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := bson.Marshal(storedRatingOf(42, tt.in, now))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var raw bson.M
+			if err := bson.Unmarshal(data, &raw); err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range []string{"_id", "rating", "deviation", "games", "updatedAt"} {
+				if _, found := raw[key]; !found {
+					t.Errorf("stored document is missing %q: %v", key, raw)
+				}
+			}
+
+			var out storedRating
+			if err := bson.Unmarshal(data, &out); err != nil {
+				t.Fatal(err)
+			}
+			if out.TMDBId != 42 || !out.UpdatedAt.Equal(now) {
+				t.Errorf("got id %d at %v, want 42 at %v", out.TMDBId, out.UpdatedAt, now)
+			}
+			if got := out.toRating(); got != tt.in {
+				t.Errorf("got %+v, want %+v", got, tt.in)
+			}
+		})
+	}
+}
+
+func TestPairKey(t *testing.T) {
+	tests := []struct {
+		a, b int32
+		want []int32
+	}{
+		{1, 2, []int32{1, 2}},
+		{2, 1, []int32{1, 2}},
+		{550, 13, []int32{13, 550}},
+	}
+	for _, tt := range tests {
+		got := pairKey(tt.a, tt.b)
+		if len(got) != 2 || got[0] != tt.want[0] || got[1] != tt.want[1] {
+			t.Errorf("pairKey(%d, %d) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
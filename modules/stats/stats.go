@@ -0,0 +1,147 @@
+package stats
+
+import (
+	"math"
+	"sort"
+)
+
+// Range of scores histograms cover by default
+const (
+	ScoreMin = 0
+	ScoreMax = 100
+)
+
+// Number of values falling in [Min, Max), or [Min, Max] for the last bucket
+type Bucket struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int     `json:"count"`
+}
+
+// Distribution of a set of values
+type Summary struct {
+	Count     int      `json:"count"`
+	Average   float64  `json:"average"`
+	Median    float64  `json:"median"`
+	StdDev    float64  `json:"stdDev"`
+	Min       float64  `json:"min"`
+	Max       float64  `json:"max"`
+	Histogram []Bucket `json:"histogram,omitempty"`
+}
+
+// Rounds to two decimals so responses stay readable
+func Round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+func Mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func Median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// Population standard deviation
+func StdDev(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	mean := Mean(values)
+	sum := 0.0
+	for _, v := range values {
+		sum += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(sum / float64(len(values)))
+}
+
+/*
+Counts values in buckets of the given width from ScoreMin up to
+ScoreMax, or up to the largest value when it is higher.
+*/
+func Histogram(values []float64, width float64) []Bucket {
+	if width <= 0 {
+		return nil
+	}
+	upper := float64(ScoreMax)
+	for _, v := range values {
+		upper = math.Max(upper, v)
+	}
+
+	var buckets []Bucket
+	for start := float64(ScoreMin); start < upper; start += width {
+		buckets = append(buckets, Bucket{Min: start, Max: math.Min(start+width, upper)})
+	}
+	for _, v := range values {
+		i := int(math.Floor((v - ScoreMin) / width))
+		if i >= len(buckets) {
+			i = len(buckets) - 1
+		}
+		if i >= 0 {
+			buckets[i].Count++
+		}
+	}
+	return buckets
+}
+
+/*
+Summarizes values. Histogram is only filled when bucketWidth is
+positive.
+*/
+func Summarize(values []float64, bucketWidth float64) Summary {
+	summary := Summary{
+		Count:     len(values),
+		Average:   Round(Mean(values)),
+		Median:    Round(Median(values)),
+		StdDev:    Round(StdDev(values)),
+		Histogram: Histogram(values, bucketWidth),
+	}
+	if len(values) > 0 {
+		summary.Min, summary.Max = values[0], values[0]
+		for _, v := range values {
+			summary.Min = math.Min(summary.Min, v)
+			summary.Max = math.Max(summary.Max, v)
+		}
+	}
+	return summary
+}
+
+/*
+Pearson correlation of paired values. ok is false when there are fewer
+than two pairs or either side doesn't vary.
+*/
+func Pearson(xs []float64, ys []float64) (float64, bool) {
+	if len(xs) != len(ys) || len(xs) < 2 {
+		return 0, false
+	}
+	meanX, meanY := Mean(xs), Mean(ys)
+
+	var covariance, varianceX, varianceY float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		covariance += dx * dy
+		varianceX += dx * dx
+		varianceY += dy * dy
+	}
+	if varianceX == 0 || varianceY == 0 {
+		return 0, false
+	}
+	return covariance / math.Sqrt(varianceX*varianceY), true
+}
@@ -0,0 +1,138 @@
+package stats
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestAverages(t *testing.T) {
+	tests := []struct {
+		name                 string
+		values               []float64
+		mean, median, stdDev float64
+	}{
+		{"empty", nil, 0, 0, 0},
+		{"one value", []float64{42}, 42, 42, 0},
+		{"odd count", []float64{3, 1, 2}, 2, 2, math.Sqrt(2.0 / 3)},
+		{"even count", []float64{4, 1, 3, 2}, 2.5, 2.5, math.Sqrt(1.25)},
+		{"constant", []float64{7, 7, 7, 7}, 7, 7, 0},
+		{"spread", []float64{2, 4, 4, 4, 5, 5, 7, 9}, 5, 4.5, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Mean(tt.values); !close(got, tt.mean) {
+				t.Errorf("Mean = %v, want %v", got, tt.mean)
+			}
+			if got := Median(tt.values); !close(got, tt.median) {
+				t.Errorf("Median = %v, want %v", got, tt.median)
+			}
+			if got := StdDev(tt.values); !close(got, tt.stdDev) {
+				t.Errorf("StdDev = %v, want %v", got, tt.stdDev)
+			}
+		})
+	}
+}
+
+func TestMedianLeavesValuesUnsorted(t *testing.T) {
+	values := []float64{3, 1, 2}
+	Median(values)
+	if !reflect.DeepEqual(values, []float64{3, 1, 2}) {
+		t.Errorf("Median reordered its input to %v", values)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		width  float64
+		want   []Bucket
+	}{
+		{"no width", []float64{50}, 0, nil},
+		{
+			"top score lands in the last bucket",
+			[]float64{0, 24.9, 25, 99, 100},
+			25,
+			[]Bucket{{0, 25, 2}, {25, 50, 1}, {50, 75, 0}, {75, 100, 2}},
+		},
+		{
+			"uneven last bucket",
+			[]float64{95},
+			30,
+			[]Bucket{{0, 30, 0}, {30, 60, 0}, {60, 90, 0}, {90, 100, 1}},
+		},
+		{
+			"values above the score range extend it",
+			[]float64{10, 130},
+			50,
+			[]Bucket{{0, 50, 1}, {50, 100, 0}, {100, 130, 1}},
+		},
+		{
+			"values below the score range are left out",
+			[]float64{-5, 5},
+			50,
+			[]Bucket{{0, 50, 1}, {50, 100, 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Histogram(tt.values, tt.width); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	got := Summarize([]float64{70, 90, 80, 60}, 0)
+	want := Summary{Count: 4, Average: 75, Median: 75, StdDev: 11.18, Min: 60, Max: 90}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if empty := Summarize(nil, 10); empty.Count != 0 || empty.Min != 0 || empty.Max != 0 || len(empty.Histogram) != 10 {
+		t.Errorf("got %+v for no values", empty)
+	}
+}
+
+func TestPearson(t *testing.T) {
+	tests := []struct {
+		name   string
+		xs, ys []float64
+		want   float64
+		ok     bool
+	}{
+		{"perfect", []float64{1, 2, 3}, []float64{10, 20, 30}, 1, true},
+		{"inverse", []float64{1, 2, 3}, []float64{3, 2, 1}, -1, true},
+		{"partial", []float64{1, 2, 3, 4}, []float64{2, 1, 4, 3}, 0.6, true},
+		{"one pair", []float64{1}, []float64{1}, 0, false},
+		{"mismatched lengths", []float64{1, 2}, []float64{1, 2, 3}, 0, false},
+		{"no variance", []float64{5, 5, 5}, []float64{1, 2, 3}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Pearson(tt.xs, tt.ys)
+			if ok != tt.ok || !close(got, tt.want) {
+				t.Errorf("got %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct{ value, want float64 }{
+		{1.234, 1.23},
+		{1.235, 1.24},
+		{-1.239, -1.24},
+		{80, 80},
+	}
+	for _, tt := range tests {
+		if got := Round(tt.value); got != tt.want {
+			t.Errorf("Round(%v) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func close(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
@@ -0,0 +1,623 @@
+package tournaments
+
+import (
+	"context"
+	"errors"
+	"math/bits"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/auth"
+	"github.com/helfy18/movie-site-api/modules/movies"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Bracket sizes a tournament can have
+var sizes = map[int]bool{8: true, 16: true, 32: true, 64: true}
+
+// Longest a round can be left open for, in hours
+const maxRoundHours = 24 * 30
+
+// Errors advancing a round
+var (
+	errRoundClosed = errors.New("round already closed")
+	errFinished    = errors.New("tournament is finished")
+)
+
+/*
+Creates the indexes tournaments rely on: one vote per user and matchup,
+and listing by date.
+*/
+func EnsureIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("tournamentVotes").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tournamentId", Value: 1}, {Key: "round", Value: 1}, {Key: "slot", Value: 1}, {Key: "userId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection("tournaments").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: -1}},
+	})
+	return err
+}
+
+/*
+The seeds in bracket order for size entrants, so that the best seeds
+only meet in the late rounds: 1 v 8, 4 v 5, 2 v 7, 3 v 6 for 8.
+*/
+func bracketOrder(size int) []int {
+	order := []int{1}
+	for len(order) < size {
+		n := len(order) * 2
+		next := make([]int, 0, n)
+		for _, seed := range order {
+			next = append(next, seed, n+1-seed)
+		}
+		order = next
+	}
+	return order
+}
+
+// Reads the id route parameter, rejecting the request when it is invalid
+func tournamentIdParam(c *gin.Context) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		problem.BadRequest(c, "id", "id must be a tournament id")
+		return id, false
+	}
+	return id, true
+}
+
+// Movie cards for every entrant of the tournament, by tmdbid
+func entrantCards(ctx context.Context, db *mongo.Database, t tournament) (map[int32]movies.MovieCard, error) {
+	ids := []int32{}
+	for _, m := range t.Matchups {
+		if m.Round == 1 {
+			ids = append(ids, m.A.TMDBId, m.B.TMDBId)
+		}
+	}
+	projection := bson.M{"Movie": 1, "Year": 1, "TMDBId": 1, "JH_Score": 1, "Genre": 1, "Genre_2": 1, "Runtime": 1, "Rated": 1, "Poster": 1}
+	found, err := movies.FindMovies(ctx, db.Collection("movies"), bson.M{"TMDBId": bson.M{"$in": ids}}, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, err
+	}
+	cards := make(map[int32]movies.MovieCard, len(found))
+	for _, m := range found {
+		cards[m.TMDBId] = movies.CardOf(m)
+	}
+	return cards, nil
+}
+
+// Votes for each movie in the matchups of a round, by slot then tmdbid
+func tallyRound(ctx context.Context, db *mongo.Database, id primitive.ObjectID, round int) (map[int]map[int32]int, error) {
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{"tournamentId": id, "round": round}},
+		bson.M{"$group": bson.M{"_id": bson.M{"slot": "$slot", "pick": "$pick"}, "votes": bson.M{"$sum": 1}}},
+	}
+	cursor, err := db.Collection("tournamentVotes").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ID struct {
+			Slot int   `bson:"slot"`
+			Pick int32 `bson:"pick"`
+		} `bson:"_id"`
+		Votes int `bson:"votes"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	tally := make(map[int]map[int32]int)
+	for _, row := range rows {
+		if tally[row.ID.Slot] == nil {
+			tally[row.ID.Slot] = make(map[int32]int)
+		}
+		tally[row.ID.Slot][row.ID.Pick] = row.Votes
+	}
+	return tally, nil
+}
+
+/*
+Closes the tournament's current round. The movie with more votes wins
+each matchup and ties go to the better seed, so a matchup nobody voted on
+follows the seeding. Winners of neighboring matchups meet in the next
+round; after the final the tournament is finished.
+*/
+func advanceRound(ctx context.Context, db *mongo.Database, t *tournament, now time.Time) error {
+	if t.Status == finished {
+		return errFinished
+	}
+	tally, err := tallyRound(ctx, db, t.ID, t.Round)
+	if err != nil {
+		return err
+	}
+
+	round := t.Round
+	var winners []entrant
+	for i := range t.Matchups {
+		m := &t.Matchups[i]
+		if m.Round != round {
+			continue
+		}
+		m.VotesA, m.VotesB = tally[m.Slot][m.A.TMDBId], tally[m.Slot][m.B.TMDBId]
+		winner := m.A
+		if m.VotesB > m.VotesA || (m.VotesB == m.VotesA && m.B.Seed < m.A.Seed) {
+			winner = m.B
+		}
+		m.Winner = &winner.TMDBId
+		winners = append(winners, winner)
+	}
+
+	if len(winners) == 1 {
+		t.Status = finished
+		t.Champion = &winners[0].TMDBId
+		t.RoundEnds = nil
+	} else {
+		for slot := 0; slot < len(winners)/2; slot++ {
+			t.Matchups = append(t.Matchups, matchup{Round: round + 1, Slot: slot, A: winners[2*slot], B: winners[2*slot+1]})
+		}
+		t.Round++
+		if t.RoundHours > 0 {
+			ends := now.Add(time.Duration(t.RoundHours) * time.Hour)
+			t.RoundEnds = &ends
+		}
+	}
+	t.UpdatedAt = now
+
+	// Only one request gets to close a round
+	result, err := db.Collection("tournaments").ReplaceOne(ctx, bson.M{"_id": t.ID, "round": round, "status": voting}, t)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errRoundClosed
+	}
+	return nil
+}
+
+/*
+Finds the tournament in the path, closing its round first if the round's
+time is up. Responds with a problem and returns false when it can't.
+*/
+func loadTournament(c *gin.Context, db *mongo.Database) (tournament, bool) {
+	var t tournament
+	id, ok := tournamentIdParam(c)
+	if !ok {
+		return t, false
+	}
+	ctx := c.Request.Context()
+	collection := db.Collection("tournaments")
+
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&t)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		problem.NotFound(c, "No tournament has this id")
+		return t, false
+	}
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch tournament")
+		return t, false
+	}
+
+	now := time.Now()
+	if t.Status == voting && t.RoundEnds != nil && now.After(*t.RoundEnds) {
+		err := advanceRound(ctx, db, &t, now)
+		if errors.Is(err, errRoundClosed) {
+			// Another request closed it, so read what it wrote
+			err = collection.FindOne(ctx, bson.M{"_id": id}).Decode(&t)
+		}
+		if err != nil {
+			problem.Error(c, err, "Failed to close round")
+			return t, false
+		}
+	}
+	return t, true
+}
+
+/*
+Builds the matchups as returned, with votes so far for the open round
+and the user's picks when logged in.
+*/
+func matchupViews(ctx context.Context, db *mongo.Database, t tournament, user *auth.User) ([]matchupView, error) {
+	cards, err := entrantCards(ctx, db, t)
+	if err != nil {
+		return nil, err
+	}
+	tally := map[int]map[int32]int{}
+	if t.Status == voting {
+		tally, err = tallyRound(ctx, db, t.ID, t.Round)
+		if err != nil {
+			return nil, err
+		}
+	}
+	picks := make(map[[2]int]int32)
+	if user != nil {
+		cursor, err := db.Collection("tournamentVotes").Find(ctx, bson.M{"tournamentId": t.ID, "userId": user.ID})
+		if err != nil {
+			return nil, err
+		}
+		var votes []vote
+		if err := cursor.All(ctx, &votes); err != nil {
+			return nil, err
+		}
+		for _, v := range votes {
+			picks[[2]int{v.Round, v.Slot}] = v.Pick
+		}
+	}
+
+	views := []matchupView{}
+	for _, m := range t.Matchups {
+		view := matchupView{
+			Round:  m.Round,
+			Slot:   m.Slot,
+			A:      entrantView{Seed: m.A.Seed, Votes: m.VotesA, Movie: cards[m.A.TMDBId]},
+			B:      entrantView{Seed: m.B.Seed, Votes: m.VotesB, Movie: cards[m.B.TMDBId]},
+			Winner: m.Winner,
+		}
+		if m.Winner == nil {
+			view.A.Votes = tally[m.Slot][m.A.TMDBId]
+			view.B.Votes = tally[m.Slot][m.B.TMDBId]
+		}
+		if pick, voted := picks[[2]int{m.Round, m.Slot}]; voted {
+			view.MyVote = &pick
+		}
+		views = append(views, view)
+	}
+	return views, nil
+}
+
+// Rejects the request unless the user created the tournament or is an admin
+func requireOrganizer(c *gin.Context, t tournament) bool {
+	user := auth.MustUser(c)
+	if user.ID != t.CreatedBy && !user.Admin {
+		problem.Abort(c, http.StatusForbidden, "Only the tournament's creator or an admin can do this")
+		return false
+	}
+	return true
+}
+
+/*
+Accepts title, size (8, 16, 32 or 64) and roundHours (optional hours
+each round stays open before closing itself) as JSON, and the ListMovies
+filters in the query string.
+Creates a bracket of the size best Ranked movies matching the filters,
+seeded by Ranking.
+*/
+func CreateTournament(c *gin.Context) {
+	f, errs := movies.ParseFilter(c)
+	var body struct {
+		Title      string `json:"title"`
+		Size       int    `json:"size"`
+		RoundHours int    `json:"roundHours"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		problem.BadRequest(c, "body", "Body must be JSON with a title and size")
+		return
+	}
+	body.Title = strings.TrimSpace(body.Title)
+	if body.Title == "" || len(body.Title) > 100 {
+		errs = append(errs, problem.FieldError{Field: "title", Detail: "title must be 1 to 100 characters"})
+	}
+	if !sizes[body.Size] {
+		errs = append(errs, problem.FieldError{Field: "size", Detail: "size must be 8, 16, 32 or 64"})
+	}
+	if body.RoundHours < 0 || body.RoundHours > maxRoundHours {
+		errs = append(errs, problem.FieldError{Field: "roundHours", Detail: "roundHours must be an integer from 0 to 720"})
+	}
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	ctx := c.Request.Context()
+	user := auth.MustUser(c)
+
+	// Unranked movies can't be seeded
+	query := bson.M{"$and": bson.A{f.Query(), bson.M{"Ranking": bson.M{"$gt": 0}}}}
+	findOptions := options.Find().
+		SetProjection(bson.M{"TMDBId": 1, "Ranking": 1}).
+		SetSort(bson.D{{Key: "Ranking", Value: 1}}).
+		SetLimit(int64(body.Size))
+	seeded, err := movies.FindMovies(ctx, db.Collection("movies"), query, findOptions)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+	if len(seeded) < body.Size {
+		problem.BadRequest(c, "size", "Fewer ranked movies match the filters than the bracket needs")
+		return
+	}
+
+	now := time.Now()
+	t := tournament{
+		ID:         primitive.NewObjectID(),
+		Title:      body.Title,
+		Size:       body.Size,
+		Filters:    c.Request.URL.RawQuery,
+		CreatedBy:  user.ID,
+		Creator:    user.Username,
+		Status:     voting,
+		Round:      1,
+		Rounds:     bits.Len(uint(body.Size)) - 1,
+		RoundHours: body.RoundHours,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if body.RoundHours > 0 {
+		ends := now.Add(time.Duration(body.RoundHours) * time.Hour)
+		t.RoundEnds = &ends
+	}
+	order := bracketOrder(body.Size)
+	for slot := 0; slot < body.Size/2; slot++ {
+		a, b := order[2*slot], order[2*slot+1]
+		t.Matchups = append(t.Matchups, matchup{
+			Round: 1,
+			Slot:  slot,
+			A:     entrant{TMDBId: seeded[a-1].TMDBId, Seed: a},
+			B:     entrant{TMDBId: seeded[b-1].TMDBId, Seed: b},
+		})
+	}
+
+	if _, err := db.Collection("tournaments").InsertOne(ctx, t); err != nil {
+		problem.Error(c, err, "Failed to create tournament")
+		return
+	}
+	views, err := matchupViews(ctx, db, t, user)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch tournament")
+		return
+	}
+	c.IndentedJSON(http.StatusCreated, gin.H{"tournament": t, "matchups": views})
+}
+
+/*
+Accepts status (voting or finished).
+Returns tournaments newest first, without their matchups.
+*/
+func ListTournaments(c *gin.Context) {
+	query := bson.M{}
+	if status := c.Query("status"); status != "" {
+		if status != voting && status != finished {
+			problem.BadRequest(c, "status", "status must be voting or finished")
+			return
+		}
+		query["status"] = status
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	collection := client.Database("jdmovies").Collection("tournaments")
+	ctx := c.Request.Context()
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetProjection(bson.M{"matchups": 0})
+	cursor, err := collection.Find(ctx, query, findOptions)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch tournaments")
+		return
+	}
+	found := []tournament{}
+	if err := cursor.All(ctx, &found); err != nil {
+		problem.Error(c, err, "Failed to fetch tournaments")
+		return
+	}
+	c.IndentedJSON(http.StatusOK, found)
+}
+
+/*
+Accepts id (path).
+Returns the tournament with every matchup so far, the votes in each and,
+for logged-in users, their picks.
+*/
+func GetTournament(c *gin.Context) {
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+
+	t, ok := loadTournament(c, db)
+	if !ok {
+		return
+	}
+	views, err := matchupViews(c.Request.Context(), db, t, auth.CurrentUser(c))
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch tournament")
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"tournament": t, "matchups": views})
+}
+
+/*
+Accepts id (path), and slot (the matchup's position in the current round)
+and pick (the tmdbid voted for) as JSON.
+Records the user's vote, replacing an earlier one in the same matchup.
+Only matchups of the round being voted on take votes.
+*/
+func Vote(c *gin.Context) {
+	var body struct {
+		Slot *int   `json:"slot"`
+		Pick *int32 `json:"pick"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Slot == nil || body.Pick == nil {
+		problem.BadRequest(c, "body", "Body must be JSON with a slot and pick")
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	ctx := c.Request.Context()
+	user := auth.MustUser(c)
+
+	t, ok := loadTournament(c, db)
+	if !ok {
+		return
+	}
+	if t.Status == finished {
+		problem.Abort(c, http.StatusConflict, "This tournament is finished")
+		return
+	}
+	var current *matchup
+	for i, m := range t.Matchups {
+		if m.Round == t.Round && m.Slot == *body.Slot {
+			current = &t.Matchups[i]
+		}
+	}
+	if current == nil {
+		problem.BadRequest(c, "slot", "slot must be a matchup of the current round")
+		return
+	}
+	if *body.Pick != current.A.TMDBId && *body.Pick != current.B.TMDBId {
+		problem.BadRequest(c, "pick", "pick must be the tmdbid of one of the matchup's movies")
+		return
+	}
+
+	v := vote{
+		TournamentID: t.ID,
+		Round:        t.Round,
+		Slot:         current.Slot,
+		UserID:       user.ID,
+		Pick:         *body.Pick,
+		UpdatedAt:    time.Now(),
+	}
+	filter := bson.M{"tournamentId": v.TournamentID, "round": v.Round, "slot": v.Slot, "userId": v.UserID}
+	_, err := db.Collection("tournamentVotes").ReplaceOne(ctx, filter, v, options.Replace().SetUpsert(true))
+	if err != nil {
+		problem.Error(c, err, "Failed to save vote")
+		return
+	}
+
+	tally, err := tallyRound(ctx, db, t.ID, t.Round)
+	if err != nil {
+		problem.Error(c, err, "Failed to count votes")
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"round": v.Round,
+		"slot":  v.Slot,
+		"pick":  v.Pick,
+		"votes": gin.H{
+			"a": tally[v.Slot][current.A.TMDBId],
+			"b": tally[v.Slot][current.B.TMDBId],
+		},
+	})
+}
+
+/*
+Accepts id (path).
+Closes the current round and opens the next, for the tournament's creator
+or an admin. Rounds with roundHours close on their own.
+*/
+func AdvanceTournament(c *gin.Context) {
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	ctx := c.Request.Context()
+
+	t, ok := loadTournament(c, db)
+	if !ok || !requireOrganizer(c, t) {
+		return
+	}
+	err := advanceRound(ctx, db, &t, time.Now())
+	if errors.Is(err, errFinished) {
+		problem.Abort(c, http.StatusConflict, "This tournament is finished")
+		return
+	}
+	if errors.Is(err, errRoundClosed) {
+		problem.Abort(c, http.StatusConflict, "The round was closed by another request")
+		return
+	}
+	if err != nil {
+		problem.Error(c, err, "Failed to close round")
+		return
+	}
+
+	views, err := matchupViews(ctx, db, t, auth.CurrentUser(c))
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch tournament")
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"tournament": t, "matchups": views})
+}
+
+/*
+How far each entrant of the tournament got with its votes, still in
+first, then by place and seed.
+*/
+func rankResults(t tournament, cards map[int32]movies.MovieCard) []placement {
+	byId := make(map[int32]*placement)
+	for _, m := range t.Matchups {
+		for _, e := range []entrant{m.A, m.B} {
+			if byId[e.TMDBId] == nil {
+				byId[e.TMDBId] = &placement{Seed: e.Seed, Movie: cards[e.TMDBId]}
+			}
+		}
+		if m.Winner == nil {
+			continue
+		}
+		winner, loser := m.A, m.B
+		winnerVotes, loserVotes := m.VotesA, m.VotesB
+		if *m.Winner == m.B.TMDBId {
+			winner, loser = m.B, m.A
+			winnerVotes, loserVotes = m.VotesB, m.VotesA
+		}
+		w, l := byId[winner.TMDBId], byId[loser.TMDBId]
+		w.Wins++
+		w.VotesFor += winnerVotes
+		w.VotesAgainst += loserVotes
+		if winner.Seed > loser.Seed {
+			w.Upsets++
+		}
+		l.VotesFor += loserVotes
+		l.VotesAgainst += winnerVotes
+		l.EliminatedIn = m.Round
+		// Everyone out in a round shares the place after those still in
+		l.Place = 1<<(t.Rounds-m.Round) + 1
+	}
+	if t.Champion != nil {
+		byId[*t.Champion].Place = 1
+	}
+
+	results := make([]placement, 0, len(byId))
+	for _, p := range byId {
+		results = append(results, *p)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		// Movies still in come first, then by the round they went out in
+		if (a.Place == 0) != (b.Place == 0) {
+			return a.Place == 0
+		}
+		if a.Place != b.Place {
+			return a.Place < b.Place
+		}
+		return a.Seed < b.Seed
+	})
+	return results
+}
+
+/*
+Accepts id (path).
+Returns every entrant ordered by how far it got, with its wins, votes and
+upsets. Movies still in have no place until the tournament finishes.
+*/
+func GetResults(c *gin.Context) {
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+
+	t, ok := loadTournament(c, db)
+	if !ok {
+		return
+	}
+	cards, err := entrantCards(c.Request.Context(), db, t)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"tournament": t, "results": rankResults(t, cards)})
+}
@@ -0,0 +1,134 @@
+package tournaments
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/helfy18/movie-site-api/modules/movies"
+)
+
+func TestBracketOrder(t *testing.T) {
+	tests := []struct {
+		size int
+		want []int
+	}{
+		{1, []int{1}},
+		{2, []int{1, 2}},
+		{4, []int{1, 4, 2, 3}},
+		{8, []int{1, 8, 4, 5, 2, 7, 3, 6}},
+		{16, []int{1, 16, 8, 9, 4, 13, 5, 12, 2, 15, 7, 10, 3, 14, 6, 11}},
+	}
+	for _, tt := range tests {
+		got := bracketOrder(tt.size)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("bracketOrder(%d) = %v, want %v", tt.size, got, tt.want)
+		}
+	}
+
+	// Whatever the size, every seed appears once and opponents' seeds add up to size+1
+	for size := 2; size <= 64; size *= 2 {
+		order := bracketOrder(size)
+		seen := make(map[int]bool)
+		for i, seed := range order {
+			if seed < 1 || seed > size || seen[seed] {
+				t.Fatalf("bracketOrder(%d) = %v repeats or skips seeds", size, order)
+			}
+			seen[seed] = true
+			if i%2 == 1 && order[i-1]+seed != size+1 {
+				t.Errorf("bracketOrder(%d) pairs seeds %d and %d", size, order[i-1], seed)
+			}
+		}
+	}
+}
+
+func int32Ptr(n int32) *int32 { return &n }
+
+/*
+A four movie bracket: 4 upsets 1 and 2 beats 3 in the first round, and 2
+wins the final on the tie. Without final the last matchup is still
+being voted on.
+*/
+func fourMovieBracket(final bool) tournament {
+	one, two, three, four := entrant{10, 1}, entrant{20, 2}, entrant{30, 3}, entrant{40, 4}
+	t := tournament{
+		Size:   4,
+		Status: voting,
+		Round:  2,
+		Rounds: 2,
+		Matchups: []matchup{
+			{Round: 1, Slot: 0, A: one, B: four, VotesA: 3, VotesB: 5, Winner: int32Ptr(40)},
+			{Round: 1, Slot: 1, A: two, B: three, VotesA: 6, VotesB: 2, Winner: int32Ptr(20)},
+			{Round: 2, Slot: 0, A: four, B: two},
+		},
+	}
+	if final {
+		t.Status = finished
+		t.Matchups[2].VotesA, t.Matchups[2].VotesB = 4, 4
+		t.Matchups[2].Winner = int32Ptr(20)
+		t.Champion = int32Ptr(20)
+	}
+	return t
+}
+
+func TestRankResults(t *testing.T) {
+	cards := map[int32]movies.MovieCard{
+		10: {TMDBId: 10, Movie: "One"},
+		20: {TMDBId: 20, Movie: "Two"},
+		30: {TMDBId: 30, Movie: "Three"},
+		40: {TMDBId: 40, Movie: "Four"},
+	}
+	tests := []struct {
+		name string
+		t    tournament
+		want []placement
+	}{
+		{
+			name: "finished",
+			t:    fourMovieBracket(true),
+			want: []placement{
+				{Place: 1, Seed: 2, Movie: cards[20], Wins: 2, VotesFor: 10, VotesAgainst: 6},
+				{Place: 2, Seed: 4, Movie: cards[40], EliminatedIn: 2, Wins: 1, VotesFor: 9, VotesAgainst: 7, Upsets: 1},
+				{Place: 3, Seed: 1, Movie: cards[10], EliminatedIn: 1, VotesFor: 3, VotesAgainst: 5},
+				{Place: 3, Seed: 3, Movie: cards[30], EliminatedIn: 1, VotesFor: 2, VotesAgainst: 6},
+			},
+		},
+		{
+			name: "movies still in come first",
+			t:    fourMovieBracket(false),
+			want: []placement{
+				{Seed: 2, Movie: cards[20], Wins: 1, VotesFor: 6, VotesAgainst: 2},
+				{Seed: 4, Movie: cards[40], Wins: 1, VotesFor: 5, VotesAgainst: 3, Upsets: 1},
+				{Place: 3, Seed: 1, Movie: cards[10], EliminatedIn: 1, VotesFor: 3, VotesAgainst: 5},
+				{Place: 3, Seed: 3, Movie: cards[30], EliminatedIn: 1, VotesFor: 2, VotesAgainst: 6},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rankResults(tt.t, cards)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRankResultsPlacesByRound(t *testing.T) {
+	// Eight movies with only the first round played: the four losers share fifth
+	order := bracketOrder(8)
+	tr := tournament{Size: 8, Round: 2, Rounds: 3}
+	for slot := 0; slot < 4; slot++ {
+		a := entrant{int32(order[2*slot]), order[2*slot]}
+		b := entrant{int32(order[2*slot+1]), order[2*slot+1]}
+		tr.Matchups = append(tr.Matchups, matchup{Round: 1, Slot: slot, A: a, B: b, VotesA: 1, Winner: int32Ptr(a.TMDBId)})
+	}
+	for _, p := range rankResults(tr, nil) {
+		want := 0
+		if p.Seed > 4 {
+			want = 5
+		}
+		if p.Place != want {
+			t.Errorf("seed %d placed %d, want %d", p.Seed, p.Place, want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package tournaments
+
+import (
+	"time"
+
+	"github.com/helfy18/movie-site-api/modules/movies"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Tournament statuses
+const (
+	voting   = "voting"
+	finished = "finished"
+)
+
+// A movie in a bracket and the seed it got from its Ranking
+type entrant struct {
+	TMDBId int32 `bson:"tmdbid" json:"tmdbid"`
+	Seed   int   `bson:"seed" json:"seed"`
+}
+
+/*
+	 One head-to-head in a round. Votes are filled in when the round closes;
+		until then they are tallied from the votes collection.
+*/
+type matchup struct {
+	Round  int     `bson:"round"`
+	Slot   int     `bson:"slot"`
+	A      entrant `bson:"a"`
+	B      entrant `bson:"b"`
+	VotesA int     `bson:"votesA"`
+	VotesB int     `bson:"votesB"`
+	Winner *int32  `bson:"winner,omitempty"`
+}
+
+/*
+	 A seeded elimination bracket. Filters is the query string the movies
+		were chosen with. Round is the round being voted on, and RoundEnds,
+		when set, closes it automatically.
+*/
+type tournament struct {
+	ID         primitive.ObjectID `bson:"_id" json:"id"`
+	Title      string             `bson:"title" json:"title"`
+	Size       int                `bson:"size" json:"size"`
+	Filters    string             `bson:"filters" json:"filters"`
+	CreatedBy  primitive.ObjectID `bson:"createdBy" json:"-"`
+	Creator    string             `bson:"creator" json:"creator"`
+	Status     string             `bson:"status" json:"status"`
+	Round      int                `bson:"round" json:"round"`
+	Rounds     int                `bson:"rounds" json:"rounds"`
+	RoundHours int                `bson:"roundHours,omitempty" json:"roundHours,omitempty"`
+	RoundEnds  *time.Time         `bson:"roundEnds,omitempty" json:"roundEnds,omitempty"`
+	Matchups   []matchup          `bson:"matchups" json:"-"`
+	Champion   *int32             `bson:"champion,omitempty" json:"champion,omitempty"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt  time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// A user's pick in one matchup, changeable until the round closes
+type vote struct {
+	TournamentID primitive.ObjectID `bson:"tournamentId"`
+	Round        int                `bson:"round"`
+	Slot         int                `bson:"slot"`
+	UserID       primitive.ObjectID `bson:"userId"`
+	Pick         int32              `bson:"pick"`
+	UpdatedAt    time.Time          `bson:"updatedAt"`
+}
+
+// An entrant as returned, with its movie and votes in the matchup
+type entrantView struct {
+	Seed  int              `json:"seed"`
+	Votes int              `json:"votes"`
+	Movie movies.MovieCard `json:"movie"`
+}
+
+// A matchup as returned. MyVote is the requesting user's pick
+type matchupView struct {
+	Round  int         `json:"round"`
+	Slot   int         `json:"slot"`
+	A      entrantView `json:"a"`
+	B      entrantView `json:"b"`
+	Winner *int32      `json:"winner,omitempty"`
+	MyVote *int32      `json:"myVote,omitempty"`
+}
+
+// How far a movie got, for the results
+type placement struct {
+	// Shared by movies out in the same round; 0 while still in
+	Place int              `json:"place,omitempty"`
+	Seed  int              `json:"seed"`
+	Movie movies.MovieCard `json:"movie"`
+	// The round the movie went out in, or 0 while still in or champion
+	EliminatedIn int `json:"eliminatedIn,omitempty"`
+	Wins         int `json:"wins"`
+	VotesFor     int `json:"votesFor"`
+	VotesAgainst int `json:"votesAgainst"`
+	// Wins over better seeds
+	Upsets int `json:"upsets"`
+}
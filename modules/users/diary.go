@@ -0,0 +1,307 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/auth"
+	"github.com/helfy18/movie-site-api/modules/movies"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const maxNoteLength = 2000
+
+// Body of diary writes
+type diaryBody struct {
+	TMDBId    int32  `json:"tmdbid"`
+	WatchedAt string `json:"watchedAt"`
+	Rewatch   *bool  `json:"rewatch"`
+	Score     *int32 `json:"score"`
+	Note      string `json:"note"`
+}
+
+// Parses a date (2006-01-02) or RFC 3339 time
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+/*
+Reads a diary body, rejecting the request when a field is invalid. The
+time is zero when watchedAt is left out.
+*/
+func readDiaryBody(c *gin.Context) (diaryBody, time.Time, bool) {
+	var body diaryBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		problem.BadRequest(c, "body", "Body must be a JSON diary entry")
+		return body, time.Time{}, false
+	}
+
+	var errs []problem.FieldError
+	var watchedAt time.Time
+	if body.WatchedAt != "" {
+		t, err := parseDate(body.WatchedAt)
+		if err != nil {
+			errs = append(errs, problem.FieldError{Field: "watchedAt", Detail: "watchedAt must be a date (yyyy-mm-dd) or RFC 3339 time"})
+		} else if t.After(time.Now()) {
+			errs = append(errs, problem.FieldError{Field: "watchedAt", Detail: "watchedAt can't be in the future"})
+		}
+		watchedAt = t
+	}
+	if body.Score != nil && (*body.Score < 0 || *body.Score > 100) {
+		errs = append(errs, problem.FieldError{Field: "score", Detail: "score must be an integer from 0 to 100"})
+	}
+	if len(body.Note) > maxNoteLength {
+		errs = append(errs, problem.FieldError{Field: "note", Detail: "note must be at most 2000 characters"})
+	}
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return body, watchedAt, false
+	}
+	return body, watchedAt, true
+}
+
+// Reads the id route parameter, rejecting the request when it is invalid
+func entryIdParam(c *gin.Context) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		problem.BadRequest(c, "id", "id must be a diary entry id")
+		return id, false
+	}
+	return id, true
+}
+
+// Whether the user logged the movie before the time
+func watchedBefore(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, tmdbid int32, before time.Time) (bool, error) {
+	count, err := db.Collection("diary").CountDocuments(ctx, bson.M{"userId": userID, "tmdbid": tmdbid, "watchedAt": bson.M{"$lt": before}})
+	return count > 0, err
+}
+
+/*
+The watchedAt bounds for from and to, each a date or RFC 3339 time. Both
+are inclusive, so a bare to date covers the whole day.
+*/
+func diaryRange(from string, to string) (bson.M, []problem.FieldError) {
+	var errs []problem.FieldError
+	watched := bson.M{}
+	if from != "" {
+		t, err := parseDate(from)
+		if err != nil {
+			errs = append(errs, problem.FieldError{Field: "from", Detail: "from must be a date (yyyy-mm-dd) or RFC 3339 time"})
+		}
+		watched["$gte"] = t
+	}
+	if to != "" {
+		t, err := parseDate(to)
+		if err != nil {
+			errs = append(errs, problem.FieldError{Field: "to", Detail: "to must be a date (yyyy-mm-dd) or RFC 3339 time"})
+		}
+		if len(to) == len(time.DateOnly) {
+			t = t.AddDate(0, 0, 1)
+		}
+		watched["$lt"] = t
+	}
+	return watched, errs
+}
+
+/*
+Accepts the ListMovies filters and from and to (dates, inclusive).
+Returns the logged-in user's diary, most recent viewing first, with each
+movie.
+*/
+func GetDiary(c *gin.Context) {
+	f, errs := movies.ParseFilter(c)
+	watched, rangeErrs := diaryRange(c.Query("from"), c.Query("to"))
+	if errs = append(errs, rangeErrs...); len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	ctx := c.Request.Context()
+
+	query := bson.M{"userId": auth.MustUser(c).ID}
+	if len(watched) > 0 {
+		query["watchedAt"] = watched
+	}
+	cursor, err := db.Collection("diary").Find(ctx, query, options.Find().SetSort(bson.D{{Key: "watchedAt", Value: -1}, {Key: "_id", Value: -1}}))
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch diary")
+		return
+	}
+	entries := []diaryEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		problem.Error(c, err, "Failed to fetch diary")
+		return
+	}
+
+	ids := make([]int32, len(entries))
+	for i, e := range entries {
+		ids[i] = e.TMDBId
+	}
+	byId, err := filteredMoviesById(ctx, db, ids, f)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+
+	items := []diaryItem{}
+	for _, e := range entries {
+		if m, found := byId[e.TMDBId]; found {
+			items = append(items, diaryItem{diaryEntry: e, Movie: movies.CardOf(m)})
+		}
+	}
+	c.IndentedJSON(http.StatusOK, items)
+}
+
+/*
+Accepts tmdbid, watchedAt, rewatch, score (0 to 100) and note (JSON).
+Logs a viewing for the logged-in user and takes the movie off their
+watchlist. WatchedAt defaults to now and rewatch to whether the movie was
+logged before.
+*/
+func AddDiaryEntry(c *gin.Context) {
+	body, watchedAt, ok := readDiaryBody(c)
+	if !ok {
+		return
+	}
+	if watchedAt.IsZero() {
+		watchedAt = time.Now()
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	ctx := c.Request.Context()
+	if !requireMovie(c, db, body.TMDBId) {
+		return
+	}
+	userID := auth.MustUser(c).ID
+
+	entry := diaryEntry{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		TMDBId:    body.TMDBId,
+		WatchedAt: watchedAt,
+		Score:     body.Score,
+		Note:      body.Note,
+		CreatedAt: time.Now(),
+	}
+	if body.Rewatch != nil {
+		entry.Rewatch = *body.Rewatch
+	} else {
+		rewatch, err := watchedBefore(ctx, db, userID, body.TMDBId, watchedAt)
+		if err != nil {
+			problem.Error(c, err, "Failed to fetch diary")
+			return
+		}
+		entry.Rewatch = rewatch
+	}
+
+	if _, err := db.Collection("diary").InsertOne(ctx, entry); err != nil {
+		problem.Error(c, err, "Failed to save diary entry")
+		return
+	}
+	if _, err := removeFromWatchlist(ctx, db, userID, body.TMDBId); err != nil {
+		problem.Error(c, err, "Failed to update watchlist")
+		return
+	}
+
+	byId, err := moviesById(ctx, db, []int32{entry.TMDBId})
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movie")
+		return
+	}
+	c.IndentedJSON(http.StatusCreated, diaryItem{diaryEntry: entry, Movie: movies.CardOf(byId[entry.TMDBId])})
+}
+
+/*
+Accepts id (path) and watchedAt, rewatch, score and note (JSON).
+Replaces the details of one of the logged-in user's diary entries. The
+movie can't be changed, and watchedAt and rewatch are kept when left out.
+*/
+func UpdateDiaryEntry(c *gin.Context) {
+	id, ok := entryIdParam(c)
+	if !ok {
+		return
+	}
+	body, watchedAt, ok := readDiaryBody(c)
+	if !ok {
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	ctx := c.Request.Context()
+
+	set := bson.M{"note": body.Note}
+	unset := bson.M{}
+	if !watchedAt.IsZero() {
+		set["watchedAt"] = watchedAt
+	}
+	if body.Rewatch != nil {
+		set["rewatch"] = *body.Rewatch
+	}
+	if body.Score != nil {
+		set["score"] = *body.Score
+	} else {
+		unset["score"] = ""
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	var entry diaryEntry
+	err := db.Collection("diary").FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "userId": auth.MustUser(c).ID},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&entry)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		problem.NotFound(c, "No diary entry has this id")
+		return
+	}
+	if err != nil {
+		problem.Error(c, err, "Failed to save diary entry")
+		return
+	}
+
+	byId, err := moviesById(ctx, db, []int32{entry.TMDBId})
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movie")
+		return
+	}
+	c.IndentedJSON(http.StatusOK, diaryItem{diaryEntry: entry, Movie: movies.CardOf(byId[entry.TMDBId])})
+}
+
+// Deletes one of the logged-in user's diary entries
+func DeleteDiaryEntry(c *gin.Context) {
+	id, ok := entryIdParam(c)
+	if !ok {
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	diary := client.Database("jdmovies").Collection("diary")
+
+	result, err := diary.DeleteOne(c.Request.Context(), bson.M{"_id": id, "userId": auth.MustUser(c).ID})
+	if err != nil {
+		problem.Error(c, err, "Failed to delete diary entry")
+		return
+	}
+	if result.DeletedCount == 0 {
+		problem.NotFound(c, "No diary entry has this id")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,93 @@
+package users
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDiaryRange(t *testing.T) {
+	june1 := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	june2 := time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)
+	evening := time.Date(2024, 6, 1, 20, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		from   string
+		to     string
+		want   bson.M
+		fields []string
+	}{
+		{"no bounds", "", "", bson.M{}, nil},
+		{"from a date", "2024-06-01", "", bson.M{"$gte": june1}, nil},
+		{"to a date covers the whole day", "", "2024-06-01", bson.M{"$lt": june2}, nil},
+		{"to a time is exact", "", "2024-06-01T20:30:00Z", bson.M{"$lt": evening}, nil},
+		{"one day", "2024-06-01", "2024-06-01", bson.M{"$gte": june1, "$lt": june2}, nil},
+		{"bad from", "June 1st", "", nil, []string{"from"}},
+		{"bad to", "", "2024-13-01", nil, []string{"to"}},
+		{"both bad", "yesterday", "today", nil, []string{"from", "to"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			watched, errs := diaryRange(tt.from, tt.to)
+			var fields []string
+			for _, e := range errs {
+				fields = append(fields, e.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Fatalf("errors on %v, want %v", fields, tt.fields)
+			}
+			if tt.fields == nil && !reflect.DeepEqual(watched, tt.want) {
+				t.Errorf("got %v, want %v", watched, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadDiaryBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tomorrow := time.Now().AddDate(0, 0, 1).Format(time.DateOnly)
+
+	tests := []struct {
+		name      string
+		body      string
+		ok        bool
+		watchedAt time.Time
+	}{
+		{"no watchedAt", `{"tmdbid": 550}`, true, time.Time{}},
+		{"date", `{"tmdbid": 550, "watchedAt": "2024-06-01"}`, true, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"time", `{"tmdbid": 550, "watchedAt": "2024-06-01T20:30:00Z"}`, true, time.Date(2024, 6, 1, 20, 30, 0, 0, time.UTC)},
+		{"score and note", `{"tmdbid": 550, "score": 100, "note": "again"}`, true, time.Time{}},
+		{"future", `{"tmdbid": 550, "watchedAt": "` + tomorrow + `"}`, false, time.Time{}},
+		{"not a date", `{"tmdbid": 550, "watchedAt": "last week"}`, false, time.Time{}},
+		{"score too high", `{"tmdbid": 550, "score": 101}`, false, time.Time{}},
+		{"negative score", `{"tmdbid": 550, "score": -1}`, false, time.Time{}},
+		{"note too long", `{"tmdbid": 550, "note": "` + strings.Repeat("a", maxNoteLength+1) + `"}`, false, time.Time{}},
+		{"not JSON", `tmdbid=550`, false, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/me/diary", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			_, watchedAt, ok := readDiaryBody(c)
+			if ok != tt.ok {
+				t.Fatalf("got ok %v, want %v (status %d)", ok, tt.ok, w.Code)
+			}
+			if !ok && w.Code != http.StatusBadRequest {
+				t.Errorf("got status %d, want 400", w.Code)
+			}
+			if ok && !watchedAt.Equal(tt.watchedAt) {
+				t.Errorf("got watchedAt %v, want %v", watchedAt, tt.watchedAt)
+			}
+		})
+	}
+}
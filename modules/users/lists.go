@@ -0,0 +1,538 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/auth"
+	"github.com/helfy18/movie-site-api/modules/movies"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Bounds on list contents
+const (
+	maxTitleLength       = 100
+	maxDescriptionLength = 2000
+	maxEntryNoteLength   = 500
+	maxListEntries       = 500
+	maxSlugLength        = 60
+)
+
+/*
+Turns a title into a slug: lowercase letters and digits separated by
+single dashes, e.g. "Best Pixar!" becomes "best-pixar".
+*/
+func slugify(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	slug := b.String()
+	if len(slug) > maxSlugLength {
+		slug = strings.TrimRight(slug[:maxSlugLength], "-")
+	}
+	if slug == "" {
+		slug = "list"
+	}
+	return slug
+}
+
+/*
+Saves a new list under a slug made from its title. A random suffix is
+added when the slug is taken.
+*/
+func insertList(ctx context.Context, db *mongo.Database, list *movieList) error {
+	base := slugify(list.Title)
+	list.Slug = base
+	for attempt := 0; ; attempt++ {
+		_, err := db.Collection("lists").InsertOne(ctx, list)
+		if !mongo.IsDuplicateKeyError(err) || attempt == 5 {
+			return err
+		}
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return err
+		}
+		list.Slug = base + "-" + hex.EncodeToString(suffix)
+	}
+}
+
+// Checks list fields shared by creation and updates
+func validateListFields(title *string, description *string) []problem.FieldError {
+	var errs []problem.FieldError
+	if title != nil {
+		*title = strings.TrimSpace(*title)
+		if *title == "" || len(*title) > maxTitleLength {
+			errs = append(errs, problem.FieldError{Field: "title", Detail: "title must be 1 to 100 characters"})
+		}
+	}
+	if description != nil && len(*description) > maxDescriptionLength {
+		errs = append(errs, problem.FieldError{Field: "description", Detail: "description must be at most 2000 characters"})
+	}
+	return errs
+}
+
+/*
+Checks list entries: at most 500, no repeats, short notes and every movie
+in the catalog.
+*/
+func validateEntries(ctx context.Context, db *mongo.Database, entries []listEntry) ([]problem.FieldError, error) {
+	var errs []problem.FieldError
+	if len(entries) > maxListEntries {
+		errs = append(errs, problem.FieldError{Field: "entries", Detail: "lists can hold at most 500 movies"})
+	}
+
+	ids := make([]int32, len(entries))
+	seen := make(map[int32]bool, len(entries))
+	for i, e := range entries {
+		field := "entries[" + strconv.Itoa(i) + "]"
+		if seen[e.TMDBId] {
+			errs = append(errs, problem.FieldError{Field: field, Detail: "movie is already on the list"})
+		}
+		if len(e.Note) > maxEntryNoteLength {
+			errs = append(errs, problem.FieldError{Field: field, Detail: "note must be at most 500 characters"})
+		}
+		seen[e.TMDBId] = true
+		ids[i] = e.TMDBId
+	}
+
+	byId, err := moviesById(ctx, db, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range entries {
+		if _, found := byId[e.TMDBId]; !found {
+			errs = append(errs, problem.FieldError{Field: "entries[" + strconv.Itoa(i) + "]", Detail: "no movie has tmdbid " + strconv.Itoa(int(e.TMDBId))})
+		}
+	}
+	return errs, nil
+}
+
+/*
+Whether the user can see the list: anyone can see a public list, only
+the owner a private one, and with owned only the owner can see any.
+user is nil for anonymous requests.
+*/
+func canView(list movieList, user *auth.User, owned bool) bool {
+	isOwner := user != nil && user.ID == list.UserID
+	return isOwner || (list.Public && !owned)
+}
+
+/*
+Finds the list with the slug in the path, answering 404 when the user
+can't see it.
+*/
+func findList(c *gin.Context, db *mongo.Database, owned bool) (movieList, bool) {
+	var list movieList
+	err := db.Collection("lists").FindOne(c.Request.Context(), bson.M{"slug": c.Param("slug")}).Decode(&list)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		problem.Error(c, err, "Failed to fetch list")
+		return list, false
+	}
+
+	if err != nil || !canView(list, auth.CurrentUser(c), owned) {
+		problem.NotFound(c, "No list has this slug")
+		return list, false
+	}
+	return list, true
+}
+
+// Joins a list's entries to their movies, leaving out movies no longer in the catalog
+func viewOf(ctx context.Context, db *mongo.Database, list movieList) (listView, error) {
+	ids := make([]int32, len(list.Entries))
+	for i, e := range list.Entries {
+		ids[i] = e.TMDBId
+	}
+	byId, err := moviesById(ctx, db, ids)
+	if err != nil {
+		return listView{}, err
+	}
+
+	view := listView{movieList: list, Entries: []listItem{}}
+	for _, e := range list.Entries {
+		if m, found := byId[e.TMDBId]; found {
+			view.Entries = append(view.Entries, listItem{listEntry: e, Movie: movies.CardOf(m)})
+		}
+	}
+	return view, nil
+}
+
+// Responds with the list joined to its movies
+func respondWithList(c *gin.Context, db *mongo.Database, status int, list movieList) {
+	view, err := viewOf(c.Request.Context(), db, list)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+	c.IndentedJSON(status, view)
+}
+
+/*
+Saves changes to a list and responds with it. The write only applies if
+the list is unchanged since it was read, so concurrent edits can't undo
+each other.
+*/
+func updateList(c *gin.Context, db *mongo.Database, list movieList, set bson.M) {
+	set["updatedAt"] = time.Now()
+
+	var updated movieList
+	err := db.Collection("lists").FindOneAndUpdate(c.Request.Context(),
+		bson.M{"_id": list.ID, "updatedAt": list.UpdatedAt},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		problem.Abort(c, http.StatusConflict, "List was changed by another request, try again")
+		return
+	}
+	if err != nil {
+		problem.Error(c, err, "Failed to save list")
+		return
+	}
+	respondWithList(c, db, http.StatusOK, updated)
+}
+
+// Returns the logged-in user's lists, most recently updated first
+func GetMyLists(c *gin.Context) {
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	lists := client.Database("jdmovies").Collection("lists")
+	ctx := c.Request.Context()
+
+	cursor, err := lists.Find(ctx, bson.M{"userId": auth.MustUser(c).ID}, options.Find().SetSort(bson.M{"updatedAt": -1}))
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch lists")
+		return
+	}
+	found := []movieList{}
+	if err := cursor.All(ctx, &found); err != nil {
+		problem.Error(c, err, "Failed to fetch lists")
+		return
+	}
+	c.IndentedJSON(http.StatusOK, found)
+}
+
+/*
+Accepts title, description, public and entries (JSON, tmdbid and note
+each).
+Creates a list for the logged-in user. The slug is made from the title.
+*/
+func CreateList(c *gin.Context) {
+	var body struct {
+		Title       string      `json:"title"`
+		Description string      `json:"description"`
+		Public      bool        `json:"public"`
+		Entries     []listEntry `json:"entries"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		problem.BadRequest(c, "body", "Body must be a JSON list")
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	ctx := c.Request.Context()
+
+	errs := validateListFields(&body.Title, &body.Description)
+	entryErrs, err := validateEntries(ctx, db, body.Entries)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+	if errs = append(errs, entryErrs...); len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+
+	user := auth.MustUser(c)
+	now := time.Now()
+	list := movieList{
+		ID:          primitive.NewObjectID(),
+		UserID:      user.ID,
+		Owner:       user.Username,
+		Title:       body.Title,
+		Description: body.Description,
+		Public:      body.Public,
+		Entries:     append([]listEntry{}, body.Entries...),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := insertList(ctx, db, &list); err != nil {
+		problem.Error(c, err, "Failed to save list")
+		return
+	}
+	respondWithList(c, db, http.StatusCreated, list)
+}
+
+/*
+Accepts slug (path).
+Returns the list with a card for each movie. Private lists are only
+visible to their owner.
+*/
+func GetList(c *gin.Context) {
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+
+	list, ok := findList(c, db, false)
+	if !ok {
+		return
+	}
+	respondWithList(c, db, http.StatusOK, list)
+}
+
+/*
+Accepts slug (path) and any of title, description and public (JSON).
+Updates one of the logged-in user's lists. The slug doesn't change so
+shared links keep working.
+*/
+func UpdateList(c *gin.Context) {
+	var body struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		Public      *bool   `json:"public"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		problem.BadRequest(c, "body", "Body must be JSON with title, description or public")
+		return
+	}
+	if errs := validateListFields(body.Title, body.Description); len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	list, ok := findList(c, db, true)
+	if !ok {
+		return
+	}
+
+	set := bson.M{}
+	if body.Title != nil {
+		set["title"] = *body.Title
+	}
+	if body.Description != nil {
+		set["description"] = *body.Description
+	}
+	if body.Public != nil {
+		set["public"] = *body.Public
+	}
+	updateList(c, db, list, set)
+}
+
+// Deletes one of the logged-in user's lists
+func DeleteList(c *gin.Context) {
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	list, ok := findList(c, db, true)
+	if !ok {
+		return
+	}
+
+	if _, err := db.Collection("lists").DeleteOne(c.Request.Context(), bson.M{"_id": list.ID}); err != nil {
+		problem.Error(c, err, "Failed to delete list")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+/*
+Accepts slug and tmdbid (path) and note (JSON, optional).
+Adds the movie to the end of one of the logged-in user's lists, or
+updates its note when it is already there.
+*/
+func PutListEntry(c *gin.Context) {
+	tmdbid, ok := tmdbidParam(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Note string `json:"note"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			problem.BadRequest(c, "body", "Body must be JSON with a note")
+			return
+		}
+	}
+	if len(body.Note) > maxEntryNoteLength {
+		problem.BadRequest(c, "note", "note must be at most 500 characters")
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	list, ok := findList(c, db, true)
+	if !ok || !requireMovie(c, db, tmdbid) {
+		return
+	}
+
+	entries := append([]listEntry{}, list.Entries...)
+	found := false
+	for i := range entries {
+		if entries[i].TMDBId == tmdbid {
+			entries[i].Note = body.Note
+			found = true
+		}
+	}
+	if !found {
+		if len(entries) >= maxListEntries {
+			problem.BadRequest(c, "tmdbid", "lists can hold at most 500 movies")
+			return
+		}
+		entries = append(entries, listEntry{TMDBId: tmdbid, Note: body.Note})
+	}
+	updateList(c, db, list, bson.M{"entries": entries})
+}
+
+// Removes the movie in the path from one of the logged-in user's lists
+func DeleteListEntry(c *gin.Context) {
+	tmdbid, ok := tmdbidParam(c)
+	if !ok {
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	list, ok := findList(c, db, true)
+	if !ok {
+		return
+	}
+
+	entries := []listEntry{}
+	for _, e := range list.Entries {
+		if e.TMDBId != tmdbid {
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) == len(list.Entries) {
+		problem.NotFound(c, "Movie isn't on this list")
+		return
+	}
+	updateList(c, db, list, bson.M{"entries": entries})
+}
+
+/*
+Puts the entries in the order of ids, which must name every movie on
+the list exactly once. Returns what is wrong, or "" with the entries.
+*/
+func reorderEntries(entries []listEntry, ids []int32) ([]listEntry, string) {
+	byId := make(map[int32]listEntry, len(entries))
+	for _, e := range entries {
+		byId[e.TMDBId] = e
+	}
+	ordered := make([]listEntry, 0, len(ids))
+	for _, id := range ids {
+		e, found := byId[id]
+		if !found {
+			return nil, "tmdbid " + strconv.Itoa(int(id)) + " isn't on the list or is repeated"
+		}
+		delete(byId, id)
+		ordered = append(ordered, e)
+	}
+	if len(byId) > 0 {
+		return nil, "tmdbids must include every movie on the list"
+	}
+	return ordered, ""
+}
+
+/*
+Accepts slug (path) and tmdbids (JSON), every movie on the list in the
+new order.
+Reorders one of the logged-in user's lists, keeping each entry's note.
+*/
+func ReorderList(c *gin.Context) {
+	var body struct {
+		TMDBIds []int32 `json:"tmdbids"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		problem.BadRequest(c, "tmdbids", "tmdbids must be a list of integers")
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	list, ok := findList(c, db, true)
+	if !ok {
+		return
+	}
+
+	entries, invalid := reorderEntries(list.Entries, body.TMDBIds)
+	if invalid != "" {
+		problem.BadRequest(c, "tmdbids", invalid)
+		return
+	}
+	updateList(c, db, list, bson.M{"entries": entries})
+}
+
+/*
+Accepts slug (path) and title (JSON, optional).
+Copies a list the logged-in user can see into a new private list of
+theirs, notes included.
+*/
+func CloneList(c *gin.Context) {
+	var body struct {
+		Title *string `json:"title"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			problem.BadRequest(c, "body", "Body must be JSON with a title")
+			return
+		}
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	original, ok := findList(c, db, false)
+	if !ok {
+		return
+	}
+
+	title := original.Title
+	if body.Title != nil {
+		title = *body.Title
+		if errs := validateListFields(&title, nil); len(errs) > 0 {
+			problem.Invalid(c, errs...)
+			return
+		}
+	}
+
+	user := auth.MustUser(c)
+	now := time.Now()
+	list := movieList{
+		ID:          primitive.NewObjectID(),
+		UserID:      user.ID,
+		Owner:       user.Username,
+		Title:       title,
+		Description: original.Description,
+		Entries:     append([]listEntry{}, original.Entries...),
+		ClonedFrom:  original.Slug,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := insertList(c.Request.Context(), db, &list); err != nil {
+		problem.Error(c, err, "Failed to save list")
+		return
+	}
+	respondWithList(c, db, http.StatusCreated, list)
+}
@@ -0,0 +1,122 @@
+package users
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/auth"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Best of 2023", "best-of-2023"},
+		{"  Horror   Nights  ", "horror-nights"},
+		{"Rock 'n' Roll!!", "rock-n-roll"},
+		{"Marvel: Phase 1 / Phase 2", "marvel-phase-1-phase-2"},
+		{"already-a-slug", "already-a-slug"},
+		{"---", "list"},
+		{"", "list"},
+		{"千と千尋", "list"},
+		{strings.Repeat("a", 70), strings.Repeat("a", maxSlugLength)},
+		// Cut at the limit without leaving a dash at the end
+		{strings.Repeat("a", 59) + " bc", strings.Repeat("a", 59)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			got := slugify(tt.title)
+			if got != tt.want {
+				t.Errorf("slugify(%q) = %q, want %q", tt.title, got, tt.want)
+			}
+			if len(got) > maxSlugLength {
+				t.Errorf("slugify(%q) is %d characters, over %d", tt.title, len(got), maxSlugLength)
+			}
+		})
+	}
+}
+
+func TestCanView(t *testing.T) {
+	owner := &auth.User{ID: primitive.NewObjectID(), Username: "owner"}
+	other := &auth.User{ID: primitive.NewObjectID(), Username: "other"}
+	public := movieList{UserID: owner.ID, Public: true}
+	private := movieList{UserID: owner.ID}
+
+	tests := []struct {
+		name  string
+		list  movieList
+		user  *auth.User
+		owned bool
+		want  bool
+	}{
+		// GetList and CloneList
+		{"public list, anonymous", public, nil, false, true},
+		{"public list, other user", public, other, false, true},
+		{"public list, owner", public, owner, false, true},
+		{"private list, anonymous", private, nil, false, false},
+		{"private list, other user", private, other, false, false},
+		{"private list, owner", private, owner, false, true},
+		// Routes that change the list
+		{"owned public list, other user", public, other, true, false},
+		{"owned public list, anonymous", public, nil, true, false},
+		{"owned private list, owner", private, owner, true, true},
+		{"owned public list, owner", public, owner, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canView(tt.list, tt.user, tt.owned); got != tt.want {
+				t.Errorf("canView = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReorderEntries(t *testing.T) {
+	entries := []listEntry{{TMDBId: 1, Note: "first"}, {TMDBId: 2}, {TMDBId: 3, Note: "third"}}
+
+	tests := []struct {
+		name    string
+		ids     []int32
+		want    []listEntry
+		invalid string
+	}{
+		{"new order keeps notes", []int32{3, 1, 2}, []listEntry{{TMDBId: 3, Note: "third"}, {TMDBId: 1, Note: "first"}, {TMDBId: 2}}, ""},
+		{"same order", []int32{1, 2, 3}, entries, ""},
+		{"unknown movie", []int32{3, 1, 4}, nil, "tmdbid 4 isn't on the list or is repeated"},
+		{"repeated movie", []int32{1, 1, 2, 3}, nil, "tmdbid 1 isn't on the list or is repeated"},
+		{"missing movie", []int32{2, 1}, nil, "tmdbids must include every movie on the list"},
+		{"empty", []int32{}, nil, "tmdbids must include every movie on the list"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, invalid := reorderEntries(entries, tt.ids)
+			if invalid != tt.invalid || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, %q, want %v, %q", got, invalid, tt.want, tt.invalid)
+			}
+		})
+	}
+
+	if got, invalid := reorderEntries(nil, nil); invalid != "" || len(got) != 0 {
+		t.Errorf("empty list: got %v, %q", got, invalid)
+	}
+}
+
+func TestReorderListBody(t *testing.T) {
+	for _, body := range []string{"", "{", `{"tmdbids": "1,2"}`, `{"tmdbids": [1.5]}`} {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPut, "/me/lists/horror/order", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		ReorderList(c)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "tmdbids must be a list of integers") {
+			t.Errorf("body %q: got %d %s", body, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package users
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/auth"
+	"github.com/helfy18/movie-site-api/modules/movies"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Every rating a user has given
+func userRatings(ctx context.Context, db *mongo.Database, userID primitive.ObjectID) ([]rating, error) {
+	cursor, err := db.Collection("ratings").Find(ctx, bson.M{"userId": userID}, options.Find().SetSort(bson.M{"updatedAt": -1}))
+	if err != nil {
+		return nil, err
+	}
+	ratings := []rating{}
+	if err := cursor.All(ctx, &ratings); err != nil {
+		return nil, err
+	}
+	return ratings, nil
+}
+
+// Catalog movies by tmdbid
+func moviesById(ctx context.Context, db *mongo.Database, ids []int32) (map[int32]movies.Movie, error) {
+	return filteredMoviesById(ctx, db, ids, movies.Filter{})
+}
+
+// Catalog movies by tmdbid, keeping only those matching the filter
+func filteredMoviesById(ctx context.Context, db *mongo.Database, ids []int32, f movies.Filter) (map[int32]movies.Movie, error) {
+	query := bson.M{"$and": []bson.M{f.Query(), {"TMDBId": bson.M{"$in": append([]int32{}, ids...)}}}}
+	found, err := movies.FindMovies(ctx, db.Collection("movies"), query)
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[int32]movies.Movie, len(found))
+	for _, m := range found {
+		byId[m.TMDBId] = m
+	}
+	return byId, nil
+}
+
+/*
+Accepts tmdbid (path) and score (JSON, 0 to 100).
+Saves the logged-in user's score for the movie.
+*/
+func RateMovie(c *gin.Context) {
+	tmdbid, ok := tmdbidParam(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Score *int32 `json:"score"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Score == nil || *body.Score < 0 || *body.Score > 100 {
+		problem.BadRequest(c, "score", "score must be an integer from 0 to 100")
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	if !requireMovie(c, db, tmdbid) {
+		return
+	}
+
+	r := rating{UserID: auth.MustUser(c).ID, TMDBId: tmdbid, Score: *body.Score, UpdatedAt: time.Now()}
+	_, err := db.Collection("ratings").ReplaceOne(
+		c.Request.Context(),
+		bson.M{"userId": r.UserID, "tmdbid": tmdbid},
+		r,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		problem.Error(c, err, "Failed to save rating")
+		return
+	}
+	c.IndentedJSON(http.StatusOK, r)
+}
+
+// Removes the logged-in user's score for the movie in the path
+func DeleteRating(c *gin.Context) {
+	tmdbid, ok := tmdbidParam(c)
+	if !ok {
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	ratings := client.Database("jdmovies").Collection("ratings")
+
+	result, err := ratings.DeleteOne(c.Request.Context(), bson.M{"userId": auth.MustUser(c).ID, "tmdbid": tmdbid})
+	if err != nil {
+		problem.Error(c, err, "Failed to delete rating")
+		return
+	}
+	if result.DeletedCount == 0 {
+		problem.NotFound(c, "You haven't rated this movie")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Returns the logged-in user's ratings, newest first, with their movies
+func ListRatings(c *gin.Context) {
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	ctx := c.Request.Context()
+
+	ratings, err := userRatings(ctx, db, auth.MustUser(c).ID)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch ratings")
+		return
+	}
+
+	ids := make([]int32, len(ratings))
+	for i, r := range ratings {
+		ids[i] = r.TMDBId
+	}
+	byId, err := moviesById(ctx, db, ids)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+
+	rated := []ratedMovie{}
+	for _, r := range ratings {
+		if m, found := byId[r.TMDBId]; found {
+			rated = append(rated, ratedMovie{rating: r, Movie: movies.CardOf(m)})
+		}
+	}
+	c.IndentedJSON(http.StatusOK, rated)
+}
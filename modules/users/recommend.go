@@ -0,0 +1,282 @@
+package users
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/auth"
+	"github.com/helfy18/movie-site-api/modules/movies"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"github.com/helfy18/movie-site-api/modules/stats"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// Weight of the JH_Score prior, counted in neighbors of full similarity
+	priorWeight = 2.0
+	// Movies two users must both have rated before their similarity counts fully
+	fullOverlap = 10
+	// Points above the user's average that make a genre a favorite
+	favoriteGenreMargin = 5.0
+	maxRecommendations  = 100
+)
+
+// Scores of one user, by tmdbid
+type profile map[int32]float64
+
+func (p profile) mean() float64 {
+	sum := 0.0
+	for _, score := range p {
+		sum += score
+	}
+	return sum / float64(len(p))
+}
+
+/*
+Pearson correlation over the movies both users rated, damped when they
+share few movies. Zero when there is nothing to compare.
+*/
+func similarity(a profile, b profile) float64 {
+	var xs, ys []float64
+	for id, score := range a {
+		if other, found := b[id]; found {
+			xs = append(xs, score)
+			ys = append(ys, other)
+		}
+	}
+	r, ok := stats.Pearson(xs, ys)
+	if !ok {
+		return 0
+	}
+	return r * math.Min(float64(len(xs)), fullOverlap) / fullOverlap
+}
+
+// Genres the user scores well above their own average
+func favoriteGenres(mine profile, rated map[int32]movies.Movie) map[string]bool {
+	byGenre := make(map[string][]float64)
+	for id, score := range mine {
+		m, found := rated[id]
+		if !found {
+			continue
+		}
+		for _, genre := range []string{m.Genre, m.Genre_2} {
+			if genre != "" {
+				byGenre[genre] = append(byGenre[genre], score)
+			}
+		}
+	}
+
+	favorites := make(map[string]bool)
+	mean := mine.mean()
+	for genre, scores := range byGenre {
+		if len(scores) >= 2 && stats.Mean(scores) >= mean+favoriteGenreMargin {
+			favorites[genre] = true
+		}
+	}
+	return favorites
+}
+
+// Another user whose taste agrees with the user's
+type neighbor struct {
+	similarity float64
+	mean       float64
+	scores     profile
+}
+
+// Users with a positive similarity to mine, most similar first
+func neighborsOf(mine profile, profiles map[primitive.ObjectID]profile) []neighbor {
+	neighbors := []neighbor{}
+	if len(mine) == 0 {
+		return neighbors
+	}
+	for _, theirs := range profiles {
+		if s := similarity(mine, theirs); s > 0 {
+			neighbors = append(neighbors, neighbor{similarity: s, mean: theirs.mean(), scores: theirs})
+		}
+	}
+	sort.Slice(neighbors, func(i, j int) bool {
+		return neighbors[i].similarity > neighbors[j].similarity
+	})
+	return neighbors
+}
+
+/*
+Predicts the user's score for a movie they haven't rated. The prior is
+JH_Score shifted by bias; neighbors who rated the movie pull the
+prediction towards their scores, relative to their own averages, with
+the prior counting as priorWeight neighbors of full similarity.
+*/
+func recommendationFor(m movies.Movie, mine profile, bias float64, favorites map[string]bool, neighbors []neighbor) recommendation {
+	prior := math.Max(0, math.Min(100, float64(m.JH_Score)+bias))
+	rec := recommendation{Movie: movies.CardOf(m), Prior: stats.Round(prior), Reasons: []string{}}
+
+	var weighted, total float64
+	var neighborScores []float64
+	for _, n := range neighbors {
+		if score, found := n.scores[m.TMDBId]; found {
+			weighted += n.similarity * (score - n.mean)
+			total += n.similarity
+			neighborScores = append(neighborScores, score)
+		}
+	}
+
+	predicted := prior
+	if total > 0 {
+		collaborative := math.Max(0, math.Min(100, mine.mean()+weighted/total))
+		predicted = (priorWeight*prior + total*collaborative) / (priorWeight + total)
+		collaborative = stats.Round(collaborative)
+		rec.Collaborative = &collaborative
+		rec.Neighbors = len(neighborScores)
+		rec.Reasons = append(rec.Reasons, fmt.Sprintf("rated %.0f on average by %d people with similar taste", stats.Mean(neighborScores), len(neighborScores)))
+	}
+	rec.Predicted = stats.Round(predicted)
+
+	rec.Reasons = append(rec.Reasons, fmt.Sprintf("JH_Score %d", m.JH_Score))
+	if len(mine) > 0 && math.Abs(bias) >= 1 {
+		rec.Reasons = append(rec.Reasons, fmt.Sprintf("you usually score %+.0f compared to JH", bias))
+	}
+	for _, genre := range []string{m.Genre, m.Genre_2} {
+		if favorites[genre] {
+			rec.Reasons = append(rec.Reasons, "you rate "+genre+" highly")
+		}
+	}
+	return rec
+}
+
+// The user's scores
+func ratingProfile(ctx context.Context, db *mongo.Database, user primitive.ObjectID) (profile, error) {
+	ratings, err := userRatings(ctx, db, user)
+	if err != nil {
+		return nil, err
+	}
+	mine := profile{}
+	for _, r := range ratings {
+		mine[r.TMDBId] = float64(r.Score)
+	}
+	return mine, nil
+}
+
+/*
+Scores of every other user who rated at least one of the movies in mine,
+by user. Nobody else can be similar, so no one else's ratings are loaded.
+*/
+func neighborProfiles(ctx context.Context, db *mongo.Database, me primitive.ObjectID, mine profile) (map[primitive.ObjectID]profile, error) {
+	profiles := make(map[primitive.ObjectID]profile)
+	if len(mine) == 0 {
+		return profiles, nil
+	}
+	ids := make([]int32, 0, len(mine))
+	for id := range mine {
+		ids = append(ids, id)
+	}
+
+	collection := db.Collection("ratings")
+	users, err := collection.Distinct(ctx, "userId", bson.M{"tmdbid": bson.M{"$in": ids}, "userId": bson.M{"$ne": me}})
+	if err != nil || len(users) == 0 {
+		return profiles, err
+	}
+	cursor, err := collection.Find(ctx, bson.M{"userId": bson.M{"$in": users}})
+	if err != nil {
+		return nil, err
+	}
+	var ratings []rating
+	if err := cursor.All(ctx, &ratings); err != nil {
+		return nil, err
+	}
+	for _, r := range ratings {
+		if profiles[r.UserID] == nil {
+			profiles[r.UserID] = profile{}
+		}
+		profiles[r.UserID][r.TMDBId] = float64(r.Score)
+	}
+	return profiles, nil
+}
+
+/*
+Accepts the ListMovies filters and limit (default 20, at most 100). Use
+genre!= to leave genres out and provider with availability to keep only
+movies on services the user has.
+Returns catalog movies the logged-in user hasn't rated, ranked by
+predicted score. Each prediction blends what users with similar taste
+scored the movie with its JH_Score, shifted by the user's usual
+difference from JH. Users with few ratings still get sensible picks.
+*/
+func GetRecommendations(c *gin.Context) {
+	f, errs := movies.ParseFilter(c)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > maxRecommendations {
+		errs = append(errs, problem.FieldError{Field: "limit", Detail: "limit must be an integer from 1 to 100"})
+	}
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	ctx := c.Request.Context()
+	me := auth.MustUser(c).ID
+
+	mine, err := ratingProfile(ctx, db, me)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch ratings")
+		return
+	}
+	profiles, err := neighborProfiles(ctx, db, me, mine)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch ratings")
+		return
+	}
+
+	candidates, err := movies.FindMovies(ctx, db.Collection("movies"), f.Query())
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+
+	// How far the user's scores sit from JH_Score on average
+	var bias float64
+	var favorites map[string]bool
+	if len(mine) > 0 {
+		ids := make([]int32, 0, len(mine))
+		for id := range mine {
+			ids = append(ids, id)
+		}
+		rated, err := moviesById(ctx, db, ids)
+		if err != nil {
+			problem.Error(c, err, "Failed to fetch movies")
+			return
+		}
+		var differences []float64
+		for id, score := range mine {
+			if m, found := rated[id]; found {
+				differences = append(differences, score-float64(m.JH_Score))
+			}
+		}
+		bias = stats.Mean(differences)
+		favorites = favoriteGenres(mine, rated)
+	}
+
+	neighbors := neighborsOf(mine, profiles)
+	recommendations := []recommendation{}
+	for _, m := range candidates {
+		if _, seen := mine[m.TMDBId]; !seen {
+			recommendations = append(recommendations, recommendationFor(m, mine, bias, favorites, neighbors))
+		}
+	}
+
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		return recommendations[i].Predicted > recommendations[j].Predicted
+	})
+	if len(recommendations) > limit {
+		recommendations = recommendations[:limit]
+	}
+	c.IndentedJSON(http.StatusOK, recommendations)
+}
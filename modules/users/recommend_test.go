@@ -0,0 +1,202 @@
+package users
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/helfy18/movie-site-api/modules/movies"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// A profile of count movies from tmdbid 1, scored by score(i)
+func profileOf(count int, score func(i int) float64) profile {
+	p := profile{}
+	for i := 0; i < count; i++ {
+		p[int32(i+1)] = score(i)
+	}
+	return p
+}
+
+func TestSimilarity(t *testing.T) {
+	rising := func(i int) float64 { return float64(10 * i) }
+	falling := func(i int) float64 { return float64(100 - 10*i) }
+	flat := func(i int) float64 { return 70 }
+
+	tests := []struct {
+		name string
+		a, b profile
+		want float64
+	}{
+		{"same taste", profileOf(10, rising), profileOf(10, rising), 1},
+		{"opposite taste", profileOf(10, rising), profileOf(10, falling), -1},
+		{"more shared movies count no more", profileOf(10, rising), profileOf(20, rising), 1},
+		{"few shared movies are damped", profileOf(5, rising), profileOf(5, rising), 0.5},
+		{"one shared movie", profileOf(1, rising), profileOf(1, rising), 0},
+		{"nothing shared", profile{1: 50, 2: 60}, profile{3: 50, 4: 60}, 0},
+		{"no spread to compare", profileOf(10, flat), profileOf(10, rising), 0},
+		{"empty", profile{}, profileOf(10, rising), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := similarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if got, reverse := similarity(tt.a, tt.b), similarity(tt.b, tt.a); math.Abs(got-reverse) > 1e-9 {
+				t.Errorf("similarity isn't symmetric: %v and %v", got, reverse)
+			}
+		})
+	}
+}
+
+func TestFavoriteGenres(t *testing.T) {
+	rated := map[int32]movies.Movie{
+		1: {TMDBId: 1, Genre: "Horror"},
+		2: {TMDBId: 2, Genre: "Horror", Genre_2: "Comedy"},
+		3: {TMDBId: 3, Genre: "Drama"},
+		4: {TMDBId: 4, Genre: "Drama"},
+		5: {TMDBId: 5, Genre: "Comedy"},
+	}
+	tests := []struct {
+		name string
+		mine profile
+		want map[string]bool
+	}{
+		// Average 70: Horror is 90, Drama 50 and Comedy 75
+		{"well above average", profile{1: 90, 2: 90, 3: 50, 4: 50, 5: 60}, map[string]bool{"Horror": true, "Comedy": true}},
+		{"one movie isn't enough", profile{1: 100, 3: 50, 4: 50}, map[string]bool{}},
+		{"just under the margin", profile{1: 74, 2: 74, 3: 66, 4: 66}, map[string]bool{}},
+		{"movies gone from the catalog are skipped", profile{1: 90, 9: 90, 3: 50, 4: 50}, map[string]bool{}},
+		{"no ratings", profile{}, map[string]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := favoriteGenres(tt.mine, rated); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNeighborsOf(t *testing.T) {
+	rising := func(i int) float64 { return float64(10 * i) }
+	mine := profileOf(10, rising)
+	some, same, opposite := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	profiles := map[primitive.ObjectID]profile{
+		some:     profileOf(5, rising),
+		same:     profileOf(10, rising),
+		opposite: profileOf(10, func(i int) float64 { return float64(100 - 10*i) }),
+	}
+
+	neighbors := neighborsOf(mine, profiles)
+	if len(neighbors) != 2 {
+		t.Fatalf("got %d neighbors, want 2", len(neighbors))
+	}
+	if neighbors[0].similarity != 1 || neighbors[1].similarity != 0.5 {
+		t.Errorf("got similarities %v and %v, want 1 and 0.5", neighbors[0].similarity, neighbors[1].similarity)
+	}
+	if neighbors[0].mean != 45 {
+		t.Errorf("got mean %v, want 45", neighbors[0].mean)
+	}
+	if got := neighborsOf(profile{}, profiles); len(got) != 0 {
+		t.Errorf("got %d neighbors without ratings, want 0", len(got))
+	}
+}
+
+func TestRecommendationFor(t *testing.T) {
+	// Averages 70
+	mine := profile{1: 60, 2: 80}
+	// Averages 60, scores movie 10 at 80
+	fan := neighbor{similarity: 1, mean: 60, scores: profile{10: 80}}
+	// Averages 80, scores movie 10 at 60
+	critic := neighbor{similarity: 0.5, mean: 80, scores: profile{10: 60}}
+	movie := movies.Movie{TMDBId: 10, JH_Score: 70, Genre: "Horror", Genre_2: "Comedy"}
+
+	tests := []struct {
+		name          string
+		movie         movies.Movie
+		bias          float64
+		favorites     map[string]bool
+		neighbors     []neighbor
+		predicted     float64
+		prior         float64
+		collaborative *float64
+		reasons       []string
+	}{
+		{
+			name:      "prior alone",
+			movie:     movie,
+			predicted: 70,
+			prior:     70,
+			reasons:   []string{"JH_Score 70"},
+		},
+		{
+			name:      "prior shifted by bias",
+			movie:     movie,
+			bias:      -4.6,
+			predicted: 65.4,
+			prior:     65.4,
+			reasons:   []string{"JH_Score 70", "you usually score -5 compared to JH"},
+		},
+		{
+			name:      "prior is capped",
+			movie:     movies.Movie{TMDBId: 10, JH_Score: 98},
+			bias:      5,
+			predicted: 100,
+			prior:     100,
+			reasons:   []string{"JH_Score 98", "you usually score +5 compared to JH"},
+		},
+		{
+			// Collaborative 70+20 = 90, blended (2*70 + 1*90) / 3
+			name:          "one neighbor",
+			movie:         movie,
+			neighbors:     []neighbor{fan},
+			predicted:     76.67,
+			prior:         70,
+			collaborative: floatPtr(90),
+			reasons:       []string{"rated 80 on average by 1 people with similar taste", "JH_Score 70"},
+		},
+		{
+			// Collaborative 70 + (20 - 10) / 1.5 = 76.67, blended (2*70 + 1.5*76.67) / 3.5
+			name:          "neighbors weighted by similarity",
+			movie:         movie,
+			neighbors:     []neighbor{fan, critic},
+			predicted:     72.86,
+			prior:         70,
+			collaborative: floatPtr(76.67),
+			reasons:       []string{"rated 70 on average by 2 people with similar taste", "JH_Score 70"},
+		},
+		{
+			name:      "neighbors who didn't rate the movie",
+			movie:     movies.Movie{TMDBId: 11, JH_Score: 70},
+			neighbors: []neighbor{fan, critic},
+			predicted: 70,
+			prior:     70,
+			reasons:   []string{"JH_Score 70"},
+		},
+		{
+			name:      "favorite genres",
+			movie:     movie,
+			favorites: map[string]bool{"Comedy": true},
+			predicted: 70,
+			prior:     70,
+			reasons:   []string{"JH_Score 70", "you rate Comedy highly"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := recommendationFor(tt.movie, mine, tt.bias, tt.favorites, tt.neighbors)
+			if rec.Predicted != tt.predicted || rec.Prior != tt.prior {
+				t.Errorf("got predicted %v and prior %v, want %v and %v", rec.Predicted, rec.Prior, tt.predicted, tt.prior)
+			}
+			if !reflect.DeepEqual(rec.Collaborative, tt.collaborative) {
+				t.Errorf("got collaborative %v, want %v", rec.Collaborative, tt.collaborative)
+			}
+			if !reflect.DeepEqual(rec.Reasons, tt.reasons) {
+				t.Errorf("got reasons %q, want %q", rec.Reasons, tt.reasons)
+			}
+		})
+	}
+}
+
+func floatPtr(f float64) *float64 { return &f }
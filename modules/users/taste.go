@@ -0,0 +1,221 @@
+package users
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/auth"
+	"github.com/helfy18/movie-site-api/modules/movies"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"github.com/helfy18/movie-site-api/modules/stats"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// How a user's scores for one genre compare with JH_Score
+type genreDivergence struct {
+	Genre       string   `json:"genre"`
+	Count       int      `json:"count"`
+	UserAverage float64  `json:"userAverage"`
+	JHAverage   float64  `json:"jhAverage"`
+	Difference  float64  `json:"difference"`
+	Correlation *float64 `json:"correlation"`
+}
+
+// A movie the user and JH scored far apart
+type disagreement struct {
+	Movie      movies.MovieCard `json:"movie"`
+	UserScore  int32            `json:"userScore"`
+	JH_Score   int32            `json:"jh_score"`
+	Difference int32            `json:"difference"`
+}
+
+/*
+Compares the user's ratings with JH_Score over the movies in byId, which
+leaves out ratings of any other movie. Genres need minCount ratings to be
+compared and at most limit disagreements are kept.
+*/
+func compareTaste(ratings []rating, byId map[int32]movies.Movie, minCount int, limit int) bson.M {
+	var userScores, jhScores []float64
+	byGenre := make(map[string][][2]float64)
+	disagreements := []disagreement{}
+	for _, r := range ratings {
+		m, found := byId[r.TMDBId]
+		if !found {
+			continue
+		}
+		userScores = append(userScores, float64(r.Score))
+		jhScores = append(jhScores, float64(m.JH_Score))
+		for _, genre := range []string{m.Genre, m.Genre_2} {
+			if genre != "" {
+				byGenre[genre] = append(byGenre[genre], [2]float64{float64(r.Score), float64(m.JH_Score)})
+			}
+		}
+		disagreements = append(disagreements, disagreement{
+			Movie:      movies.CardOf(m),
+			UserScore:  r.Score,
+			JH_Score:   m.JH_Score,
+			Difference: r.Score - m.JH_Score,
+		})
+	}
+
+	var differences, absolute []float64
+	for i := range userScores {
+		differences = append(differences, userScores[i]-jhScores[i])
+		absolute = append(absolute, math.Abs(userScores[i]-jhScores[i]))
+	}
+
+	genres := []genreDivergence{}
+	for genre, pairs := range byGenre {
+		if len(pairs) < minCount {
+			continue
+		}
+		var us, jhs []float64
+		for _, p := range pairs {
+			us = append(us, p[0])
+			jhs = append(jhs, p[1])
+		}
+		g := genreDivergence{
+			Genre:       genre,
+			Count:       len(pairs),
+			UserAverage: stats.Round(stats.Mean(us)),
+			JHAverage:   stats.Round(stats.Mean(jhs)),
+			Difference:  stats.Round(stats.Mean(us) - stats.Mean(jhs)),
+		}
+		if r, ok := stats.Pearson(us, jhs); ok {
+			r = stats.Round(r)
+			g.Correlation = &r
+		}
+		genres = append(genres, g)
+	}
+	// Genres where the user strays furthest from JH first
+	sort.Slice(genres, func(i, j int) bool {
+		if math.Abs(genres[i].Difference) != math.Abs(genres[j].Difference) {
+			return math.Abs(genres[i].Difference) > math.Abs(genres[j].Difference)
+		}
+		return genres[i].Genre < genres[j].Genre
+	})
+
+	sort.SliceStable(disagreements, func(i, j int) bool {
+		a, b := disagreements[i].Difference, disagreements[j].Difference
+		if a < 0 {
+			a = -a
+		}
+		if b < 0 {
+			b = -b
+		}
+		return a > b
+	})
+	if len(disagreements) > limit {
+		disagreements = disagreements[:limit]
+	}
+
+	agreement := bson.M{
+		"count":                     len(userScores),
+		"averageDifference":         stats.Round(stats.Mean(differences)),
+		"averageAbsoluteDifference": stats.Round(stats.Mean(absolute)),
+	}
+	if r, ok := stats.Pearson(userScores, jhScores); ok {
+		agreement["correlation"] = stats.Round(r)
+	}
+
+	return bson.M{
+		"agreement":     agreement,
+		"userScores":    stats.Summarize(userScores, 10),
+		"jhScores":      stats.Summarize(jhScores, 10),
+		"genres":        genres,
+		"disagreements": disagreements,
+	}
+}
+
+// Whether the requester may see the user's ratings
+func canSeeRatings(user auth.User, requester auth.User) bool {
+	return user.PublicRatings || user.ID == requester.ID || requester.Admin
+}
+
+/*
+Compares the user's ratings with JH_Score over the movies matching the
+request's filters and responds with the comparison.
+*/
+func respondWithTasteMatch(c *gin.Context, db *mongo.Database, user auth.User) {
+	f, errs := movies.ParseFilter(c)
+	minCount, err := strconv.Atoi(c.DefaultQuery("min", "3"))
+	if err != nil || minCount <= 0 {
+		errs = append(errs, problem.FieldError{Field: "min", Detail: "min must be a positive integer"})
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > maxRecommendations {
+		errs = append(errs, problem.FieldError{Field: "limit", Detail: "limit must be an integer from 1 to 100"})
+	}
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+	ctx := c.Request.Context()
+
+	ratings, err := userRatings(ctx, db, user.ID)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch ratings")
+		return
+	}
+	ids := make([]int32, len(ratings))
+	for i, r := range ratings {
+		ids[i] = r.TMDBId
+	}
+	byId, err := filteredMoviesById(ctx, db, ids, f)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+
+	comparison := compareTaste(ratings, byId, minCount, limit)
+	comparison["user"] = bson.M{"id": user.ID, "username": user.Username}
+	c.IndentedJSON(http.StatusOK, comparison)
+}
+
+/*
+Accepts the ListMovies filters, min (fewest ratings for a genre to be
+compared, default 3) and limit (disagreements returned, default 10).
+Returns how the logged-in user's ratings agree with JH_Score: correlation,
+average difference, score distributions, genres where they diverge most
+and the movies they disagree on most.
+*/
+func GetMyTasteMatch(c *gin.Context) {
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	respondWithTasteMatch(c, client.Database("jdmovies"), *auth.MustUser(c))
+}
+
+/*
+Accepts id (path), a user id, and the same parameters as GetMyTasteMatch.
+Returns how that user's ratings agree with JH_Score. Only users who made
+their ratings public can be looked up by others; the rest look like they
+don't exist.
+*/
+func GetUserTasteMatch(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		problem.BadRequest(c, "id", "id must be a user id")
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+
+	var user auth.User
+	err = db.Collection("users").FindOne(c.Request.Context(), bson.M{"_id": id}).Decode(&user)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		problem.Error(c, err, "Failed to fetch user")
+		return
+	}
+	requester := auth.MustUser(c)
+	if err != nil || !canSeeRatings(user, *requester) {
+		problem.NotFound(c, "No user has this id")
+		return
+	}
+	respondWithTasteMatch(c, db, user)
+}
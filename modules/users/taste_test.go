@@ -0,0 +1,143 @@
+package users
+
+import (
+	"testing"
+
+	"github.com/helfy18/movie-site-api/modules/auth"
+	"github.com/helfy18/movie-site-api/modules/movies"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Five rated movies: three horror, two comedy
+var tasteCatalog = map[int32]movies.Movie{
+	1: {TMDBId: 1, JH_Score: 90, Genre: "Horror"},
+	2: {TMDBId: 2, JH_Score: 70, Genre: "Horror"},
+	3: {TMDBId: 3, JH_Score: 50, Genre: "Horror", Genre_2: "Comedy"},
+	4: {TMDBId: 4, JH_Score: 60, Genre: "Comedy"},
+	5: {TMDBId: 5, JH_Score: 80, Genre: "Drama"},
+}
+
+func ratingsOf(scores map[int32]int32) []rating {
+	ratings := []rating{}
+	for _, id := range []int32{1, 2, 3, 4, 5, 99} {
+		if score, found := scores[id]; found {
+			ratings = append(ratings, rating{TMDBId: id, Score: score})
+		}
+	}
+	return ratings
+}
+
+func TestCompareTasteAgreement(t *testing.T) {
+	tests := []struct {
+		name        string
+		scores      map[int32]int32
+		count       int
+		difference  float64
+		absolute    float64
+		correlation any
+	}{
+		{"always 5 above", map[int32]int32{1: 95, 2: 75, 3: 55, 4: 65, 5: 85}, 5, 5, 5, 1.0},
+		{"reversed", map[int32]int32{1: 50, 2: 70, 3: 90, 4: 80, 5: 60}, 5, 0, 24, -1.0},
+		// Movie 99 isn't in the catalog, so only one movie is compared
+		{"too few to correlate", map[int32]int32{1: 80, 99: 10}, 1, -10, 10, nil},
+		{"no ratings", map[int32]int32{}, 0, 0, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agreement := compareTaste(ratingsOf(tt.scores), tasteCatalog, 3, 10)["agreement"].(bson.M)
+			if agreement["count"] != tt.count {
+				t.Errorf("got count %v, want %d", agreement["count"], tt.count)
+			}
+			if agreement["averageDifference"] != tt.difference || agreement["averageAbsoluteDifference"] != tt.absolute {
+				t.Errorf("got differences %v and %v, want %v and %v", agreement["averageDifference"], agreement["averageAbsoluteDifference"], tt.difference, tt.absolute)
+			}
+			if correlation, found := agreement["correlation"]; (tt.correlation == nil && found) || (tt.correlation != nil && correlation != tt.correlation) {
+				t.Errorf("got correlation %v, want %v", correlation, tt.correlation)
+			}
+		})
+	}
+}
+
+func TestCompareTasteGenres(t *testing.T) {
+	// Horror 10 above JH on average, comedy 5 below
+	scores := map[int32]int32{1: 100, 2: 80, 3: 60, 4: 40, 5: 80}
+	tests := []struct {
+		minCount int
+		want     []string
+	}{
+		{3, []string{"Horror"}},
+		{2, []string{"Horror", "Comedy"}},
+		{1, []string{"Horror", "Comedy", "Drama"}},
+		{4, []string{}},
+	}
+	for _, tt := range tests {
+		genres := compareTaste(ratingsOf(scores), tasteCatalog, tt.minCount, 10)["genres"].([]genreDivergence)
+		got := []string{}
+		for _, g := range genres {
+			got = append(got, g.Genre)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("min %d: got %v, want %v", tt.minCount, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("min %d: got %v, want %v", tt.minCount, got, tt.want)
+				break
+			}
+		}
+	}
+
+	horror := compareTaste(ratingsOf(scores), tasteCatalog, 3, 10)["genres"].([]genreDivergence)[0]
+	if horror.Count != 3 || horror.UserAverage != 80 || horror.JHAverage != 70 || horror.Difference != 10 {
+		t.Errorf("got %+v", horror)
+	}
+	if horror.Correlation == nil || *horror.Correlation != 1 {
+		t.Errorf("got horror correlation %v, want 1", horror.Correlation)
+	}
+}
+
+func TestCompareTasteDisagreements(t *testing.T) {
+	scores := map[int32]int32{1: 60, 2: 75, 3: 70, 4: 60, 5: 82}
+	disagreements := compareTaste(ratingsOf(scores), tasteCatalog, 3, 3)["disagreements"].([]disagreement)
+
+	want := []int32{1, 3, 2}
+	if len(disagreements) != len(want) {
+		t.Fatalf("got %d disagreements, want %d", len(disagreements), len(want))
+	}
+	for i, d := range disagreements {
+		if d.Movie.TMDBId != want[i] {
+			t.Errorf("disagreement %d is movie %d, want %d", i, d.Movie.TMDBId, want[i])
+		}
+	}
+	if d := disagreements[0]; d.UserScore != 60 || d.JH_Score != 90 || d.Difference != -30 {
+		t.Errorf("got %+v", d)
+	}
+}
+
+func TestCanSeeRatings(t *testing.T) {
+	private := auth.User{ID: primitive.NewObjectID()}
+	public := auth.User{ID: primitive.NewObjectID(), PublicRatings: true}
+	other := auth.User{ID: primitive.NewObjectID()}
+	admin := auth.User{ID: primitive.NewObjectID(), Admin: true}
+
+	tests := []struct {
+		name      string
+		user      auth.User
+		requester auth.User
+		want      bool
+	}{
+		{"public", public, other, true},
+		{"private", private, other, false},
+		{"own", private, private, true},
+		{"admin", private, admin, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canSeeRatings(tt.user, tt.requester); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package users
+
+import (
+	"time"
+
+	"github.com/helfy18/movie-site-api/modules/movies"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// A user's score for a movie, on the same 0-100 scale as JH_Score
+type rating struct {
+	UserID    primitive.ObjectID `bson:"userId" json:"-"`
+	TMDBId    int32              `bson:"tmdbid" json:"tmdbid"`
+	Score     int32              `bson:"score" json:"score"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// A rating with the movie it is for
+type ratedMovie struct {
+	rating `bson:",inline"`
+	Movie  movies.MovieCard `json:"movie"`
+}
+
+/*
+	 A recommended movie. Predicted blends the collaborative estimate
+		with JH_Score adjusted by how the user usually differs from it.
+*/
+type recommendation struct {
+	Movie         movies.MovieCard `json:"movie"`
+	Predicted     float64          `json:"predicted"`
+	Prior         float64          `json:"prior"`
+	Collaborative *float64         `json:"collaborative"`
+	Neighbors     int              `json:"neighbors"`
+	Reasons       []string         `json:"reasons"`
+}
+
+// A movie a user wants to watch, kept in the order they chose
+type watchlistEntry struct {
+	UserID   primitive.ObjectID `bson:"userId" json:"-"`
+	TMDBId   int32              `bson:"tmdbid" json:"tmdbid"`
+	Position int                `bson:"position" json:"position"`
+	AddedAt  time.Time          `bson:"addedAt" json:"addedAt"`
+}
+
+/*
+	 A watchlist entry with its movie. Streamable is true when the movie
+		is on a subscription service right now.
+*/
+type watchlistItem struct {
+	watchlistEntry `bson:",inline"`
+	Streamable     bool             `json:"streamable"`
+	StreamingOn    []string         `json:"streamingOn"`
+	Movie          movies.MovieCard `json:"movie"`
+}
+
+// One viewing of a movie. Score is optional and separate from ratings
+type diaryEntry struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	UserID    primitive.ObjectID `bson:"userId" json:"-"`
+	TMDBId    int32              `bson:"tmdbid" json:"tmdbid"`
+	WatchedAt time.Time          `bson:"watchedAt" json:"watchedAt"`
+	Rewatch   bool               `bson:"rewatch" json:"rewatch"`
+	Score     *int32             `bson:"score,omitempty" json:"score,omitempty"`
+	Note      string             `bson:"note,omitempty" json:"note,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// A diary entry with its movie
+type diaryItem struct {
+	diaryEntry `bson:",inline"`
+	Movie      movies.MovieCard `json:"movie"`
+}
+
+// A movie on a user list with the curator's note
+type listEntry struct {
+	TMDBId int32  `bson:"tmdbid" json:"tmdbid"`
+	Note   string `bson:"note,omitempty" json:"note,omitempty"`
+}
+
+/*
+	 A named, ordered list of movies curated by a user. Public lists can be
+		read and cloned by anyone with the slug.
+*/
+type movieList struct {
+	ID          primitive.ObjectID `bson:"_id" json:"-"`
+	Slug        string             `bson:"slug" json:"slug"`
+	UserID      primitive.ObjectID `bson:"userId" json:"ownerId"`
+	Owner       string             `bson:"owner" json:"owner"`
+	Title       string             `bson:"title" json:"title"`
+	Description string             `bson:"description" json:"description"`
+	Public      bool               `bson:"public" json:"public"`
+	Entries     []listEntry        `bson:"entries" json:"entries"`
+	ClonedFrom  string             `bson:"clonedFrom,omitempty" json:"clonedFrom,omitempty"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt   time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// A list entry with its movie
+type listItem struct {
+	listEntry
+	Movie movies.MovieCard `json:"movie"`
+}
+
+// A list as returned by the API, entries joined to their movies
+type listView struct {
+	movieList
+	Entries []listItem `json:"entries"`
+}
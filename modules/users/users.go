@@ -0,0 +1,69 @@
+package users
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Indexes on the user collections, keyed by collection
+var indexes = map[string][]mongo.IndexModel{
+	"ratings": {
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "tmdbid", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		// Finds who else rated a movie, for recommendations
+		{Keys: bson.D{{Key: "tmdbid", Value: 1}}},
+	},
+	"watchlist": {{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "tmdbid", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}},
+	"diary": {{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "watchedAt", Value: -1}},
+	}},
+	"lists": {{
+		Keys:    bson.D{{Key: "slug", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}},
+}
+
+// Creates the indexes the user collections rely on
+func EnsureIndexes(ctx context.Context, db *mongo.Database) error {
+	for collection, models := range indexes {
+		if _, err := db.Collection(collection).Indexes().CreateMany(ctx, models); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reads the tmdbid route parameter, rejecting the request when it is invalid
+func tmdbidParam(c *gin.Context) (int32, bool) {
+	id, err := strconv.ParseInt(c.Param("tmdbid"), 10, 32)
+	if err != nil {
+		problem.BadRequest(c, "tmdbid", "tmdbid must be integer")
+		return 0, false
+	}
+	return int32(id), true
+}
+
+// Rejects the request unless a movie with the tmdbid is in the catalog
+func requireMovie(c *gin.Context, db *mongo.Database, tmdbid int32) bool {
+	count, err := db.Collection("movies").CountDocuments(c.Request.Context(), bson.M{"TMDBId": tmdbid})
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movie")
+		return false
+	}
+	if count == 0 {
+		problem.NotFound(c, "No movie has this tmdbid")
+		return false
+	}
+	return true
+}
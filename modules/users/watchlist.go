@@ -0,0 +1,297 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/helfy18/movie-site-api/modules/auth"
+	"github.com/helfy18/movie-site-api/modules/movies"
+	"github.com/helfy18/movie-site-api/modules/problem"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The user's watchlist in order
+func watchlistEntries(ctx context.Context, db *mongo.Database, userID primitive.ObjectID) ([]watchlistEntry, error) {
+	cursor, err := db.Collection("watchlist").Find(ctx, bson.M{"userId": userID}, options.Find().SetSort(bson.M{"position": 1}))
+	if err != nil {
+		return nil, err
+	}
+	entries := []watchlistEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+/*
+Runs fn in a transaction that first writes the user's document in the
+watchlists collection, so concurrent changes to one watchlist conflict
+and are retried one after the other instead of mixing up positions.
+*/
+func changeWatchlist(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, fn func(tx mongo.SessionContext) error) error {
+	session, err := db.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(tx mongo.SessionContext) (interface{}, error) {
+		_, err := db.Collection("watchlists").UpdateOne(tx,
+			bson.M{"_id": userID},
+			bson.M{"$set": bson.M{"updatedAt": time.Now()}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fn(tx)
+	})
+	return err
+}
+
+/*
+Takes the movie off the user's watchlist and closes the gap it leaves.
+Reports whether it was there.
+*/
+func removeFromWatchlist(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, tmdbid int32) (bool, error) {
+	watchlist := db.Collection("watchlist")
+
+	removed := false
+	err := changeWatchlist(ctx, db, userID, func(tx mongo.SessionContext) error {
+		var entry watchlistEntry
+		err := watchlist.FindOneAndDelete(tx, bson.M{"userId": userID, "tmdbid": tmdbid}).Decode(&entry)
+		removed = err == nil
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = watchlist.UpdateMany(tx,
+			bson.M{"userId": userID, "position": bson.M{"$gt": entry.Position}},
+			bson.M{"$inc": bson.M{"position": -1}},
+		)
+		return err
+	})
+	return removed, err
+}
+
+// The next position on the user's watchlist, one past the last
+func nextPosition(ctx context.Context, watchlist *mongo.Collection, userID primitive.ObjectID) (int, error) {
+	var last watchlistEntry
+	err := watchlist.FindOne(ctx, bson.M{"userId": userID}, options.FindOne().SetSort(bson.M{"position": -1})).Decode(&last)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return last.Position + 1, nil
+}
+
+/*
+Checks a new order for the watchlist: every movie on it exactly once.
+Returns what is wrong, or "" when the order is valid.
+*/
+func checkReorder(entries []watchlistEntry, ids []int32) string {
+	onList := make(map[int32]bool, len(entries))
+	for _, e := range entries {
+		onList[e.TMDBId] = true
+	}
+	seen := make(map[int32]bool, len(ids))
+	for _, id := range ids {
+		if !onList[id] || seen[id] {
+			return "tmdbid " + strconv.Itoa(int(id)) + " isn't on the watchlist or is repeated"
+		}
+		seen[id] = true
+	}
+	if len(seen) != len(entries) {
+		return "tmdbids must include every movie on the watchlist"
+	}
+	return ""
+}
+
+/*
+Accepts the ListMovies filters and streamable (true or false).
+Returns the logged-in user's watchlist in order with each movie, flagging
+the ones on a subscription service right now.
+*/
+func GetWatchlist(c *gin.Context) {
+	f, errs := movies.ParseFilter(c)
+	streamable := c.Query("streamable")
+	if streamable != "" && streamable != "true" && streamable != "false" {
+		errs = append(errs, problem.FieldError{Field: "streamable", Detail: "streamable must be true or false"})
+	}
+	if len(errs) > 0 {
+		problem.Invalid(c, errs...)
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	ctx := c.Request.Context()
+
+	entries, err := watchlistEntries(ctx, db, auth.MustUser(c).ID)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch watchlist")
+		return
+	}
+
+	ids := make([]int32, len(entries))
+	for i, e := range entries {
+		ids[i] = e.TMDBId
+	}
+	byId, err := filteredMoviesById(ctx, db, ids, f)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch movies")
+		return
+	}
+
+	items := []watchlistItem{}
+	for _, e := range entries {
+		m, found := byId[e.TMDBId]
+		if !found {
+			continue
+		}
+		streamingOn := m.StreamingOn()
+		item := watchlistItem{watchlistEntry: e, Streamable: len(streamingOn) > 0, StreamingOn: streamingOn, Movie: movies.CardOf(m)}
+		if streamable != "" && strconv.FormatBool(item.Streamable) != streamable {
+			continue
+		}
+		items = append(items, item)
+	}
+	c.IndentedJSON(http.StatusOK, items)
+}
+
+/*
+Accepts tmdbid (path).
+Adds the movie to the end of the logged-in user's watchlist. Adding a
+movie that is already there leaves it where it is.
+*/
+func AddToWatchlist(c *gin.Context) {
+	tmdbid, ok := tmdbidParam(c)
+	if !ok {
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	watchlist := db.Collection("watchlist")
+	ctx := c.Request.Context()
+	if !requireMovie(c, db, tmdbid) {
+		return
+	}
+
+	userID := auth.MustUser(c).ID
+	var entry watchlistEntry
+	added := false
+	err := changeWatchlist(ctx, db, userID, func(tx mongo.SessionContext) error {
+		err := watchlist.FindOne(tx, bson.M{"userId": userID, "tmdbid": tmdbid}).Decode(&entry)
+		added = errors.Is(err, mongo.ErrNoDocuments)
+		if !added {
+			return err
+		}
+
+		position, err := nextPosition(tx, watchlist, userID)
+		if err != nil {
+			return err
+		}
+		entry = watchlistEntry{UserID: userID, TMDBId: tmdbid, Position: position, AddedAt: time.Now()}
+		_, err = watchlist.InsertOne(tx, entry)
+		return err
+	})
+	if err != nil {
+		problem.Error(c, err, "Failed to add to watchlist")
+		return
+	}
+
+	status := http.StatusOK
+	if added {
+		status = http.StatusCreated
+	}
+	c.IndentedJSON(status, entry)
+}
+
+// Removes the movie in the path from the logged-in user's watchlist
+func RemoveFromWatchlist(c *gin.Context) {
+	tmdbid, ok := tmdbidParam(c)
+	if !ok {
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+
+	removed, err := removeFromWatchlist(c.Request.Context(), db, auth.MustUser(c).ID, tmdbid)
+	if err != nil {
+		problem.Error(c, err, "Failed to remove from watchlist")
+		return
+	}
+	if !removed {
+		problem.NotFound(c, "Movie isn't on your watchlist")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+/*
+Accepts tmdbids (JSON), every movie on the watchlist in the new order.
+Reorders the logged-in user's watchlist.
+*/
+func ReorderWatchlist(c *gin.Context) {
+	var body struct {
+		TMDBIds []int32 `json:"tmdbids"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		problem.BadRequest(c, "tmdbids", "tmdbids must be a list of integers")
+		return
+	}
+
+	client := c.MustGet("mongoClient").(*mongo.Client)
+	db := client.Database("jdmovies")
+	ctx := c.Request.Context()
+	userID := auth.MustUser(c).ID
+
+	var invalid string
+	err := changeWatchlist(ctx, db, userID, func(tx mongo.SessionContext) error {
+		entries, err := watchlistEntries(tx, db, userID)
+		if err != nil {
+			return err
+		}
+		if invalid = checkReorder(entries, body.TMDBIds); invalid != "" || len(body.TMDBIds) == 0 {
+			return nil
+		}
+
+		updates := make([]mongo.WriteModel, len(body.TMDBIds))
+		for i, id := range body.TMDBIds {
+			updates[i] = mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"userId": userID, "tmdbid": id}).
+				SetUpdate(bson.M{"$set": bson.M{"position": i}})
+		}
+		_, err = db.Collection("watchlist").BulkWrite(tx, updates)
+		return err
+	})
+	if err != nil {
+		problem.Error(c, err, "Failed to reorder watchlist")
+		return
+	}
+	if invalid != "" {
+		problem.BadRequest(c, "tmdbids", invalid)
+		return
+	}
+
+	entries, err := watchlistEntries(ctx, db, userID)
+	if err != nil {
+		problem.Error(c, err, "Failed to fetch watchlist")
+		return
+	}
+	c.IndentedJSON(http.StatusOK, entries)
+}
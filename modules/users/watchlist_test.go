@@ -0,0 +1,28 @@
+package users
+
+import "testing"
+
+func TestCheckReorder(t *testing.T) {
+	entries := []watchlistEntry{{TMDBId: 11, Position: 0}, {TMDBId: 550, Position: 1}, {TMDBId: 603, Position: 2}}
+	tests := []struct {
+		name    string
+		entries []watchlistEntry
+		ids     []int32
+		want    string
+	}{
+		{"same order", entries, []int32{11, 550, 603}, ""},
+		{"new order", entries, []int32{603, 11, 550}, ""},
+		{"empty watchlist", []watchlistEntry{}, []int32{}, ""},
+		{"not on the watchlist", entries, []int32{11, 550, 603, 13}, "tmdbid 13 isn't on the watchlist or is repeated"},
+		{"repeated", entries, []int32{11, 550, 11}, "tmdbid 11 isn't on the watchlist or is repeated"},
+		{"missing a movie", entries, []int32{603, 11}, "tmdbids must include every movie on the watchlist"},
+		{"none for a full watchlist", entries, []int32{}, "tmdbids must include every movie on the watchlist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkReorder(tt.entries, tt.ids); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}